@@ -7,7 +7,6 @@ require (
 	github.com/Masterminds/sprig v2.20.0+incompatible // indirect
 	github.com/aristanetworks/goarista v0.0.0-20190712234253-ed1100a1c015 // indirect
 	github.com/aws/aws-sdk-go v1.21.7 // indirect
-	github.com/cavaliercoder/grab v2.0.0+incompatible
 	github.com/coreos/go-systemd v0.0.0-20190719114852-fd7a80b32e1f // indirect
 	github.com/ethereum/go-ethereum v1.9.1 // indirect
 	github.com/gliderlabs/ssh v0.2.2 // indirect
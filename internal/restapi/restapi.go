@@ -0,0 +1,65 @@
+// Package restapi holds the plumbing shared by the clients of the JSON REST
+// APIs of forges.
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Do sends req with hc, http.DefaultClient if nil, and decodes the JSON
+// response into v. Responses other than 2xx are an error.
+func Do(ctx context.Context, hc *http.Client, req *http.Request, v interface{}) error {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := ctxhttp.Do(ctx, hc, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v %v: %v: %s", req.Method, req.URL, resp.Status, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%v %v: %v", req.Method, req.URL, err)
+	}
+	return nil
+}
+
+// NewUpload returns a POST request to u of a multipart form holding the
+// contents of r as the file called name in field.
+func NewUpload(u, field, name string, r io.Reader) (*http.Request, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, err := w.CreateFormFile(field, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", u, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req, nil
+}
@@ -0,0 +1,125 @@
+package testutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ModuleFiles returns the .info, .mod and .zip files of version of the
+// module at path, as served by a module proxy.
+func ModuleFiles(t *testing.T, path, version string) map[string][]byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"go.mod", "m.go"} {
+		w, err := zw.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "%v contents\n", name)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string][]byte{
+		".info": []byte(`{"Version":"` + version + `"}`),
+		".mod":  []byte("module " + path + "\n"),
+		".zip":  buf.Bytes(),
+	}
+}
+
+// SumDB is a checksum database stand-in whose tree holds Records.
+type SumDB struct {
+	Records [][]byte
+	Key     string // verifier key of the database
+	Signed  []byte // signed tree head
+
+	leaves [][]byte
+}
+
+// NewSumDB returns a checksum database of n records made by record, signed
+// with a new key.
+func NewSumDB(t *testing.T, n int, record func(i int) []byte) *SumDB {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "sum.example.com"
+	keyData := append([]byte{1}, pub...)
+	h := sha256.Sum256(append([]byte(name+"\n"), keyData...))
+	db := &SumDB{Key: name + "+" + hex.EncodeToString(h[:4]) + "+" + base64.StdEncoding.EncodeToString(keyData)}
+
+	for i := 0; i < n; i++ {
+		r := record(i)
+		db.Records = append(db.Records, r)
+		leaf := sha256.Sum256(append([]byte{0}, r...))
+		db.leaves = append(db.leaves, leaf[:])
+	}
+
+	text := fmt.Sprintf("go.sum database tree\n%d\n%s\n", n, base64.StdEncoding.EncodeToString(mth(db.leaves)))
+	sig := append(append([]byte{}, h[:4]...), ed25519.Sign(priv, []byte(text))...)
+	db.Signed = []byte(text + "\n— " + name + " " + base64.StdEncoding.EncodeToString(sig) + "\n")
+	return db
+}
+
+// Lookup returns the response of the database to a lookup of record id.
+func (db *SumDB) Lookup(id int) string {
+	return fmt.Sprintf("%d\n%s\n%s", id, db.Records[id], db.Signed)
+}
+
+// mth is the RFC 6962 hash of leaves.
+func mth(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(mth(leaves[:k]))
+	h.Write(mth(leaves[k:]))
+	return h.Sum(nil)
+}
+
+// Tile returns the tile at path, such as 0/x001/234.p/5, of height 8.
+func (db *SumDB) Tile(path string) ([]byte, bool) {
+	width := 256
+	if i := strings.Index(path, ".p/"); i >= 0 {
+		w, err := strconv.Atoi(path[i+3:])
+		if err != nil {
+			return nil, false
+		}
+		path, width = path[:i], w
+	}
+	f := strings.SplitN(path, "/", 2)
+	if len(f) != 2 {
+		return nil, false
+	}
+	level, err1 := strconv.Atoi(f[0])
+	index, err2 := strconv.Atoi(strings.NewReplacer("x", "", "/", "").Replace(f[1]))
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+
+	var data []byte
+	for i := index * 256; i < index*256+width; i++ {
+		span := 1 << uint(8*level)
+		if (i+1)*span > len(db.leaves) {
+			return nil, false
+		}
+		data = append(data, mth(db.leaves[i*span:(i+1)*span])...)
+	}
+	return data, true
+}
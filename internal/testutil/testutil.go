@@ -2,6 +2,8 @@ package testutil
 
 import (
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"path/filepath"
 	"testing"
 
@@ -39,3 +41,20 @@ func EmptyGitRepo(t *testing.T, url string) string {
 
 	return filepath.Join(url, git.GitDirName)
 }
+
+// RoundTripFunc is an http.RoundTripper calling the function.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RedirectClient returns a client sending the requests for every site to
+// the test server at serverURL. The Host header keeps the site requested.
+func RedirectClient(serverURL string) *http.Client {
+	return &http.Client{Transport: RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		u, _ := url.Parse(serverURL + req.URL.Path)
+		out := &http.Request{Method: req.Method, URL: u, Header: req.Header, Host: req.URL.Host}
+		return http.DefaultTransport.RoundTrip(out.WithContext(req.Context()))
+	})}
+}
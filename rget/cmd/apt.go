@@ -0,0 +1,155 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgetapt"
+	"go.merklecounty.com/rget/rgetverify"
+)
+
+// aptCmd represents the apt command
+var aptCmd = &cobra.Command{
+	Use:   "apt",
+	Short: "Record and verify the suites of APT repositories",
+	Long: `A suite of an APT repository is recorded as a release whose sums are the
+SHA256 section of its InRelease, or Release, file. The files of the suite,
+such as its Packages indices, are then verified like any other download:
+
+  rget https://deb.example.com/debian/dists/stable/main/binary-amd64/Packages.xz
+
+The OpenPGP signature of the Release file is not checked, apt does that.`,
+}
+
+var aptVerifyCmd = &cobra.Command{
+	Use:   "verify REPO-URL SUITE",
+	Short: "Verify the Release file and Packages indices of a suite are recorded",
+	Long: `verify reads the Release file of the suite, which may be given by suite or
+codename, checks that it is recorded and then downloads every Packages index
+it lists and checks it against the record. Indices the repository does not
+serve, commonly uncompressed ones, are skipped.`,
+	Args: cobra.ExactArgs(2),
+	Run:  aptVerify,
+}
+
+var aptRecordCmd = &cobra.Command{
+	Use:   "record REPO-URL SUITE",
+	Short: "Submit the Release file of a suite to the recorder",
+	Long: `The Release file of the suite is fetched by each --recorder service, a
+record domain name will be generated from its SHA256 section, and a
+subsequent request to that domain will cause a certificate to be generated
+and logged.`,
+	Args: cobra.ExactArgs(2),
+	Run:  aptRecord,
+}
+
+func init() {
+	rootCmd.AddCommand(aptCmd)
+	aptCmd.AddCommand(aptVerifyCmd)
+	aptCmd.AddCommand(aptRecordCmd)
+}
+
+func aptVerify(cmd *cobra.Command, args []string) {
+	repo, suite := args[0], args[1]
+	hc := &http.Client{Timeout: 5 * time.Minute}
+	c := &rgetapt.Client{HTTPClient: hc}
+
+	rel, durl, err := c.Fetch(context.Background(), repo, suite)
+	if err != nil {
+		finish(durl, nil, nil, &rgetverify.Error{Stage: rgetverify.StageSums, Err: err})
+	}
+	fmt.Fprintf(status, "read sums: %v\n", durl)
+
+	v, err := newVerifier(hc)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+
+	res, err := v.RecordSums(context.Background(), durl, rel.Sums())
+	res.SumsURL = durl
+	printRecord(res)
+	if err != nil {
+		finish(durl, res, nil, err)
+	}
+
+	// Every Packages index served must match the record
+	var files []rgetverify.FileReport
+	var firstErr error
+	for _, f := range rel.PackagesIndices() {
+		u := rgetapt.DistURL(repo, suite) + f.Path
+		sum, err := c.Hash(context.Background(), u)
+		if err == rgetapt.ErrNotFound {
+			fmt.Fprintf(status, "skipped: %v: not served\n", f.Path)
+			continue
+		}
+		if err != nil {
+			err = &rgetverify.Error{Stage: rgetverify.StageDigest, Err: err}
+		} else {
+			err = v.CheckDigest(res, u, sum)
+		}
+
+		file := rgetverify.FileReport{Path: f.Path, URL: u, OK: err == nil}
+		if sum != nil {
+			file.Digest = hex.EncodeToString(sum)
+		}
+		if err != nil {
+			file.Error = err.Error()
+			fmt.Fprintf(status, "Error: %v: %v\n", f.Path, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			fmt.Fprintf(status, "OK: %v: %x\n", f.Path, sum)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 && firstErr == nil {
+		firstErr = &rgetverify.Error{Stage: rgetverify.StageDigest, Err: errors.New("no Packages index served")}
+	}
+
+	finish(durl, res, files, firstErr)
+}
+
+func aptRecord(cmd *cobra.Command, args []string) {
+	// The recorder reads the Release file itself, read it first to give a
+	// better error
+	c := &rgetapt.Client{HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	rel, durl, err := c.Fetch(context.Background(), args[0], args[1])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("generated sums for %v from %v:\n\n%s\n", args[1], durl, rel.Sums().SHA256SumFile())
+
+	for _, host := range recorderHosts(durl) {
+		if err := submitTo(host, url.Values{"url": {durl}}); err != nil {
+			fmt.Printf("submit to %v: %v\n", host, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("verify the recorded suite by running:\n\nrget apt verify %s %s\n", args[0], args[1])
+}
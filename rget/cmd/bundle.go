@@ -0,0 +1,94 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgetverify"
+)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle [URL]",
+	Short: "Save the evidence for a release to verify it offline",
+	Long: `bundle verifies the record of the release of URL, as rget does, and saves
+the SHA256SUMS, record certificate chain, SCTs and the log tree heads and
+inclusion proofs that were checked to a single file. Files of the release can
+then be verified without network access with:
+
+  rget verify --bundle release.rgetbundle FILE...
+`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: bundle,
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+
+	bundleCmd.Flags().StringP("output-document", "O", "", "file to save the bundle to (default is the URL name with "+rgetverify.BundleExt+")")
+	bundleCmd.Flags().String("sums", "", "SHA256SUMS path or URL to use instead of the one found from URL")
+}
+
+func bundle(cmd *cobra.Command, args []string) {
+	durl := args[0]
+	out, _ := cmd.Flags().GetString("output-document")
+	sumsLoc, _ := cmd.Flags().GetString("sums")
+	hc := &http.Client{Timeout: 30 * time.Second}
+
+	if out == "" {
+		u, err := url.Parse(durl)
+		if err != nil {
+			finish(durl, nil, nil, err)
+		}
+		out = path.Base(u.Path) + rgetverify.BundleExt
+	}
+
+	v, err := newVerifier(hc)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+
+	b, res, err := v.Bundle(context.Background(), durl, sumsLoc)
+	printRecord(res)
+	if err != nil {
+		finish(durl, res, nil, err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		finish(durl, res, nil, err)
+	}
+	if err := rgetverify.WriteBundle(f, b); err != nil {
+		f.Close()
+		finish(durl, res, nil, err)
+	}
+	if err := f.Close(); err != nil {
+		finish(durl, res, nil, err)
+	}
+
+	fmt.Fprintf(status, "bundle saved to %v\n", out)
+	finish(durl, res, nil, nil)
+}
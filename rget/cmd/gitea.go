@@ -0,0 +1,32 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rget/gitea"
+)
+
+// giteaCmd represents the gitea command
+var giteaCmd = &cobra.Command{
+	Use:   "gitea",
+	Short: "gitea subcommands",
+}
+
+func init() {
+	rootCmd.AddCommand(giteaCmd)
+	gitea.AddCommands(giteaCmd)
+}
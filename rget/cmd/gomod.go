@@ -0,0 +1,182 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"go.merklecounty.com/rget/rgetgomod"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetverify"
+)
+
+// sumdbOff disables the checksum database like GOSUMDB=off does.
+const sumdbOff = "off"
+
+// gomodCmd represents the gomod command
+var gomodCmd = &cobra.Command{
+	Use:   "gomod",
+	Short: "Record and verify Go module versions",
+	Long: `A module version is recorded as a release whose files are its .info, .mod
+and .zip files on the module proxy, hashed with SHA-256, along with the h1
+hashes of go.sum for its zip and go.mod. It is recorded under its URL on
+` + rgetgomod.DefaultProxy + ` whichever proxy it is downloaded from.`,
+}
+
+var gomodVerifyCmd = &cobra.Command{
+	Use:   "verify MODULE@VERSION",
+	Short: "Verify a module version is recorded and matches the checksum database",
+	Long: `verify downloads the module version from --goproxy, checks the sums of its
+files are recorded and then cross-checks its h1 hashes against the
+--sumdb checksum database, whose tree heads are verified with --sumdb-key,
+and against the --go-sum file if given.`,
+	Args: cobra.ExactArgs(1),
+	Run:  gomodVerify,
+}
+
+var gomodRecordCmd = &cobra.Command{
+	Use:   "record MODULE@VERSION",
+	Short: "Submit a module version to the recorder",
+	Long: `The module version is downloaded by each --recorder service, checked
+against the checksum database, a record domain name will be generated from
+the sums of its files, and a subsequent request to that domain will cause a
+certificate to be generated and logged.`,
+	Args: cobra.ExactArgs(1),
+	Run:  gomodRecord,
+}
+
+func init() {
+	rootCmd.AddCommand(gomodCmd)
+	gomodCmd.AddCommand(gomodVerifyCmd)
+	gomodCmd.AddCommand(gomodRecordCmd)
+
+	gomodCmd.PersistentFlags().String("goproxy", rgetgomod.DefaultProxy, "module proxy to download from")
+	viper.BindPFlag("goproxy", gomodCmd.PersistentFlags().Lookup("goproxy"))
+
+	gomodCmd.PersistentFlags().String("sumdb", rgetgomod.DefaultSumDB, "checksum database to cross-check with, or \""+sumdbOff+"\"")
+	viper.BindPFlag("sumdb", gomodCmd.PersistentFlags().Lookup("sumdb"))
+
+	gomodCmd.PersistentFlags().String("sumdb-key", rgetgomod.DefaultSumDBKey, "key verifying the tree heads of --sumdb")
+	viper.BindPFlag("sumdb-key", gomodCmd.PersistentFlags().Lookup("sumdb-key"))
+
+	gomodVerifyCmd.Flags().String("go-sum", "", "go.sum file to cross-check with")
+}
+
+// downloadModule parses mod and downloads the module version.
+func downloadModule(c *rgetgomod.Client, mod string) (*rgetgomod.Module, rgethash.URLSumList, error) {
+	mv, err := rgetgomod.ParseVersion(mod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := c.Download(context.Background(), mv)
+	if err != nil {
+		return nil, nil, &rgetverify.Error{Stage: rgetverify.StageSums, Err: err}
+	}
+	sums, err := m.Sums()
+	if err != nil {
+		return nil, nil, &rgetverify.Error{Stage: rgetverify.StageSums, Err: err}
+	}
+	return m, sums, nil
+}
+
+func gomodClient(hc *http.Client) *rgetgomod.Client {
+	return &rgetgomod.Client{
+		Proxy:      viper.GetString("goproxy"),
+		SumDB:      viper.GetString("sumdb"),
+		SumDBKey:   viper.GetString("sumdb-key"),
+		HTTPClient: hc,
+	}
+}
+
+func gomodVerify(cmd *cobra.Command, args []string) {
+	goSum, _ := cmd.Flags().GetString("go-sum")
+	hc := &http.Client{Timeout: 30 * time.Second}
+	c := gomodClient(hc)
+
+	m, sums, err := downloadModule(c, args[0])
+	if err != nil {
+		finish(args[0], nil, nil, err)
+	}
+	durl := m.Version.RecordURL()
+	fmt.Fprintf(status, "downloaded %v from %v\n", m.Version, viper.GetString("goproxy"))
+
+	v, err := newVerifier(hc)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+
+	res, err := v.RecordSums(context.Background(), durl, sums)
+	printRecord(res)
+	if err != nil {
+		finish(durl, res, nil, err)
+	}
+
+	// The h1 hashes are recorded, checking them checks the record
+	if viper.GetString("sumdb") != sumdbOff {
+		record, err := c.Lookup(context.Background(), m.Version)
+		if err == nil {
+			err = m.CheckGoSum(record)
+		}
+		if err != nil {
+			finish(durl, res, nil, &rgetverify.Error{Stage: rgetverify.StageDigest, Err: fmt.Errorf("checksum database: %v", err)})
+		}
+		fmt.Fprintf(status, "OK: checksum database: %v matches\n", viper.GetString("sumdb"))
+	}
+	if goSum != "" {
+		data, err := ioutil.ReadFile(goSum)
+		if err == nil {
+			err = m.CheckGoSum(data)
+		}
+		if err != nil {
+			finish(durl, res, nil, &rgetverify.Error{Stage: rgetverify.StageDigest, Err: fmt.Errorf("%v: %v", goSum, err)})
+		}
+		fmt.Fprintf(status, "OK: %v matches\n", goSum)
+	}
+
+	fmt.Fprintf(status, "OK: %v: %d digests recorded\n", m.Version, len(sums))
+	finish(durl, res, nil, nil)
+}
+
+func gomodRecord(cmd *cobra.Command, args []string) {
+	// The recorder downloads the module itself, download it first to
+	// give a better error
+	c := gomodClient(&http.Client{Timeout: 30 * time.Second})
+	m, sums, err := downloadModule(c, args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("generated sums for %v:\n\n%s\n", m.Version, sums.SHA256SumFile())
+
+	for _, host := range recorderHosts(m.Version.RecordURL()) {
+		if err := submitTo(host, url.Values{"gomod": {m.Version.String()}}); err != nil {
+			fmt.Printf("submit to %v: %v\n", host, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("verify the recorded module by running:\n\nrget gomod verify %s\n", m.Version)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetoci"
+	"go.merklecounty.com/rget/rgetverify"
+)
+
+// imageCmd represents the image command
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Record and verify the digests of container images",
+	Long: `An image tag is recorded as a release whose files are the digest of the
+manifest the tag points at and, for images of several platforms, the digest
+of the manifest of each platform. They are listed by the registry through
+its v2 API.`,
+}
+
+var imageVerifyCmd = &cobra.Command{
+	Use:   "verify REGISTRY/REPO:TAG",
+	Short: "Verify the digests of an image tag are recorded",
+	Args:  cobra.ExactArgs(1),
+	Run:   imageVerify,
+}
+
+var imageRecordCmd = &cobra.Command{
+	Use:   "record REGISTRY/REPO:TAG",
+	Short: "Submit an image tag to the recorder",
+	Long: `The image tag is resolved by each --recorder service, a record domain
+name will be generated from its digests, and a subsequent request to that
+domain will cause a certificate to be generated and logged.`,
+	Args: cobra.ExactArgs(1),
+	Run:  imageRecord,
+}
+
+func init() {
+	rootCmd.AddCommand(imageCmd)
+	imageCmd.AddCommand(imageVerifyCmd)
+	imageCmd.AddCommand(imageRecordCmd)
+}
+
+// resolveImage parses ref and returns the digests of the image it points at
+// as a sums list.
+func resolveImage(hc *http.Client, ref string) (rgetoci.Reference, rgethash.URLSumList, error) {
+	r, err := rgetoci.ParseReference(ref)
+	if err != nil {
+		return r, nil, err
+	}
+
+	img, err := (&rgetoci.Client{HTTPClient: hc}).Resolve(context.Background(), r)
+	if err != nil {
+		return r, nil, &rgetverify.Error{Stage: rgetverify.StageSums, Err: err}
+	}
+	sums, err := img.Sums()
+	if err != nil {
+		return r, nil, &rgetverify.Error{Stage: rgetverify.StageSums, Err: err}
+	}
+
+	fmt.Fprintf(status, "resolved %v: %v\n", r, img.Digest)
+	for _, m := range img.Manifests {
+		platform := "unknown"
+		if m.Platform != nil {
+			platform = m.Platform.String()
+		}
+		fmt.Fprintf(status, "  %v: %v\n", platform, m.Digest)
+	}
+	return r, sums, nil
+}
+
+func imageVerify(cmd *cobra.Command, args []string) {
+	hc := &http.Client{Timeout: 30 * time.Second}
+
+	ref, sums, err := resolveImage(hc, args[0])
+	if err != nil {
+		finish(args[0], nil, nil, err)
+	}
+	durl := ref.URL()
+
+	v, err := newVerifier(hc)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+
+	res, err := v.RecordSums(context.Background(), durl, sums)
+	printRecord(res)
+	if err == nil {
+		fmt.Fprintf(status, "OK: %v: %d digests recorded\n", ref, len(sums))
+	}
+	finish(durl, res, nil, err)
+}
+
+func imageRecord(cmd *cobra.Command, args []string) {
+	// The recorder resolves the tag itself, resolve it first to give a
+	// better error
+	hc := &http.Client{Timeout: 30 * time.Second}
+	ref, _, err := resolveImage(hc, args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	for _, host := range recorderHosts(ref.URL()) {
+		if err := submitTo(host, url.Values{"image": {ref.String()}}); err != nil {
+			fmt.Printf("submit to %v: %v\n", host, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("verify the recorded image by running:\n\nrget image verify %s\n", ref)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"go.merklecounty.com/rget/rgetct"
+)
+
+// loglistCmd represents the loglist command
+var loglistCmd = &cobra.Command{
+	Use:   "loglist",
+	Short: "manage the CT log list used for verification",
+	Long: `rget verifies SCTs against a CT log list. By default it uses a copy
+updated with "rget loglist update", falling back to the list embedded at build
+time, which builds without one download. A specific file can be pinned with
+--log-list.`,
+}
+
+var loglistUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "download, verify and cache the latest CT log list",
+	Args:  cobra.NoArgs,
+	Run:   loglistUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(loglistCmd)
+	loglistCmd.AddCommand(loglistUpdateCmd)
+}
+
+func loglistUpdate(cmd *cobra.Command, args []string) {
+	dir, err := configDir()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(exitError)
+	}
+
+	hc := &http.Client{Timeout: 30 * time.Second}
+	ll, data, sig, err := rgetct.FetchLogList(hc)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(exitError)
+	}
+
+	if err := rgetct.WriteLogList(dir, data, sig); err != nil {
+		fmt.Printf("failed to save log list: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	fmt.Printf("saved log list version %v published %v to %v\n",
+		ll.Version, ll.Timestamp.Format(time.RFC3339), filepath.Join(dir, rgetct.LogListFile))
+}
+
+// configDir returns the directory rget keeps its state in,
+// $XDG_CONFIG_HOME/rget or $HOME/.config/rget.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "rget"), nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "rget"), nil
+}
+
+// loadLogList returns the log list pinned with --log-list. Otherwise the
+// cached copy from "rget loglist update" or the embedded copy is used, in that
+// order. Only a build without an embedded list downloads it, with hc, and
+// caches it. All but the pinned file must carry a valid signature.
+func loadLogList(hc *http.Client) (*rgetct.LogList, error) {
+	if pinned := viper.GetString("log-list"); pinned != "" {
+		data, err := ioutil.ReadFile(pinned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log list: %v", err)
+		}
+		return rgetct.ParseLogList(data)
+	}
+
+	dir, dirErr := configDir()
+	if dirErr == nil {
+		ll, err := rgetct.ReadLogList(dir)
+		if err == nil {
+			return ll, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cached log list in %v: %v", dir, err)
+		}
+	}
+
+	ll, err := rgetct.EmbeddedLogList()
+	if err != rgetct.ErrNoEmbeddedLogList {
+		return ll, err
+	}
+	if hc == nil {
+		return nil, errors.New(`no log list embedded in this build, run "rget loglist update" or use --log-list`)
+	}
+	ll, data, sig, err := rgetct.FetchLogList(hc)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(status, "fetched log list version %v as none is embedded in this build\n", ll.Version)
+	if dirErr == nil {
+		if err := rgetct.WriteLogList(dir, data, sig); err != nil {
+			fmt.Fprintf(status, "failed to cache log list: %v\n", err)
+		}
+	}
+	return ll, nil
+}
@@ -0,0 +1,86 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// patternsCmd represents the patterns command
+var patternsCmd = &cobra.Command{
+	Use:   "patterns",
+	Short: "inspect the URL patterns that map downloads to releases",
+	Long: `rget maps a download URL to its release with the first pattern it
+matches: those of the config file and --pattern-file, then the built in
+patterns, then those of sites' discovery documents.`,
+}
+
+var patternsTestCmd = &cobra.Command{
+	Use:   "test URL",
+	Short: "show the pattern a URL matches and the release it maps to",
+	Args:  cobra.ExactArgs(1),
+	Run:   patternsTest,
+}
+
+func init() {
+	rootCmd.AddCommand(patternsCmd)
+	patternsCmd.AddCommand(patternsTestCmd)
+}
+
+func patternsTest(cmd *cobra.Command, args []string) {
+	durl := args[0]
+
+	r := newResolver(&http.Client{Timeout: 30 * time.Second})
+	if _, err := r.Resolve(context.Background(), durl); err != nil && err != rgetwellknown.ErrNoDocument {
+		fmt.Printf("discovery document: %v\n", err)
+	}
+
+	m, err := rgetwellknown.MatchURL(durl)
+	if err != nil {
+		fmt.Printf("no pattern matches %v: %v\n", durl, err)
+		os.Exit(exitDomain)
+	}
+
+	name := ""
+	if m.Pattern.Name != "" {
+		name = fmt.Sprintf(" %q", m.Pattern.Name)
+	}
+	fmt.Printf("matched: %v pattern %d%v\n", m.Source, m.Index, name)
+	fmt.Printf("regexp: %v\n", m.Pattern.Regexp)
+	for _, g := range m.GroupNames() {
+		fmt.Printf("  %v: %v\n", g, m.Groups[g])
+	}
+	for _, scheme := range rgetwellknown.Schemes {
+		fmt.Printf("domain (scheme %v): %v\n", scheme, m.Domains[scheme])
+	}
+	for _, name := range viper.GetStringSlice("digest-files") {
+		if _, err := rgethash.AlgorithmForFile(name); err == nil {
+			fmt.Printf("sums: %v%v\n", m.SumPrefix, name)
+		}
+	}
+	for _, a := range m.Aliases {
+		fmt.Printf("alias: %v\n", a)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetverify"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// proofCmd represents the proof command
+var proofCmd = &cobra.Command{
+	Use:   "proof SHA256SUMS FILE",
+	Short: "Print the Merkle inclusion proof of a file in a SHA256SUMS",
+	Long: `proof prints the RFC 6962 inclusion proof of the entry for FILE in the
+Merkle tree of SHA256SUMS, which is a path or URL. If FILE exists its digest
+must match the entry. The entry is looked up under the names rget verify
+accepts for --url, the URL FILE is downloaded from, which defaults to FILE
+next to a SHA256SUMS URL. A file can then be verified with only the proof
+instead of the full SHA256SUMS:
+
+  rget proof SHA256SUMS rget_linux_amd64.tar.gz > rget_linux_amd64.tar.gz.proof
+  rget verify --proof rget_linux_amd64.tar.gz.proof --url URL rget_linux_amd64.tar.gz
+`,
+
+	Args: cobra.ExactArgs(2),
+
+	Run: proof,
+}
+
+func init() {
+	rootCmd.AddCommand(proofCmd)
+
+	proofCmd.Flags().StringP("output-document", "O", "", "file to save the proof to (default is stdout)")
+	proofCmd.Flags().String("url", "", "URL FILE is downloaded from, to find its entry in the SHA256SUMS")
+}
+
+// proofNames returns the names the entry for file may be listed under in the
+// sums at sumsLoc.
+func proofNames(ctx context.Context, v *rgetverify.Verifier, sumsLoc, durl, file string) ([]string, error) {
+	if durl == "" && strings.HasPrefix(sumsLoc, "https://") {
+		durl = sumsLoc[:strings.LastIndex(sumsLoc, "/")+1] + filepath.Base(file)
+	}
+	if durl == "" {
+		return []string{filepath.Base(file)}, nil
+	}
+	if err := v.Resolve(ctx, durl); err != nil {
+		return nil, err
+	}
+	return rgetwellknown.SumNames(durl)
+}
+
+func proof(cmd *cobra.Command, args []string) {
+	if err := writeProof(cmd, args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+func writeProof(cmd *cobra.Command, sumsLoc, file string) error {
+	out, _ := cmd.Flags().GetString("output-document")
+	durl, _ := cmd.Flags().GetString("url")
+
+	hc := &http.Client{Timeout: 30 * time.Second}
+	v := &rgetverify.Verifier{Client: hc, Resolver: &rgetwellknown.Resolver{Client: hc}, Sources: sumsSources(hc)}
+	sums, err := v.FetchSums(context.Background(), sumsLoc)
+	if err != nil {
+		return err
+	}
+
+	names, err := proofNames(context.Background(), v, sumsLoc, durl, file)
+	if err != nil {
+		return err
+	}
+	var p *rgethash.Proof
+	for _, name := range names {
+		if p, err = sums.InclusionProof(name); err == nil {
+			break
+		}
+	}
+	if p == nil {
+		return fmt.Errorf("no entry for any of %q in %v", names, sumsLoc)
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		digest, err := rgetverify.FileDigest(sums.Algorithm(), file)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(digest, p.Sum) {
+			return fmt.Errorf("%v: digest %x does not match %x in %v", file, digest, p.Sum, sumsLoc)
+		}
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if out == "" || out == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(out, data, 0644)
+}
+
+// readProof reads the proof at path.
+func readProof(path string) (*rgethash.Proof, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &rgethash.Proof{}
+	if err := json.NewDecoder(f).Decode(p); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2019 The Merkle County Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgetregistry"
+)
+
+// registryCmd represents the registry command
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Record versions of PyPI and npm packages",
+	Long: `A package version is recorded as a release whose files are those listed by
+the metadata of its registry, hashed with SHA-256 and named by URL. The
+files are then verified like any other download:
+
+  rget https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz`,
+}
+
+var registryRecordCmd = &cobra.Command{
+	Use:   "record pypi|npm PACKAGE@VERSION",
+	Short: "Submit a package version to the recorder",
+	Long: `Each --recorder service reads the files of the package version from the
+metadata of the registry and hashes them, refusing files that do not match
+the digests the registry lists. A record domain name will be generated from
+the resulting SHA256SUMS, and a subsequent request to that domain will cause
+a certificate to be generated and logged.`,
+	Args:      cobra.ExactArgs(2),
+	ValidArgs: []string{"pypi", "npm"},
+	Run:       registryRecord,
+}
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(registryRecordCmd)
+}
+
+func registryRecord(cmd *cobra.Command, args []string) {
+	pv, err := rgetregistry.ParseVersion(args[0], args[1])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	// The recorder hashes the files itself, hash them first to give a
+	// better error
+	c := &rgetregistry.Client{HTTPClient: &http.Client{Timeout: 5 * time.Minute}}
+	rel, err := c.Release(context.Background(), pv)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	sums, err := c.Sums(context.Background(), rel, true)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("generated SHA256SUMS for %v:\n\n%s\n", pv, sums.SHA256SumFile())
+
+	for _, host := range recorderHosts(rel.Target()) {
+		if err := submitTo(host, url.Values{"registry": {args[0]}, "package": {pv.String()}}); err != nil {
+			fmt.Printf("submit to %v: %v\n", host, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("fetch a file of the recorded package by running:\n\nrget %s\n", rel.Target())
+}
@@ -16,13 +16,16 @@ package cmd
 
 import (
 	"context"
-	"crypto/sha256"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -30,19 +33,42 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	"github.com/cavaliercoder/grab"
-	"github.com/google/certificate-transparency-go/ctutil"
-	"github.com/google/certificate-transparency-go/loglist"
-	"github.com/google/certificate-transparency-go/x509"
-	"github.com/google/certificate-transparency-go/x509util"
-
+	"go.merklecounty.com/rget/rgetapt"
 	"go.merklecounty.com/rget/rgetct"
 	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetregistry"
+	"go.merklecounty.com/rget/rgetverify"
 	"go.merklecounty.com/rget/rgetwellknown"
 )
 
 var cfgFile string
 
+// status is where progress and results are reported, stderr when the
+// download itself is written to stdout. report is where the --output json
+// report is written.
+var (
+	status io.Writer = os.Stdout
+	report io.Writer = os.Stdout
+)
+
+// Exit statuses of rget for the different classes of failure. These are
+// documented in Documentation/report.md and must not change.
+const (
+	exitError     = 1 // usage, configuration, network or I/O errors
+	exitChain     = 2 // record certificate chain does not verify
+	exitPolicy    = 3 // SCTs do not meet the CT policy
+	exitDigest    = 4 // file digest is not recorded
+	exitSums      = 5 // sums file cannot be read
+	exitDomain    = 6 // URL has no known recorder domain
+	exitDiscovery = 7 // record certificate cannot be found
+)
+
+// Formats of the --output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "rget [URL]",
@@ -78,6 +104,54 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+
+	rootCmd.Flags().StringP("output-document", "O", "", "file to save the download to, - for stdout")
+	rootCmd.Flags().String("output-dir", "", "directory to save the download to under its URL name")
+
+	rootCmd.PersistentFlags().String("roots", rgetct.RootsSystem, "roots used to validate the record certificate: system, bundled or a PEM file")
+	viper.BindPFlag("roots", rootCmd.PersistentFlags().Lookup("roots"))
+
+	rootCmd.PersistentFlags().Bool("strict", true, "require the digest recorded for the URL itself rather than any digest in the sums list")
+	viper.BindPFlag("strict", rootCmd.PersistentFlags().Lookup("strict"))
+
+	rootCmd.PersistentFlags().String("log-list", "", "CT log list file to use instead of the cached or embedded list")
+	viper.BindPFlag("log-list", rootCmd.PersistentFlags().Lookup("log-list"))
+
+	rootCmd.PersistentFlags().String("policy", rgetct.DefaultPolicy, "CT policy the record certificate must meet: any, chrome, apple or one defined in the config file")
+	viper.BindPFlag("policy", rootCmd.PersistentFlags().Lookup("policy"))
+
+	rootCmd.PersistentFlags().String("discovery", rgetverify.DiscoveryTLS, "how to find the record certificate: tls to dial the recorder, ct to search the CT logs")
+	viper.BindPFlag("discovery", rootCmd.PersistentFlags().Lookup("discovery"))
+
+	rootCmd.PersistentFlags().String("output", outputText, "format of the results: text or json")
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+
+	rootCmd.PersistentFlags().StringSlice("digest-files", []string{"SHA256SUMS", "SHA512SUMS"}, "sums files looked for next to a download, in order of preference")
+	viper.BindPFlag("digest-files", rootCmd.PersistentFlags().Lookup("digest-files"))
+
+	rootCmd.PersistentFlags().StringSlice("recorder", nil, "hosts of the recorders releases are recorded by (default those listed by the site or "+rgetwellknown.PublicServiceHost+")")
+	viper.BindPFlag("recorder", rootCmd.PersistentFlags().Lookup("recorder"))
+
+	rootCmd.PersistentFlags().Int("quorum", 0, "number of recorders that must have recorded a release, all of them if 0")
+	viper.BindPFlag("quorum", rootCmd.PersistentFlags().Lookup("quorum"))
+
+	rootCmd.PersistentFlags().String("pattern-file", "", "YAML or JSON file of URL patterns tried before the built in ones")
+	viper.BindPFlag("pattern-file", rootCmd.PersistentFlags().Lookup("pattern-file"))
+
+	rootCmd.PersistentFlags().StringSlice("gitlab-host", nil, "hosts of self-hosted GitLab instances whose releases are known like those of "+rgetwellknown.GitLabHost)
+	viper.BindPFlag("gitlab-host", rootCmd.PersistentFlags().Lookup("gitlab-host"))
+
+	rootCmd.PersistentFlags().StringSlice("gitea-host", nil, "hosts of self-hosted Gitea or Forgejo instances whose releases are known")
+	viper.BindPFlag("gitea-host", rootCmd.PersistentFlags().Lookup("gitea-host"))
+
+	rootCmd.PersistentFlags().StringSlice("oci-registry", nil, "hosts, with the port if not 443, of container registries whose images are known besides the public ones")
+	viper.BindPFlag("oci-registry", rootCmd.PersistentFlags().Lookup("oci-registry"))
+
+	rootCmd.PersistentFlags().StringSlice("apt-host", nil, "hosts of APT repositories whose suites are known")
+	viper.BindPFlag("apt-host", rootCmd.PersistentFlags().Lookup("apt-host"))
+
+	rootCmd.PersistentFlags().String("ct-search-url", rgetct.DefaultSearchURL, "crt.sh compatible CT search index used with --discovery ct")
+	viper.BindPFlag("ct-search-url", rootCmd.PersistentFlags().Lookup("ct-search-url"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -101,154 +175,424 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	configErr := viper.ReadInConfig()
+
+	// Keep stdout for the download when it is written there
+	if out, _ := rootCmd.Flags().GetString("output-document"); out == "-" {
+		status = os.Stderr
+		report = os.Stderr
+	}
+
+	switch output := viper.GetString("output"); output {
+	case outputText:
+	case outputJSON:
+		status = ioutil.Discard
+	default:
+		fmt.Printf("unknown output format %q\n", output)
+		os.Exit(exitError)
+	}
+
+	if configErr == nil {
+		fmt.Fprintln(status, "Using config file:", viper.ConfigFileUsed())
+	}
+
+	if err := loadPatterns(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// loadPatterns sets the URL patterns listed under the "patterns" key of the
+// config file followed by those of the --pattern-file file, and adds the
+// --gitlab-host and --gitea-host instances, the --oci-registry registries and
+// the --apt-host repository hosts.
+func loadPatterns() error {
+	for forge, key := range map[rgetwellknown.Forge]string{
+		rgetwellknown.GitLab: "gitlab-host",
+		rgetwellknown.Gitea:  "gitea-host",
+	} {
+		for _, host := range viper.GetStringSlice(key) {
+			if err := rgetwellknown.AddForgeHost(forge, host); err != nil {
+				return fmt.Errorf("--%v: %v", key, err)
+			}
+		}
+	}
+
+	for _, host := range viper.GetStringSlice("oci-registry") {
+		if err := rgetwellknown.AddOCIRegistry(host); err != nil {
+			return fmt.Errorf("--oci-registry: %v", err)
+		}
+	}
+
+	for _, host := range viper.GetStringSlice("apt-host") {
+		if err := rgetwellknown.AddAptHost(host); err != nil {
+			return fmt.Errorf("--apt-host: %v", err)
+		}
+	}
+
+	var patterns []rgetwellknown.Pattern
+	if err := viper.UnmarshalKey("patterns", &patterns); err != nil {
+		return fmt.Errorf("invalid patterns in config: %v", err)
+	}
+
+	if file := viper.GetString("pattern-file"); file != "" {
+		pv := viper.New()
+		pv.SetConfigFile(file)
+		if err := pv.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read pattern file: %v", err)
+		}
+		var filePatterns []rgetwellknown.Pattern
+		if err := pv.UnmarshalKey("patterns", &filePatterns); err != nil {
+			return fmt.Errorf("invalid patterns in %v: %v", file, err)
+		}
+		patterns = append(patterns, filePatterns...)
 	}
+
+	return rgetwellknown.SetPatterns(patterns)
 }
 
-func validSCTs(valid, invalid int, cturl string, logs []loglist.Log) string {
+func validSCTs(valid, invalid int, cturl string, results []rgetct.SCTResult) string {
 	var names []string
-	for _, l := range logs {
-		names = append(names, l.Description)
+	for _, r := range results {
+		if r.Log != nil {
+			names = append(names, r.Log.Description)
+		}
 	}
 	return fmt.Sprintf("validated %d/%d SCTs in logs %q ", valid, (valid + invalid), strings.Join(names, ", "))
 }
 
-func levelSCTs(valid, invalid int) (string, error) {
-	switch {
-	case valid != 0 && invalid == 0:
-		return "OK", nil
-	case valid == 0:
-		return "Error", errors.New("no valid SCTs")
-	default:
-		return "Warning", nil
+// describeSCT summarizes the outcome of checking a single SCT.
+func describeSCT(r rgetct.SCTResult) string {
+	log := fmt.Sprintf("%x", r.LogID)
+	if r.Log != nil {
+		log = fmt.Sprintf("%q", r.Log.Description)
 	}
+	if !r.Valid {
+		return fmt.Sprintf("Error: %s via %s from log %s: %v", r.Subject, r.Channel, log, r.Err)
+	}
+	return fmt.Sprintf("OK: %s via %s from log %s at %v", r.Subject, r.Channel, log, r.Timestamp.UTC().Format(time.RFC3339))
 }
 
-func get(cmd *cobra.Command, args []string) {
-	var chain []*x509.Certificate
-	var valid, invalid int
+// loadPolicy returns the CT policy named by the "policy" config key. Policies
+// defined under the "policies" key of the config file take precedence over
+// the built in ones.
+func loadPolicy() (*rgetct.Policy, error) {
+	name := viper.GetString("policy")
 
-	durl := args[0]
+	var policies map[string]rgetct.Policy
+	if err := viper.UnmarshalKey("policies", &policies); err != nil {
+		return nil, fmt.Errorf("invalid policies in config: %v", err)
+	}
+	if p, ok := policies[name]; ok {
+		if p.Name == "" {
+			p.Name = name
+		}
+		return &p, nil
+	}
+
+	return rgetct.PolicyByName(name)
+}
+
+// newResolver returns the resolver of discovery documents, which are cached
+// next to the log list. Only cached documents are used if hc is nil.
+func newResolver(hc *http.Client) *rgetwellknown.Resolver {
+	r := &rgetwellknown.Resolver{Client: hc}
+	if dir, err := configDir(); err == nil {
+		r.Dir = filepath.Join(dir, "wellknown")
+	}
+	return r
+}
 
-	// Step 1: Download the SHA256SUMS that is correct for the URL
-	prefix, err := rgetwellknown.SumPrefix(durl)
+// newVerifier returns a verifier configured from the flags and config file.
+// If hc is nil the verifier is set up without network access: only cached
+// log lists and discovery documents are used and every fetch fails.
+func newVerifier(hc *http.Client) (*rgetverify.Verifier, error) {
+	ll, err := loadLogList(hc)
 	if err != nil {
-		fmt.Printf("%s\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to load log list: %v", err)
 	}
-	sumsURL := prefix + "SHA256SUMS"
-	fmt.Printf("downloading sums: %v\n", sumsURL)
-	response, err := http.Get(sumsURL)
-	var sha256file []byte
+
+	policy, err := loadPolicy()
 	if err != nil {
-		fmt.Printf("%s\n", err)
-		os.Exit(1)
-	} else {
-		var err error
-		defer response.Body.Close()
-		sha256file, err = ioutil.ReadAll(response.Body)
+		return nil, err
+	}
+
+	roots, err := rgetct.LoadRoots(viper.GetString("roots"))
+	if err != nil {
+		return nil, err
+	}
+
+	var algs []rgethash.Algorithm
+	for _, name := range viper.GetStringSlice("digest-files") {
+		a, err := rgethash.AlgorithmForFile(name)
 		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
+			return nil, err
 		}
+		algs = append(algs, a)
 	}
 
-	// Step 2. Generate the CT URL from the SHA256SUMS file
-	domain, err := rgetwellknown.Domain(durl)
-	if err != nil {
-		fmt.Printf("wellknown domain error: %v", err)
-		os.Exit(1)
+	// The verifier and sums sources would fall back to
+	// http.DefaultClient
+	client := hc
+	if client == nil {
+		client = &http.Client{Transport: rgetverify.NoNetwork{}}
 	}
 
-	sums := rgethash.FromSHA256SumFile(string(sha256file))
-	cturl := "https://" + sums.Domain() + "." + domain + "." + rgetwellknown.PublicServiceHost
+	return &rgetverify.Verifier{
+		Client:              client,
+		LogList:             ll,
+		Roots:               roots,
+		Policy:              policy,
+		Discovery:           viper.GetString("discovery"),
+		SearchURL:           viper.GetString("ct-search-url"),
+		AllowSiblingDigests: !viper.GetBool("strict"),
+		Algorithms:          algs,
+		Recorders:           viper.GetStringSlice("recorder"),
+		Quorum:              viper.GetInt("quorum"),
+		Resolver:            newResolver(hc),
+		Sources:             sumsSources(client),
+	}, nil
+}
 
-	fmt.Printf("validating transparency URL: %v\n", cturl)
+// sumsSources returns the sources of the sums of the releases that have no
+// sums file named after its algorithm.
+func sumsSources(hc *http.Client) []rgetverify.SumsSource {
+	return []rgetverify.SumsSource{
+		&rgetregistry.Client{HTTPClient: hc},
+		&rgetapt.Client{HTTPClient: hc},
+		gomodClient(hc),
+	}
+}
 
-	hc := &http.Client{Timeout: 30 * time.Second}
-	ctx := context.Background()
-	lf := ctutil.NewLogInfo
+// recorderHosts returns the hosts of the --recorder flag. If there are none
+// the recorders listed by the site of durl, if its discovery document is
+// registered, or else the public recorder are returned.
+func recorderHosts(durl string) []string {
+	if hosts := viper.GetStringSlice("recorder"); len(hosts) > 0 {
+		return hosts
+	}
+	if hosts := rgetwellknown.Recorders(durl); len(hosts) > 0 {
+		return hosts
+	}
+	return []string{rgetwellknown.PublicServiceHost}
+}
 
-	// TODO(philips): bump to AllLogListURL and embed into this code instead of relying on Google
-	llData, err := x509util.ReadFileOrURL(loglist.LogListURL, hc)
-	if err != nil {
-		fmt.Printf("Failed to read log list: %v", err)
-		os.Exit(1)
+// exitCode returns the exit status for a verification error.
+func exitCode(err error) int {
+	verr, ok := err.(*rgetverify.Error)
+	if !ok {
+		return exitError
 	}
-	ll, err := loglist.NewFromJSON(llData)
-	if err != nil {
-		fmt.Printf("Failed to parse log list: %v", err)
-		os.Exit(1)
+	switch verr.Stage {
+	case rgetverify.StageChain:
+		return exitChain
+	case rgetverify.StagePolicy:
+		return exitPolicy
+	case rgetverify.StageDigest:
+		return exitDigest
+	case rgetverify.StageSums:
+		return exitSums
+	case rgetverify.StageDomain:
+		return exitDomain
+	case rgetverify.StageDiscovery:
+		return exitDiscovery
+	}
+	return exitError
+}
+
+// finish reports the outcome of verifying durl and exits if err is not nil.
+// With --output json the whole report is written as one JSON document.
+func finish(durl string, res *rgetverify.Result, files []rgetverify.FileReport, err error) {
+	if viper.GetString("output") == outputJSON {
+		enc := json.NewEncoder(report)
+		enc.SetIndent("", "  ")
+		if jerr := enc.Encode(rgetverify.NewReport(durl, res, files, err)); jerr != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", jerr)
+		}
+	} else if err != nil {
+		fmt.Fprintf(status, "Error: %v\n", err)
 	}
 
-	// _ to skip TLS extension SCTs, rget doesn't use those yet
-	chain, _, err = rgetct.GetSiteSCTs(ctx, cturl, hc)
 	if err != nil {
-		fmt.Printf("%s: failed to get cert chain: %v\n", cturl, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// printRecord reports the checks of the record for res as far as they got.
+func printRecord(res *rgetverify.Result) {
+	for _, rr := range res.Records {
+		if rr.Err != nil {
+			fmt.Fprintf(status, "Error: recorder %v: %v\n", rr.Recorder, rr.Err)
+		} else {
+			fmt.Fprintf(status, "OK: recorder %v: https://%v\n", rr.Recorder, rr.Domain)
+		}
+	}
+
+	if res.Domain != "" {
+		fmt.Fprintf(status, "validating transparency URL: https://%v\n", res.Domain)
+	}
+
+	if len(res.VerifiedChain) > 0 {
+		root := res.VerifiedChain[len(res.VerifiedChain)-1]
+		fmt.Fprintf(status, "OK: certificate chain: verified to %q\n", root.Subject.CommonName)
+	}
+
+	for _, r := range res.SCTs {
+		fmt.Fprintf(status, "%s\n", describeSCT(r))
+	}
+
+	if res.Policy == nil {
+		return
 	}
 
-	// Check x509 chain SCTs
-	valid, invalid, logs := rgetct.CheckX509(ctx, lf, chain, ll, hc)
-	lvl, err := levelSCTs(valid, invalid)
-	fmt.Printf("%s: x509 SCTs: %s\n", lvl, validSCTs(valid, invalid, cturl, logs))
+	results := rgetct.DedupeSCTs(res.SCTs)
+	valid, invalid := rgetct.CountSCTs(results)
+	lvl := "OK"
+	switch {
+	case valid == 0:
+		lvl = "Error"
+	case invalid > 0:
+		lvl = "Warning"
+	}
+	fmt.Fprintf(status, "%s: SCTs: %s\n", lvl, validSCTs(valid, invalid, "https://"+res.Domain, results))
+
+	for _, c := range res.Policy.Clauses {
+		lvl := "OK"
+		if !c.OK {
+			lvl = "Error"
+		}
+		fmt.Fprintf(status, "%s: policy %s: %s: %s\n", lvl, res.Policy.Policy, c.Name, c.Detail)
+	}
+}
+
+// verifyRecord reads the sums file for durl, from sumsLoc if not empty, and
+// checks that it is recorded. It prints each step and exits on failure.
+func verifyRecord(v *rgetverify.Verifier, durl, sumsLoc string) *rgetverify.Result {
+	res, err := v.Record(context.Background(), durl, sumsLoc)
+	if res.Sums != nil {
+		fmt.Fprintf(status, "read sums: %v\n", res.SumsURL)
+	}
+	printRecord(res)
 	if err != nil {
-		os.Exit(1)
+		finish(durl, res, nil, err)
 	}
 
-	// create download request
-	req, err := grab.NewRequest("", durl)
+	return res
+}
+
+func get(cmd *cobra.Command, args []string) {
+	durl := args[0]
+	hc := &http.Client{Timeout: 30 * time.Second}
+
+	out, _ := cmd.Flags().GetString("output-document")
+	dir, _ := cmd.Flags().GetString("output-dir")
+
+	v, err := newVerifier(hc)
 	if err != nil {
-		fmt.Printf("failed to create grab request: %v\n", err)
-		os.Exit(1)
+		finish(durl, nil, nil, err)
 	}
-	req.NoCreateDirectories = true
 
-	req.AfterCopy = func(resp *grab.Response) (err error) {
-		var f *os.File
-		f, err = os.Open(resp.Filename)
+	// Check the sums file for the URL is recorded in the CT logs
+	res := verifyRecord(v, durl, "")
+
+	dest := out
+	if dest == "" {
+		dest, err = outputName(durl, dir)
 		if err != nil {
-			return
+			finish(durl, res, nil, err)
 		}
-		defer func() {
-			f.Close()
-		}()
+	}
+
+	// Downloads can take longer than the timeout for record lookups
+	resp, err := http.Get(durl)
+	if err != nil {
+		finish(durl, res, nil, &rgetverify.Error{Stage: rgetverify.StageDownload, Err: fmt.Errorf("failed to download: %v", err)})
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		finish(durl, res, nil, &rgetverify.Error{Stage: rgetverify.StageDownload, Err: fmt.Errorf("%v: %v", durl, resp.Status)})
+	}
 
-		h := sha256.New()
-		_, err = io.Copy(h, f)
+	// Nothing reaches the destination until the digest is verified
+	file := rgetverify.FileReport{Path: dest, URL: durl}
+	var fileSum []byte
+	if dest == "-" {
+		var body io.ReadCloser
+		body, fileSum, err = rgetverify.Spool(resp.Body, res.Algorithm(), 0, "")
 		if err != nil {
-			return err
+			finish(durl, res, nil, &rgetverify.Error{Stage: rgetverify.StageDownload, Err: fmt.Errorf("failed to download: %v", err)})
 		}
+		defer body.Close()
 
-		fileSum := h.Sum(nil)
-
-		if !sums.SumExists(fileSum) {
-			mmErr := fmt.Errorf("cannot find %x in %v list", fileSum, cturl)
+		err = v.CheckDigest(res, durl, fileSum)
+		if err == nil {
+			_, err = io.Copy(os.Stdout, body)
+		}
+	} else {
+		fileSum, err = saveVerified(v, res, durl, resp.Body, dest)
+	}
 
-			if err := os.Remove(resp.Filename); err != nil {
-				// err should be os.PathError and include file path
-				return fmt.Errorf(
-					"cannot remove downloaded file with checksum mismatch: %v",
-					mmErr)
-			}
+	if fileSum != nil {
+		file.Digest = hex.EncodeToString(fileSum)
+	}
+	if err != nil {
+		file.Error = err.Error()
+		finish(durl, res, []rgetverify.FileReport{file}, err)
+	}
+	file.OK = true
 
-			return mmErr
-		}
+	fmt.Fprintf(status, "validated file sum: %x\n", fileSum)
+	if dest != "-" {
+		fmt.Fprintln(status, "Download validated and saved to", dest)
+	}
+	finish(durl, res, []rgetverify.FileReport{file}, nil)
+}
 
-		fmt.Printf("validated file sum: %x\n", fileSum)
+// outputName returns the path in dir a download of durl is saved to when no
+// name is given, the last element of the URL path.
+func outputName(durl, dir string) (string, error) {
+	u, err := url.Parse(durl)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", fmt.Errorf("cannot name download of %v, use --output-document", durl)
+	}
+	return filepath.Join(dir, name), nil
+}
 
-		req.SetChecksum(sha256.New(), fileSum, true)
+// saveVerified writes r, downloaded from durl, to a temporary file next to
+// dest and renames it into place once its digest is verified so dest never
+// holds unverified or partial content. The digest is returned whenever the
+// download completed.
+func saveVerified(v *rgetverify.Verifier, res *rgetverify.Result, durl string, r io.Reader, dest string) ([]byte, error) {
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".rget")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
 
-		return
+	h := res.Algorithm().New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, &rgetverify.Error{Stage: rgetverify.StageDownload, Err: fmt.Errorf("failed to download: %v", err)}
 	}
 
-	// download and validate file
-	resp := grab.DefaultClient.Do(req)
-	if err := resp.Err(); err != nil {
-		fmt.Printf("Failed to grab: %v\n", err)
-		os.Exit(1)
+	fileSum := h.Sum(nil)
+	if err := v.CheckDigest(res, durl, fileSum); err != nil {
+		return fileSum, err
 	}
 
-	fmt.Println("Download validated and saved to", resp.Filename)
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return fileSum, err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fileSum, err
+	}
+	return fileSum, nil
 }
@@ -20,6 +20,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -31,6 +32,7 @@ import (
 	"go.merklecounty.com/rget/gitcache"
 	"go.merklecounty.com/rget/rgethash"
 	"go.merklecounty.com/rget/rgetserver"
+	"go.merklecounty.com/rget/rgetwellknown"
 )
 
 // serverCmd represents the server command
@@ -46,6 +48,10 @@ func init() {
 	rootCmd.AddCommand(serverCmd)
 }
 
+// maxResolvedSites bounds the discovery documents the server keeps for the
+// sites of submitted URLs, which anyone can choose.
+const maxResolvedSites = 1000
+
 func server(cmd *cobra.Command, args []string) {
 	if len(args) < 2 {
 		fmt.Printf("missing required arguments (public git URL, private git URL)\n")
@@ -54,6 +60,14 @@ func server(cmd *cobra.Command, args []string) {
 	pubgit := args[0]
 	privgit := args[1]
 
+	// Record domains end in the host the server records under
+	recorders := recorderHosts("")
+	if len(recorders) != 1 {
+		fmt.Printf("the server records under exactly one --recorder host, got %q\n", recorders)
+		os.Exit(1)
+	}
+	host := recorders[0]
+
 	username := os.Getenv("GITHUB_USERNAME")
 	password := os.Getenv("GITHUB_PASSWORD")
 
@@ -79,6 +93,11 @@ func server(cmd *cobra.Command, args []string) {
 	rs := rgetserver.Server{
 		GitCache: pubgc,
 		ProjReqs: rr,
+		Host:     host,
+		Resolver: &rgetwellknown.Resolver{
+			Client:   &http.Client{Timeout: 30 * time.Second},
+			MaxSites: maxResolvedSites,
+		},
 	}
 
 	http.HandleFunc("/", rs.ReleaseHandler)
@@ -89,7 +108,7 @@ func server(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
-	hostPolicy := rgethash.HostPolicyFunc(pubgc)
+	hostPolicy := rgethash.HostPolicyFunc(pubgc, host)
 
 	hostPolicyLog := func(ctx context.Context, host string) (autocert.Policy, error) {
 		policy, err := hostPolicy(ctx, host)
@@ -15,15 +15,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"go.merklecounty.com/rget/rgetgithub"
+	"go.merklecounty.com/rget/rgetverify"
 	"go.merklecounty.com/rget/rgetwellknown"
 )
 
@@ -31,7 +34,7 @@ import (
 var submitCmd = &cobra.Command{
 	Use:   "submit [https://example.com/path/to/downloads/SHA256SUMS]",
 	Short: "submit a URL to the recorder",
-	Long: `The submitted URL will be fetched by the recorder service,
+	Long: `The submitted URL will be fetched by each --recorder service,
 a record domain name will be generated, and a subsequent request to that
 domain will cause a certificate to be generated and logged.`,
 	Run: submit,
@@ -46,26 +49,32 @@ func submit(cmd *cobra.Command, args []string) {
 		cmd.Usage()
 		os.Exit(1)
 	}
-	resp, err := http.PostForm("https://"+rgetwellknown.PublicServiceHost+"/api/v1/submit", url.Values{
-		"url": {args[0]},
-	})
-	defer resp.Body.Close()
-	if err != nil {
-		fmt.Printf("submit POST error: %v\n", err)
+
+	// The recorder refuses sums that do not parse cleanly, check first to
+	// give a better error
+	hc := &http.Client{Timeout: 30 * time.Second}
+	v := &rgetverify.Verifier{Client: hc, Resolver: &rgetwellknown.Resolver{Client: hc}, Sources: sumsSources(hc)}
+	if err := v.Resolve(context.Background(), args[0]); err != nil {
+		fmt.Printf("unknown release: %v\n", err)
 		os.Exit(1)
 	}
-
-	_, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("submit read response error: %v\n", err)
+	if _, err := v.FetchSums(context.Background(), args[0]); err != nil {
+		fmt.Printf("invalid sums file: %v\n", err)
 		os.Exit(1)
 	}
 
+	for _, host := range recorderHosts(args[0]) {
+		if err := submitTo(host, url.Values{"url": {args[0]}}); err != nil {
+			fmt.Printf("submit to %v: %v\n", host, err)
+			os.Exit(1)
+		}
+	}
+
 	// TODO(philips): create a rgetwellknown function to generate a "test URL"
 	m, err := rgetwellknown.GitHubMatches(args[0])
 	if err != nil {
-		fmt.Printf("unable to parse GitHub URL: %v\n", err)
-		os.Exit(1)
+		// Releases of other sites have no archives to suggest
+		return
 	}
 
 	aurls := rgetgithub.ArchiveURLs(m["org"], m["repo"], m["tag"])
@@ -73,3 +82,22 @@ func submit(cmd *cobra.Command, args []string) {
 	fmt.Printf("fetch a file for this submitted release by running:\n\n")
 	fmt.Printf("rget %s\n", aurls[0])
 }
+
+// submitTo submits form, the URL of a sums file or another submission, to
+// the recorder serving under host.
+func submitTo(host string, form url.Values) error {
+	resp, err := http.PostForm("https://"+host+"/api/v1/submit", form)
+	if err != nil {
+		return fmt.Errorf("POST error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rejected: %v: %s", resp.Status, body)
+	}
+	return nil
+}
@@ -15,36 +15,278 @@
 package cmd
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
 	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetverify"
+	"go.merklecounty.com/rget/rgetwellknown"
 )
 
 // verifyCmd represents the verify command
 var verifyCmd = &cobra.Command{
-	Use:   "verify",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("verify called")
-	},
+	Use:   "verify [FILE|DIR]...",
+	Short: "Verify already downloaded files with CT Log backed transparency",
+	Long: `verify runs the same checks as rget on files that have already been
+downloaded. The --url flag gives the URL a file was downloaded from and the
+SHA256SUMS is found from it, or read from --sums.
+
+Directories, or more than one file, are verified against a single SHA256SUMS.
+Each file is then checked as if it were downloaded from the release of --url,
+for example:
+
+  rget verify --url https://github.com/org/repo/releases/download/v1.0/SHA256SUMS ./dist
+
+With --bundle the checks are made against a bundle saved by "rget bundle"
+without network access. --url then defaults to the URL the bundle was made
+for.
+
+With --proof a single file is verified against its inclusion proof, printed
+by "rget proof", instead of the full SHA256SUMS. A proof covers the name and
+digest of its entry, so only releases recorded under record domain scheme 2
+or later can be verified this way. The record certificate chain can be given
+in PEM with --cert, otherwise it is discovered as usual.
+`,
+
+	Args: cobra.MinimumNArgs(1),
+
+	Run: verify,
 }
 
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 
-	// Here you will define your flags and configuration settings.
+	verifyCmd.Flags().String("url", "", "URL the file was downloaded from, or any URL of the release when verifying several files")
+	verifyCmd.Flags().String("sums", "", "SHA256SUMS path or URL to use instead of the one found from --url")
+	verifyCmd.Flags().String("bundle", "", "verify offline against a bundle saved by rget bundle")
+	verifyCmd.Flags().String("proof", "", "verify a single file against its inclusion proof printed by rget proof")
+	verifyCmd.Flags().String("cert", "", "PEM record certificate chain to use with --proof instead of discovering it")
+}
+
+// readBundle reads the bundle at path.
+func readBundle(path string) (*rgetverify.Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return rgetverify.ReadBundle(f)
+}
+
+// readChain reads the PEM certificate chain at path, leaf first.
+func readChain(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := x509util.CertificatesFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%v: no certificates", path)
+	}
+	return chain, nil
+}
+
+// sameRelease reports whether a and b are URLs of the same release.
+func sameRelease(a, b string) bool {
+	pa, err := rgetwellknown.SumPrefix(a)
+	if err != nil {
+		return false
+	}
+	pb, err := rgetwellknown.SumPrefix(b)
+	return err == nil && pa == pb
+}
+
+// verifyTargets expands args into the files to verify and the URL each was
+// downloaded from. A single file is taken to be from durl itself, otherwise
+// files are named relative to the sums prefix of durl.
+func verifyTargets(durl string, args []string) (files, urls []string, err error) {
+	if len(args) == 1 {
+		fi, err := os.Stat(args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fi.IsDir() {
+			return args, []string{durl}, nil
+		}
+	}
+
+	prefix, err := rgetwellknown.SumPrefix(durl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	add := func(path string) {
+		files = append(files, path)
+		urls = append(urls, prefix+filepath.Base(path))
+	}
+
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fi.IsDir() {
+			add(arg)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			// The sums files are what is being verified against
+			if !e.Mode().IsRegular() {
+				continue
+			}
+			if _, err := rgethash.AlgorithmForFile(e.Name()); err == nil {
+				continue
+			}
+			add(filepath.Join(arg, e.Name()))
+		}
+	}
+
+	return files, urls, nil
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	durl, _ := cmd.Flags().GetString("url")
+	sumsLoc, _ := cmd.Flags().GetString("sums")
+	bundlePath, _ := cmd.Flags().GetString("bundle")
+	proofPath, _ := cmd.Flags().GetString("proof")
+	certPath, _ := cmd.Flags().GetString("cert")
+	hc := &http.Client{Timeout: 30 * time.Second}
+
+	var p *rgethash.Proof
+	var chain []*x509.Certificate
+	if proofPath != "" {
+		if sumsLoc != "" || bundlePath != "" {
+			finish(durl, nil, nil, errors.New("--proof cannot be used with --sums or --bundle"))
+		}
+		var err error
+		p, err = readProof(proofPath)
+		if err != nil {
+			finish(durl, nil, nil, err)
+		}
+		if certPath != "" {
+			chain, err = readChain(certPath)
+			if err != nil {
+				finish(durl, nil, nil, err)
+			}
+		}
+	} else if certPath != "" {
+		finish(durl, nil, nil, errors.New("--cert requires --proof"))
+	}
+
+	var b *rgetverify.Bundle
+	if bundlePath != "" {
+		if sumsLoc != "" {
+			finish(durl, nil, nil, errors.New("--sums cannot be used with --bundle"))
+		}
+		var err error
+		b, err = readBundle(bundlePath)
+		if err != nil {
+			finish(durl, nil, nil, err)
+		}
+		if durl == "" {
+			durl = b.URL
+		}
+		hc = nil
+	}
+	if durl == "" {
+		finish(durl, nil, nil, errors.New("--url is required"))
+	}
+
+	v, err := newVerifier(hc)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+
+	// Releases of sites that are not built in are known once their
+	// discovery document is
+	if err := v.Resolve(context.Background(), durl); err != nil {
+		finish(durl, nil, nil, err)
+	}
+	if b != nil {
+		if err := v.Resolve(context.Background(), b.URL); err != nil {
+			finish(durl, nil, nil, err)
+		}
+		if !sameRelease(durl, b.URL) {
+			finish(durl, nil, nil, fmt.Errorf("--url is not from the release of the bundle for %v", b.URL))
+		}
+	}
+
+	files, urls, err := verifyTargets(durl, args)
+	if err != nil {
+		finish(durl, nil, nil, err)
+	}
+	if len(files) == 0 {
+		finish(durl, nil, nil, errors.New("no files to verify"))
+	}
+	if p != nil && len(files) != 1 {
+		finish(durl, nil, nil, errors.New("--proof verifies a single file"))
+	}
+
+	var res *rgetverify.Result
+	switch {
+	case b != nil:
+		fmt.Fprintf(status, "reading bundle: %v\n", bundlePath)
+		res, err = v.VerifyBundle(context.Background(), b)
+		printRecord(res)
+		if err != nil {
+			finish(durl, res, nil, err)
+		}
+	case p != nil:
+		fmt.Fprintf(status, "reading proof: %v\n", proofPath)
+		res, err = v.RecordProof(context.Background(), durl, p, chain)
+		printRecord(res)
+		if err != nil {
+			finish(durl, res, nil, err)
+		}
+	default:
+		res = verifyRecord(v, durl, sumsLoc)
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// verifyCmd.PersistentFlags().String("foo", "", "A help for foo")
+	var reports []rgetverify.FileReport
+	failed := 0
+	for i, f := range files {
+		fr := rgetverify.FileReport{Path: f, URL: urls[i]}
+		fileSum, err := rgetverify.FileDigest(res.Algorithm(), f)
+		if err == nil {
+			fr.Digest = hex.EncodeToString(fileSum)
+			err = v.CheckDigest(res, urls[i], fileSum)
+		}
+		if err != nil {
+			fmt.Fprintf(status, "Error: %s: %v\n", f, err)
+			fr.Error = err.Error()
+			failed++
+		} else {
+			fmt.Fprintf(status, "OK: %s: validated file sum: %x\n", f, fileSum)
+			fr.OK = true
+		}
+		reports = append(reports, fr)
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// verifyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	if failed > 0 {
+		err = &rgetverify.Error{
+			Stage: rgetverify.StageDigest,
+			Err:   fmt.Errorf("%d of %d files not recorded", failed, len(files)),
+		}
+	}
+	finish(durl, res, reports, err)
 }
@@ -0,0 +1,53 @@
+// Package forge holds what the publish-release-sums commands of the
+// different forges share.
+package forge
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"go.merklecounty.com/rget/rgetforge"
+	"go.merklecounty.com/rget/rgethash"
+)
+
+// SumsName is the name of the sums file published.
+const SumsName = "SHA256SUMS"
+
+// PublishReleaseSums downloads every asset of the release of owner/repo
+// tagged tag on f, generates a SHA256SUMS file of their digests and, unless
+// dryRun, adds it to the assets of the release.
+func PublishReleaseSums(ctx context.Context, f rgetforge.Forge, owner, repo, tag string, dryRun bool) error {
+	urls, err := f.ReleaseURLs(ctx, owner, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	sums := rgethash.URLSumList{}
+	for _, u := range urls {
+		// Leave out the sums published by a previous run
+		if path.Base(u) == SumsName {
+			continue
+		}
+		if err := sums.AddURL(u); err != nil {
+			return fmt.Errorf("failed to hash %v: %v", u, err)
+		}
+	}
+
+	content := sums.SHA256SumFile()
+
+	fmt.Printf("generated %s:\n\n%s\n", SumsName, content)
+
+	if dryRun {
+		return nil
+	}
+
+	sumsURL, err := f.PublishSums(ctx, owner, repo, tag, SumsName, strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("submit the uploaded %s to the public record by running:\n\nrget submit %s\n", SumsName, sumsURL)
+	return nil
+}
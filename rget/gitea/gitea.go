@@ -0,0 +1,7 @@
+package gitea
+
+import "github.com/spf13/cobra"
+
+func AddCommands(root *cobra.Command) {
+	root.AddCommand(publishReleaseSumsCmd)
+}
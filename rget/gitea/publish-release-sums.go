@@ -0,0 +1,69 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rget/forge"
+	"go.merklecounty.com/rget/rgetforge"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// tokenEnv is the environment variable holding the Gitea access token, which
+// needs the write:repository scope to upload.
+const tokenEnv = "GITEA_TOKEN"
+
+var publishReleaseSumsCmd = &cobra.Command{
+	Use:   "publish-release-sums [gitea release URL]",
+	Short: "Publish the release sums file for a release to a SHA256SUMS file",
+	Long: `For a given release of a Gitea or Forgejo instance download each attachment
+and source archive, generate a cryptographic digest, and attach a SHA256SUMS
+file to that release.
+
+The access token is read from the ` + tokenEnv + ` environment variable. To test out
+the command without uploading see the --dry-run flag.
+`,
+	Run: publishReleaseSumsMain,
+}
+
+func init() {
+	publishReleaseSumsCmd.Flags().BoolP("dry-run", "d", false, "Do not upload to Gitea")
+}
+
+func publishReleaseSumsMain(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	if len(args) != 1 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	m, err := rgetwellknown.GiteaMatches(args[0])
+	if err != nil {
+		fmt.Printf("matches: %v\n", err)
+		os.Exit(1)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		panic(err)
+	}
+
+	token := os.Getenv(tokenEnv)
+	if !dryRun && token == "" {
+		fmt.Printf("error: %v is not set\n", tokenEnv)
+		os.Exit(1)
+	}
+
+	f, err := rgetforge.New(rgetwellknown.Gitea, m["root"], token)
+	if err != nil {
+		panic(err)
+	}
+	if err := forge.PublishReleaseSums(ctx, f, m["org"], m["repo"], m["tag"], dryRun); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
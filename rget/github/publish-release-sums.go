@@ -3,7 +3,6 @@ package github
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 
@@ -12,8 +11,8 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/oauth2"
 
-	"go.merklecounty.com/rget/rgetgithub"
-	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rget/forge"
+	"go.merklecounty.com/rget/rgetforge"
 	"go.merklecounty.com/rget/rgetwellknown"
 )
 
@@ -33,8 +32,6 @@ func init() {
 }
 
 func publishReleaseSumsMain(cmd *cobra.Command, args []string) {
-	var releases []github.RepositoryRelease
-
 	ctx := context.Background()
 
 	if len(args) != 1 {
@@ -73,67 +70,13 @@ func publishReleaseSumsMain(cmd *cobra.Command, args []string) {
 		client = github.NewClient(tc.Client)
 	}
 
-	if m["tag"] != "" {
-		release, _, err := client.Repositories.GetReleaseByTag(ctx, m["org"], m["repo"], m["tag"])
-		if err != nil {
-			panic(err)
-		}
-		releases = append(releases, *release)
-	} else {
+	if m["tag"] == "" {
 		fmt.Printf("error: no tag and --all-releases not set")
 		os.Exit(1)
 	}
 
-	urls := rgethash.URLSumList{}
-	for _, r := range releases {
-		for _, a := range r.Assets {
-			urls.AddURL(*a.BrowserDownloadURL)
-		}
-		urls.AddURL(*r.ZipballURL)
-		urls.AddURL(*r.TarballURL)
-
-		// Grab the git tag URLs
-		tu := rgetgithub.ArchiveURLs(m["org"], m["repo"], *r.TagName)
-		for _, t := range tu {
-			urls.AddURL(t)
-		}
-
-		sha256sumfile := urls.SHA256SumFile()
-
-		content := []byte(sha256sumfile)
-
-		fmt.Printf("generated SHA256SUMS:\n\n%s\n", content)
-
-		if !dryRun {
-			uploadSums(client, m["org"], m["repo"], *r.TagName, r, content)
-			fmt.Printf("submit the uploaded SHA256SUMS to the public record by running:\n\nrget submit https://github.com/%s/%s/releases/download/%s/SHA256SUMS\n", m["org"], m["repo"], *r.TagName)
-		}
-	}
-
-}
-
-func uploadSums(client *github.Client, owner, repo, tag string, release github.RepositoryRelease, content []byte) {
-	ctx := context.Background()
-
-	tmpfile, err := ioutil.TempFile("", "rget*")
-	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
-	}
-	defer os.Remove(tmpfile.Name())
-
-	if _, err := tmpfile.Write(content); err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
-	}
-
-	// github client, rightfully, expects to be at the beginning of the file
-	tmpfile.Sync()
-	tmpfile.Seek(0, 0)
-
-	uo := github.UploadOptions{Name: "SHA256SUMS"}
-	_, _, err = client.Repositories.UploadReleaseAsset(ctx, owner, repo, *release.ID, &uo, tmpfile)
-	if err != nil {
+	f := &rgetforge.GitHub{Client: client}
+	if err := forge.PublishReleaseSums(ctx, f, m["org"], m["repo"], m["tag"], dryRun); err != nil {
 		fmt.Printf("%v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,72 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"go.merklecounty.com/rget/rget/forge"
+	"go.merklecounty.com/rget/rgetforge"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// tokenEnv is the environment variable holding the GitLab access token,
+// which needs the api scope to upload.
+const tokenEnv = "GITLAB_TOKEN"
+
+var publishReleaseSumsCmd = &cobra.Command{
+	Use:   "publish-release-sums [gitlab release URL]",
+	Short: "Publish the release sums file for a release to a SHA256SUMS file",
+	Long: `For a given release download each link and source archive, generate a
+cryptographic digest, and upload a SHA256SUMS file linked from that release.
+
+The access token is read from the ` + tokenEnv + ` environment variable and needs
+the api scope. To test out the command without uploading see the --dry-run flag.
+`,
+	Run: publishReleaseSumsMain,
+}
+
+func init() {
+	publishReleaseSumsCmd.Flags().BoolP("dry-run", "d", false, "Do not upload to GitLab")
+}
+
+func publishReleaseSumsMain(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	if len(args) != 1 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	m, err := rgetwellknown.GitLabMatches(args[0])
+	if err != nil {
+		fmt.Printf("matches: %v\n", err)
+		os.Exit(1)
+	}
+	if m["org"] == "" || m["repo"] == "" || m["tag"] == "" {
+		fmt.Printf("error: %v is not a GitLab release URL\n", args[0])
+		os.Exit(1)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		panic(err)
+	}
+
+	token := os.Getenv(tokenEnv)
+	if !dryRun && token == "" {
+		fmt.Printf("error: %v is not set\n", tokenEnv)
+		os.Exit(1)
+	}
+
+	f, err := rgetforge.New(rgetwellknown.GitLab, m["root"], token)
+	if err != nil {
+		panic(err)
+	}
+	if err := forge.PublishReleaseSums(ctx, f, m["org"], m["repo"], m["tag"], dryRun); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
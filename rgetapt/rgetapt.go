@@ -0,0 +1,339 @@
+// Package rgetapt records the suites of APT repositories. The SHA256 section
+// of the Release, or InRelease, file of a suite lists the digests of its
+// indices and is recorded as its sums list, so the Packages indices, and
+// through them every package, can be checked against the record.
+//
+// The OpenPGP signature of InRelease files is not checked, apt does that.
+package rgetapt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// ReleaseFiles are the names of the Release files of a suite, in order of
+// preference.
+var ReleaseFiles = []string{"InRelease", "Release"}
+
+// maxRelease is the largest Release file read.
+const maxRelease = 64 << 20
+
+// ErrNotFound is returned for files a repository does not serve.
+var ErrNotFound = errors.New("not found")
+
+// IsReleaseFile reports whether name is the name of a Release file.
+func IsReleaseFile(name string) bool {
+	for _, n := range ReleaseFiles {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// DistURL returns the URL of the directory of suite in the repository at
+// repo, which the files of the Release file are named relative to.
+func DistURL(repo, suite string) string {
+	return strings.TrimSuffix(repo, "/") + "/dists/" + suite + "/"
+}
+
+// File is an entry of the SHA256 section of a Release file.
+type File struct {
+	Path   string
+	Size   int64
+	SHA256 []byte
+}
+
+// Release is a parsed Release file.
+type Release struct {
+	Suite    string
+	Codename string
+	Files    []File
+}
+
+const (
+	signedBegin    = "-----BEGIN PGP SIGNED MESSAGE-----"
+	signatureBegin = "-----BEGIN PGP SIGNATURE-----"
+)
+
+// clearText returns the text signed by the OpenPGP cleartext signed message
+// data, or data itself if it is not signed.
+func clearText(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(signedBegin)) {
+		return data, nil
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, maxRelease)
+	s.Scan()
+
+	// Armor headers end with an empty line
+	for s.Scan() && strings.TrimRight(s.Text(), "\r") != "" {
+	}
+
+	var buf bytes.Buffer
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == signatureBegin {
+			return buf.Bytes(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "- "))
+		buf.WriteByte('\n')
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("signed message has no signature")
+}
+
+// ParseRelease parses a Release or InRelease file.
+func ParseRelease(data []byte) (*Release, error) {
+	text, err := clearText(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := &Release{}
+	field := ""
+	s := bufio.NewScanner(bytes.NewReader(text))
+	s.Buffer(nil, maxRelease)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			// Only the first paragraph is read
+			if field != "" {
+				break
+			}
+			continue
+		}
+
+		// Continuation lines belong to the field above
+		if line[0] == ' ' || line[0] == '\t' {
+			if field == "" {
+				return nil, fmt.Errorf("line %d: continuation line without a field", n)
+			}
+			if field != "SHA256" {
+				continue
+			}
+			f, err := parseFile(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			rel.Files = append(rel.Files, f)
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: invalid field %q", n, line)
+		}
+		field = line[:i]
+		value := strings.TrimSpace(line[i+1:])
+		switch field {
+		case "Suite":
+			rel.Suite = value
+		case "Codename":
+			rel.Codename = value
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if rel.Suite == "" && rel.Codename == "" {
+		return nil, errors.New("no Suite or Codename")
+	}
+	if len(rel.Files) == 0 {
+		return nil, errors.New("no SHA256 files")
+	}
+	return rel, nil
+}
+
+// parseFile parses a line of the SHA256 section of a Release file.
+func parseFile(line string) (File, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return File{}, fmt.Errorf("invalid SHA256 line %q", line)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != sha256.Size {
+		return File{}, fmt.Errorf("invalid SHA256 digest %q", fields[0])
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return File{}, fmt.Errorf("invalid size %q", fields[1])
+	}
+	p := fields[2]
+	if strings.HasPrefix(p, "/") || path.Clean(p) != p || strings.HasPrefix(p, "../") {
+		return File{}, fmt.Errorf("invalid path %q", p)
+	}
+	return File{Path: p, Size: size, SHA256: sum}, nil
+}
+
+// Sums returns the sums list rel is recorded with, the SHA-256 of each of
+// its files named by path.
+func (rel *Release) Sums() rgethash.URLSumList {
+	var sums rgethash.URLSumList
+	for _, f := range rel.Files {
+		sums = append(sums, rgethash.URLSum{URL: f.Path, Sum: f.SHA256, Algorithm: rgethash.SHA256})
+	}
+	return sums
+}
+
+// CheckSuite checks that rel is the Release file of suite, which may be its
+// suite or codename, so it cannot be served for another suite.
+func (rel *Release) CheckSuite(suite string) error {
+	if suite != rel.Suite && suite != rel.Codename {
+		return fmt.Errorf("Release is of suite %q codename %q not %q", rel.Suite, rel.Codename, suite)
+	}
+	return nil
+}
+
+// PackagesIndices returns the files of rel that are Packages indices,
+// compressed or not.
+func (rel *Release) PackagesIndices() []File {
+	var files []File
+	for _, f := range rel.Files {
+		base := path.Base(f.Path)
+		if base == "Packages" || strings.HasPrefix(base, "Packages.") {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Client downloads the files of APT repositories.
+type Client struct {
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// open returns the body of the file at u, ErrNotFound if it does not exist.
+func (c *Client) open(ctx context.Context, u string) (io.ReadCloser, error) {
+	resp, err := ctxhttp.Get(ctx, c.client(), u)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("%v: %v", u, resp.Status)
+}
+
+// Fetch reads the first of ReleaseFiles of suite in the repository at repo
+// that exists and returns it with its URL.
+func (c *Client) Fetch(ctx context.Context, repo, suite string) (*Release, string, error) {
+	for _, name := range ReleaseFiles {
+		u := DistURL(repo, suite) + name
+		rel, err := c.Read(ctx, u)
+		if err == ErrNotFound {
+			continue
+		}
+		return rel, u, err
+	}
+	return nil, "", fmt.Errorf("no Release file of %v found in %v", suite, repo)
+}
+
+// Read reads the Release file at u, ErrNotFound if it does not exist. It
+// must be of the suite of the directory it is in.
+func (c *Client) Read(ctx context.Context, u string) (*Release, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxRelease))
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := ParseRelease(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", u, err)
+	}
+	if err := rel.CheckSuite(path.Base(path.Dir(pu.Path))); err != nil {
+		return nil, fmt.Errorf("%v: %v", u, err)
+	}
+	return rel, nil
+}
+
+// ReleaseSums returns the sums of the suite the file at durl is of, read
+// from the first of its ReleaseFiles that exists, and the URL of that file.
+// ok is false if durl is not the URL of a file of an APT repository suite.
+func (c *Client) ReleaseSums(ctx context.Context, durl string) (sums rgethash.URLSumList, sumsURL string, ok bool, err error) {
+	if _, err := rgetwellknown.AptMatches(durl); err != nil {
+		return nil, "", false, nil
+	}
+	prefix, err := rgetwellknown.SumPrefix(durl)
+	if err != nil {
+		return nil, "", true, err
+	}
+	for _, name := range ReleaseFiles {
+		rel, err := c.Read(ctx, prefix+name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, prefix + name, true, err
+		}
+		return rel.Sums(), prefix + name, true, nil
+	}
+	return nil, "", true, fmt.Errorf("no Release file found in %v", prefix)
+}
+
+// ParseSums parses data, read from loc, if loc is a Release file.
+func (c *Client) ParseSums(loc string, data []byte) (sums rgethash.URLSumList, ok bool, err error) {
+	if !IsReleaseFile(path.Base(loc)) {
+		return nil, false, nil
+	}
+	rel, err := ParseRelease(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("%v: %v", loc, err)
+	}
+	return rel.Sums(), true, nil
+}
+
+// Hash downloads the file at u and returns its SHA-256, ErrNotFound if it
+// does not exist.
+func (c *Client) Hash(ctx context.Context, u string) ([]byte, error) {
+	body, err := c.open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return rgethash.SHA256.Digest(body)
+}
@@ -0,0 +1,161 @@
+package rgetapt
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.merklecounty.com/rget/internal/testutil"
+)
+
+// testIndices are the contents of the indices of the test suite.
+var testIndices = map[string]string{
+	"main/binary-amd64/Packages":    "Package: rget\nVersion: 0.0.6\n",
+	"main/binary-amd64/Packages.gz": "compressed",
+	"main/binary-amd64/Release":     "Archive: stable\n",
+	"main/i18n/Translation-en":      "Package: rget\n",
+}
+
+// testRelease returns a Release file of the suite and codename listing
+// testIndices.
+func testRelease(suite, codename string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Origin: Example\nSuite: %s\nCodename: %s\nMD5Sum:\n 0123 4 main/binary-amd64/Packages\nSHA256:\n", suite, codename)
+	for _, p := range []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.gz", "main/binary-amd64/Packages.xz", "main/binary-amd64/Release", "main/i18n/Translation-en"} {
+		// Packages.xz is listed but not served
+		contents, ok := testIndices[p]
+		if !ok {
+			contents = "missing"
+		}
+		fmt.Fprintf(&b, " %x %d %s\n", sha256.Sum256([]byte(contents)), len(contents), p)
+	}
+	return b.String()
+}
+
+// clearSign wraps text as an OpenPGP cleartext signed message, with a
+// signature that is not checked.
+func clearSign(text string) string {
+	var b strings.Builder
+	b.WriteString("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA512\n\n")
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "-") {
+			b.WriteString("- ")
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("-----BEGIN PGP SIGNATURE-----\n\niQIzBAEBCgAdFiEE\n-----END PGP SIGNATURE-----\n")
+	return b.String()
+}
+
+func TestParseRelease(t *testing.T) {
+	release := testRelease("stable", "bookworm")
+
+	for ti, tt := range []struct {
+		data    string
+		files   int
+		wantErr bool
+	}{
+		{release, 5, false},
+		{clearSign(release), 5, false},
+		{strings.Replace(release, "\n", "\r\n", -1), 5, false},
+		{release + "\nSHA256:\n 00 1 other\n", 5, false},
+		{"Suite: stable\nMD5Sum:\n 0123 4 Packages\n", 0, true},
+		{"Origin: Example\nSHA256:\n" + strings.SplitN(release, "SHA256:\n", 2)[1], 0, true},
+		{"Suite: stable\nSHA256:\n 0123 4 Packages\n", 0, true},
+		{strings.Replace(release, "main/binary-amd64/Packages.gz", "../Packages.gz", 1), 0, true},
+		{strings.Replace(release, "main/i18n/Translation-en", "/etc/passwd", 1), 0, true},
+		{" continuation\nSuite: stable\n", 0, true},
+		{strings.TrimSuffix(clearSign(release), "-----BEGIN PGP SIGNATURE-----\n\niQIzBAEBCgAdFiEE\n-----END PGP SIGNATURE-----\n"), 0, true},
+	} {
+		rel, err := ParseRelease([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if rel.Suite != "stable" || rel.Codename != "bookworm" || len(rel.Files) != tt.files {
+			t.Errorf("%d: suite %q codename %q %d files", ti, rel.Suite, rel.Codename, len(rel.Files))
+		}
+		sums := rel.Sums()
+		if sums[0].URL != "main/binary-amd64/Packages" || len(sums) != len(rel.Files) {
+			t.Errorf("%d: sums %v", ti, sums)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/debian/dists/")
+		switch {
+		case p == "bookworm/InRelease":
+			w.Write([]byte(clearSign(testRelease("stable", "bookworm"))))
+		case p == "trixie/Release":
+			// Only a Release file
+			w.Write([]byte(testRelease("testing", "trixie")))
+		case p == "sid/InRelease":
+			// The Release file of another suite
+			w.Write([]byte(testRelease("stable", "bookworm")))
+		case strings.HasPrefix(p, "bookworm/") && testIndices[strings.TrimPrefix(p, "bookworm/")] != "":
+			w.Write([]byte(testIndices[strings.TrimPrefix(p, "bookworm/")]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Send requests for every site to the test server
+	c := &Client{HTTPClient: testutil.RedirectClient(ts.URL)}
+	ctx := context.Background()
+	const repo = "https://deb.example.com/debian"
+
+	for ti, tt := range []struct {
+		suite   string
+		url     string
+		wantErr bool
+	}{
+		{"bookworm", repo + "/dists/bookworm/InRelease", false},
+		{"trixie", repo + "/dists/trixie/Release", false},
+		{"sid", "", true},
+		{"experimental", "", true},
+	} {
+		_, u, err := c.Fetch(ctx, repo, tt.suite)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+			continue
+		}
+		if err == nil && u != tt.url {
+			t.Errorf("%d: read %v want %v", ti, u, tt.url)
+		}
+	}
+
+	rel, _, err := c.Fetch(ctx, repo, "bookworm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indices []string
+	for _, f := range rel.PackagesIndices() {
+		indices = append(indices, f.Path)
+
+		sum, err := c.Hash(ctx, DistURL(repo, "bookworm")+f.Path)
+		if f.Path == "main/binary-amd64/Packages.xz" {
+			if err != ErrNotFound {
+				t.Errorf("%v: %v", f.Path, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(sum, f.SHA256) {
+			t.Errorf("%v: %x want %x: %v", f.Path, sum, f.SHA256, err)
+		}
+	}
+	want := []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.gz", "main/binary-amd64/Packages.xz"}
+	if !reflect.DeepEqual(indices, want) {
+		t.Errorf("Packages indices %v want %v", indices, want)
+	}
+}
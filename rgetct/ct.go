@@ -22,21 +22,88 @@ import (
 
 type logInfoFactory func(*loglist.Log, *http.Client) (*ctutil.LogInfo, error)
 
+// Channels an SCT can be delivered through.
+const (
+	ChannelEmbedded = "embedded" // X.509 extension of the certificate
+	ChannelTLS      = "tls"      // TLS signed_certificate_timestamp extension
+	ChannelOCSP     = "ocsp"     // extension of a stapled OCSP response
+)
+
+// SCTResult is the outcome of checking a single SCT.
+type SCTResult struct {
+	Subject   string       // which SCT was checked, e.g. "embedded SCT[0]"
+	Channel   string       // how the SCT was delivered
+	LogID     [32]byte     // ID of the log that issued the SCT
+	Log       *loglist.Log // log that issued the SCT, nil if unknown
+	Timestamp time.Time    // time the log promised to include the certificate
+	Valid     bool         // whether the signature and inclusion checked out
+	Err       error        // reason the SCT is not valid
+
+	// Signature and Inclusion are the outcomes of checking the SCT
+	// signature and the log's inclusion proof, "" if not checked.
+	Signature string
+	Inclusion string
+}
+
+// Outcomes of the individual checks of an SCT.
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "failed"
+	CheckPending = "pending" // inclusion not yet required by the log's MMD
+	CheckSkipped = "skipped" // the log serves no inclusion proofs by hash
+)
+
+// CountSCTs returns the number of valid and invalid SCTs in results.
+func CountSCTs(results []SCTResult) (valid int, invalid int) {
+	for _, r := range results {
+		if r.Valid {
+			valid++
+		} else {
+			invalid++
+		}
+	}
+	return
+}
+
+// DedupeSCTs keeps one result per log so SCTs for the same certificate
+// delivered through several channels are only counted once. A valid result is
+// preferred over an invalid one; otherwise the first result for a log wins.
+func DedupeSCTs(results []SCTResult) []SCTResult {
+	var deduped []SCTResult
+	seen := map[[32]byte]int{}
+	for _, r := range results {
+		if r.Log == nil {
+			deduped = append(deduped, r)
+			continue
+		}
+		i, ok := seen[r.LogID]
+		if !ok {
+			seen[r.LogID] = len(deduped)
+			deduped = append(deduped, r)
+			continue
+		}
+		if r.Valid && !deduped[i].Valid {
+			deduped[i] = r
+		}
+	}
+	return deduped
+}
+
 // CheckX509 iterates over any X509 extension SCTs in the leaf certificate of the chain
-// and checks those SCTs.  Returns the counts of valid and invalid embedded SCTs found.
-func CheckX509(ctx context.Context, lf logInfoFactory, chain []*x509.Certificate, ll *loglist.LogList, hc *http.Client) (valid int, invalid int, logs []loglist.Log) {
+// and checks those SCTs.  Returns the result of checking each embedded SCT found.
+func CheckX509(ctx context.Context, lf logInfoFactory, chain []*x509.Certificate, ll *loglist.LogList, hc *http.Client) (results []SCTResult) {
 	leaf := chain[0]
 	if len(leaf.SCTList.SCTList) == 0 {
 		return
 	}
 
 	var issuer *x509.Certificate
+	var err error
 	if len(chain) < 2 {
 		glog.Info("No issuer in chain; attempting online retrieval")
-		var err error
 		issuer, err = x509util.GetIssuer(leaf, hc)
-		if err != nil {
-			fmt.Printf("Failed to get issuer online: %v\n", err)
+		if err == nil && issuer == nil {
+			err = errors.New("no issuer certificate")
 		}
 	} else {
 		issuer = chain[1]
@@ -44,29 +111,35 @@ func CheckX509(ctx context.Context, lf logInfoFactory, chain []*x509.Certificate
 
 	// Build a Merkle leaf that corresponds to the embedded SCTs.  We can use the same
 	// leaf for all of the SCTs, as long as the timestamp field gets updated.
-	merkleLeaf, err := ct.MerkleTreeLeafForEmbeddedSCT([]*x509.Certificate{leaf, issuer}, 0)
+	var merkleLeaf *ct.MerkleTreeLeaf
+	if err == nil {
+		merkleLeaf, err = ct.MerkleTreeLeafForEmbeddedSCT([]*x509.Certificate{leaf, issuer}, 0)
+	}
 	if err != nil {
-		fmt.Printf("Failed to build Merkle leaf: %v\n", err)
-		invalid = len(leaf.SCTList.SCTList)
+		glog.Infof("Failed to build Merkle leaf: %v", err)
+		for i := range leaf.SCTList.SCTList {
+			results = append(results, SCTResult{
+				Subject: fmt.Sprintf("embedded SCT[%d]", i),
+				Channel: ChannelEmbedded,
+				Err:     fmt.Errorf("failed to build Merkle leaf: %v", err),
+			})
+		}
 		return
 	}
 
 	for i, sctData := range leaf.SCTList.SCTList {
 		subject := fmt.Sprintf("embedded SCT[%d]", i)
-		ok, log := checkSCT(ctx, lf, subject, merkleLeaf, &sctData, ll, hc)
-		logs = append(logs, *log)
-		if ok {
-			valid++
-		} else {
-			invalid++
-		}
+		results = append(results, checkSCT(ctx, lf, subject, ChannelEmbedded, merkleLeaf, &sctData, ll, hc))
 	}
 	return
 }
 
-// GetSiteSCTs retrieves and returns the x509 chain and TLS SCTs presented
-// for an HTTPS site.
-func GetSiteSCTs(ctx context.Context, target string, hc *http.Client) (chain []*x509.Certificate, tlsSCTs [][]byte, err error) {
+// GetSiteSCTs retrieves and returns the x509 chain, TLS SCTs and stapled
+// OCSP SCTs presented for an HTTPS site. Only the hostname of the chain is
+// checked; callers must validate the chain with VerifyChain before trusting
+// it. A stapled OCSP response that cannot be read is returned as ocspErr
+// rather than err so the other SCTs can still be checked.
+func GetSiteSCTs(ctx context.Context, target string, hc *http.Client) (chain []*x509.Certificate, tlsSCTs [][]byte, ocspSCTs [][]byte, ocspErr error, err error) {
 	u, err := url.Parse(target)
 	if err != nil {
 		err = fmt.Errorf("failed to parse URL: %v", err)
@@ -117,31 +190,52 @@ func GetSiteSCTs(ctx context.Context, target string, hc *http.Client) (chain []*
 	// Check externally-provided SCTs.
 	tlsSCTs = conn.ConnectionState().SignedCertificateTimestamps
 
+	ocspSCTs, ocspErr = OCSPSCTs(conn.ConnectionState().OCSPResponse, chain[0])
+	if ocspErr != nil {
+		ocspErr = fmt.Errorf("stapled OCSP response: %v", ocspErr)
+	}
+
 	return
 }
 
 // CheckTLS iterates over any TLS extension SCTs presented from a connection
-// and checks those SCTs.  Returns the counts of valid and invalid
-// SCTs found.
-func CheckTLS(ctx context.Context, scts [][]byte, chain []*x509.Certificate, lf logInfoFactory, target string, ll *loglist.LogList, hc *http.Client) (valid int, invalid int, logs []loglist.Log) {
+// and checks those SCTs.  Returns the result of checking each SCT.
+func CheckTLS(ctx context.Context, scts [][]byte, chain []*x509.Certificate, lf logInfoFactory, target string, ll *loglist.LogList, hc *http.Client) (results []SCTResult) {
+	return checkExternal(ctx, ChannelTLS, "external SCT[%d]", scts, chain, lf, ll, hc)
+}
+
+// CheckOCSP iterates over any SCTs from a stapled OCSP response and checks
+// those SCTs.  Returns the result of checking each SCT.
+func CheckOCSP(ctx context.Context, scts [][]byte, chain []*x509.Certificate, lf logInfoFactory, ll *loglist.LogList, hc *http.Client) (results []SCTResult) {
+	return checkExternal(ctx, ChannelOCSP, "OCSP SCT[%d]", scts, chain, lf, ll, hc)
+}
+
+// OCSPFailure is the result for a stapled OCSP response whose SCTs could
+// not be read, see GetSiteSCTs.
+func OCSPFailure(err error) SCTResult {
+	return SCTResult{Subject: "OCSP response", Channel: ChannelOCSP, Err: err}
+}
+
+// checkExternal checks SCTs delivered outside of the certificate. These
+// cover the final certificate rather than the precertificate.
+func checkExternal(ctx context.Context, channel, subjectFmt string, scts [][]byte, chain []*x509.Certificate, lf logInfoFactory, ll *loglist.LogList, hc *http.Client) (results []SCTResult) {
 	if len(scts) > 0 {
 		var merkleLeaf *ct.MerkleTreeLeaf
 		merkleLeaf, err := ct.MerkleTreeLeafFromChain(chain, ct.X509LogEntryType, 0 /* timestamp added later */)
 		if err != nil {
-			fmt.Printf("Failed to build Merkle tree leaf: %v\n", err)
-			invalid = len(scts)
+			glog.Infof("Failed to build Merkle tree leaf: %v", err)
+			for i := range scts {
+				results = append(results, SCTResult{
+					Subject: fmt.Sprintf(subjectFmt, i),
+					Channel: channel,
+					Err:     fmt.Errorf("failed to build Merkle leaf: %v", err),
+				})
+			}
 			return
 		}
 		for i, sctData := range scts {
-			subject := fmt.Sprintf("external SCT[%d]", i)
-			ok, log := checkSCT(ctx, lf, subject, merkleLeaf, &x509.SerializedSCT{Val: sctData}, ll, hc)
-			logs = append(logs, *log)
-			if ok {
-				valid++
-			} else {
-				invalid++
-			}
-
+			subject := fmt.Sprintf(subjectFmt, i)
+			results = append(results, checkSCT(ctx, lf, subject, channel, merkleLeaf, &x509.SerializedSCT{Val: sctData}, ll, hc))
 		}
 	}
 
@@ -151,47 +245,71 @@ func CheckTLS(ctx context.Context, scts [][]byte, chain []*x509.Certificate, lf
 // checkSCT performs checks on an SCT and Merkle tree leaf, performing both
 // signature validation and online log inclusion checking.  Returns whether
 // the SCT is valid.
-func checkSCT(ctx context.Context, liFactory logInfoFactory, subject string, merkleLeaf *ct.MerkleTreeLeaf, sctData *x509.SerializedSCT, ll *loglist.LogList, hc *http.Client) (result bool, log *loglist.Log) {
+func checkSCT(ctx context.Context, liFactory logInfoFactory, subject, channel string, merkleLeaf *ct.MerkleTreeLeaf, sctData *x509.SerializedSCT, ll *loglist.LogList, hc *http.Client) (result SCTResult) {
+	result.Subject = subject
+	result.Channel = channel
+
 	sct, err := x509util.ExtractSCT(sctData)
 	if err != nil {
-		fmt.Printf("Failed to deserialize %s data: %v\n", subject, err)
-		fmt.Printf("Data: %x\n", sctData.Val)
+		glog.Infof("Failed to deserialize %s data: %v", subject, err)
+		glog.Infof("Data: %x", sctData.Val)
+		result.Err = fmt.Errorf("failed to deserialize: %v", err)
 		return
 	}
+	result.LogID = sct.LogID.KeyID
+	result.Timestamp = ct.TimestampToTime(sct.Timestamp)
 
 	// TODO(philips): add verbose logging
 	// fmt.Printf("Examine %s with timestamp: %d (%v) from logID: %x\n", subject, sct.Timestamp, ct.TimestampToTime(sct.Timestamp), sct.LogID.KeyID[:])
-	log = ll.FindLogByKeyHash(sct.LogID.KeyID)
+	log := ll.FindLogByKeyHash(sct.LogID.KeyID)
 	if log == nil {
-		fmt.Printf("Unknown logID: %x, cannot validate %s\n", sct.LogID, subject)
+		glog.Infof("Unknown logID: %x, cannot validate %s", sct.LogID, subject)
+		result.Err = fmt.Errorf("unknown log %x", sct.LogID.KeyID)
 		return
 	}
+	result.Log = log
 	logInfo, err := liFactory(log, hc)
 	if err != nil {
-		fmt.Printf("Failed to build log info for %q log: %v\n", log.Description, err)
+		glog.Infof("Failed to build log info for %q log: %v", log.Description, err)
+		result.Err = err
 		return
 	}
 
-	result = true
+	result.Valid = true
+	result.Signature = CheckOK
 	if err := logInfo.VerifySCTSignature(*sct, *merkleLeaf); err != nil {
-		fmt.Printf("Failed to verify %s signature from log %q: %v\n", subject, log.Description, err)
-		result = false
+		glog.Infof("Failed to verify %s signature from log %q: %v", subject, log.Description, err)
+		result.Valid = false
+		result.Err = err
+		result.Signature = CheckFailed
+	}
+
+	// Tiled logs are listed without a URL, inclusion in them cannot be
+	// looked up by hash
+	if log.URL == "" {
+		result.Inclusion = CheckSkipped
+		return
 	}
 
 	_, err = logInfo.VerifyInclusion(ctx, *merkleLeaf, sct.Timestamp)
 	if err != nil {
 		age := time.Since(ct.TimestampToTime(sct.Timestamp))
 		if age < logInfo.MMD {
-			fmt.Printf("Failed to verify inclusion proof (%v) but %s timestamp is only %v old, less than log's MMD of %d seconds\n", err, subject, age, log.MaximumMergeDelay)
+			glog.Warningf("Failed to verify inclusion proof (%v) but %s timestamp is only %v old, less than log's MMD of %d seconds", err, subject, age, log.MaximumMergeDelay)
 			// TODO(philips): fix this case.
-			result = true
+			result.Inclusion = CheckPending
 			return
 		} else {
-			fmt.Printf("Failed to verify inclusion proof for %s: %v\n", subject, err)
+			glog.Infof("Failed to verify inclusion proof for %s: %v", subject, err)
+		}
+		result.Valid = false
+		result.Inclusion = CheckFailed
+		if result.Err == nil {
+			result.Err = err
 		}
-		result = false
 		return
 	}
+	result.Inclusion = CheckOK
 
 	return
 }
@@ -0,0 +1,202 @@
+package rgetct
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/ctutil"
+	"github.com/google/certificate-transparency-go/loglist"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// LogEvidence is what a CT log returned while SCTs were checked against it:
+// a signed tree head and inclusion proofs relative to it. It lets the SCTs be
+// checked again later without contacting the log.
+type LogEvidence struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Key         []byte `json:"key"` // DER public key of the log
+
+	STH    *ct.SignedTreeHead `json:"sth"`
+	Proofs []InclusionProof   `json:"proofs"`
+}
+
+// InclusionProof is an RFC 6962 audit path for the leaf with LeafHash in a
+// tree of TreeSize entries.
+type InclusionProof struct {
+	LeafHash  []byte   `json:"leaf_hash"`
+	TreeSize  uint64   `json:"tree_size"`
+	LeafIndex int64    `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// EvidenceRecorder keeps the tree heads and inclusion proofs fetched by the
+// log clients it creates. Pass its LogInfo method to CheckX509, CheckTLS or
+// CheckOCSP in place of ctutil.NewLogInfo.
+type EvidenceRecorder struct {
+	// Factory creates the log clients, ctutil.NewLogInfo if nil.
+	Factory logInfoFactory
+
+	mu   sync.Mutex
+	logs map[[sha256.Size]byte]*LogEvidence
+}
+
+// LogInfo creates a LogInfo for log whose responses are recorded.
+func (r *EvidenceRecorder) LogInfo(log *loglist.Log, hc *http.Client) (*ctutil.LogInfo, error) {
+	factory := r.Factory
+	if factory == nil {
+		factory = ctutil.NewLogInfo
+	}
+	li, err := factory(log, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logs == nil {
+		r.logs = make(map[[sha256.Size]byte]*LogEvidence)
+	}
+	id := sha256.Sum256(log.Key)
+	ev, ok := r.logs[id]
+	if !ok {
+		ev = &LogEvidence{Description: log.Description, URL: log.URL, Key: log.Key}
+		r.logs[id] = ev
+	}
+
+	li.Client = &recordingClient{CheckLogClient: li.Client, r: r, ev: ev}
+	return li, nil
+}
+
+// Evidence returns the evidence recorded so far, ordered by log description.
+func (r *EvidenceRecorder) Evidence() []LogEvidence {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var evidence []LogEvidence
+	for _, ev := range r.logs {
+		if ev.STH != nil {
+			evidence = append(evidence, *ev)
+		}
+	}
+	sort.Slice(evidence, func(i, j int) bool {
+		return evidence[i].Description < evidence[j].Description
+	})
+	return evidence
+}
+
+// recordingClient answers every GetSTH with the first tree head it fetched
+// so all proofs for a log are relative to the same tree.
+type recordingClient struct {
+	client.CheckLogClient
+	r  *EvidenceRecorder
+	ev *LogEvidence
+}
+
+func (c *recordingClient) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	c.r.mu.Lock()
+	sth := c.ev.STH
+	c.r.mu.Unlock()
+	if sth != nil {
+		return sth, nil
+	}
+
+	sth, err := c.CheckLogClient.GetSTH(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	if c.ev.STH == nil {
+		c.ev.STH = sth
+	}
+	return c.ev.STH, nil
+}
+
+func (c *recordingClient) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	rsp, err := c.CheckLogClient.GetProofByHash(ctx, hash, treeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.ev.Proofs = append(c.ev.Proofs, InclusionProof{
+		LeafHash:  hash,
+		TreeSize:  treeSize,
+		LeafIndex: rsp.LeafIndex,
+		AuditPath: rsp.AuditPath,
+	})
+	return rsp, nil
+}
+
+// ErrNoEvidence is returned by the log clients of OfflineLogInfo for
+// anything the evidence does not cover.
+var ErrNoEvidence = errors.New("not covered by the recorded evidence")
+
+// OfflineLogInfo returns a factory, to use in place of ctutil.NewLogInfo,
+// for log clients that answer from evidence without contacting the logs. The
+// keys of the logs come from the log list being checked against, never from
+// the evidence, and tree heads must carry a valid signature from that key.
+func OfflineLogInfo(evidence []LogEvidence) func(*loglist.Log, *http.Client) (*ctutil.LogInfo, error) {
+	return func(log *loglist.Log, _ *http.Client) (*ctutil.LogInfo, error) {
+		li, err := ctutil.NewLogInfo(log, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		oc := &offlineClient{uri: log.URL, verifier: li.Verifier}
+		for i := range evidence {
+			if bytes.Equal(evidence[i].Key, log.Key) {
+				oc.ev = &evidence[i]
+				break
+			}
+		}
+		li.Client = oc
+		return li, nil
+	}
+}
+
+type offlineClient struct {
+	uri      string
+	verifier *ct.SignatureVerifier
+	ev       *LogEvidence
+}
+
+func (c *offlineClient) BaseURI() string {
+	return c.uri
+}
+
+func (c *offlineClient) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	if c.ev == nil || c.ev.STH == nil {
+		return nil, fmt.Errorf("tree head: %v", ErrNoEvidence)
+	}
+	if err := c.verifier.VerifySTHSignature(*c.ev.STH); err != nil {
+		return nil, fmt.Errorf("tree head: %v", err)
+	}
+	return c.ev.STH, nil
+}
+
+func (c *offlineClient) GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error) {
+	return nil, fmt.Errorf("consistency proof: %v", ErrNoEvidence)
+}
+
+func (c *offlineClient) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	if c.ev != nil {
+		for _, p := range c.ev.Proofs {
+			if p.TreeSize == treeSize && bytes.Equal(p.LeafHash, hash) {
+				return &ct.GetProofByHashResponse{LeafIndex: p.LeafIndex, AuditPath: p.AuditPath}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("inclusion proof for %x: %v", hash, ErrNoEvidence)
+}
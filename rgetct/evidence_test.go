@@ -0,0 +1,201 @@
+package rgetct
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/ctutil"
+	"github.com/google/certificate-transparency-go/loglist"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+	"github.com/google/trillian/merkle/rfc6962"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// testLog is a CT log holding a single certificate and one other entry.
+type testLog struct {
+	client.CheckLogClient
+	sth   *ct.SignedTreeHead
+	proof *ct.GetProofByHashResponse
+	calls int
+}
+
+func (l *testLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	l.calls++
+	return l.sth, nil
+}
+
+func (l *testLog) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	l.calls++
+	return l.proof, nil
+}
+
+// newTestLog logs chain[0] and returns the log, its list entry and the TLS
+// encoded SCT it issued.
+func newTestLog(t *testing.T, chain []*x509.Certificate) (*testLog, *loglist.Log, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &loglist.Log{Description: "Test log", Key: der, URL: "log.example.com/", MaximumMergeDelay: 86400}
+
+	leaf, err := ct.MerkleTreeLeafFromChain(chain, ct.X509LogEntryType, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      ct.LogID{KeyID: sha256.Sum256(der)},
+		Timestamp:  uint64(time.Now().Add(-48*time.Hour).UnixNano() / int64(time.Millisecond)),
+	}
+	leaf.TimestampedEntry.Timestamp = sct.Timestamp
+	input, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{Leaf: *leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := tls.CreateSignature(*key, tls.SHA256, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.Signature = ct.DigitallySigned(sig)
+	sctData, err := tls.Marshal(sct)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafHash, err := ct.LeafHashForLeaf(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := rfc6962.DefaultHasher.HashLeaf([]byte("other entry"))
+	sth := &ct.SignedTreeHead{
+		Version:   ct.V1,
+		TreeSize:  2,
+		Timestamp: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	copy(sth.SHA256RootHash[:], rfc6962.DefaultHasher.HashChildren(leafHash[:], other))
+	input, err = ct.SerializeSTHSignatureInput(*sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err = tls.CreateSignature(*key, tls.SHA256, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sth.TreeHeadSignature = ct.DigitallySigned(sig)
+
+	return &testLog{
+		sth:   sth,
+		proof: &ct.GetProofByHashResponse{LeafIndex: 0, AuditPath: [][]byte{other}},
+	}, log, sctData
+}
+
+func TestEvidence(t *testing.T) {
+	cert, _ := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "a.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, nil, nil)
+	chain := []*x509.Certificate{cert}
+
+	tl, log, sct := newTestLog(t, chain)
+	ll := &loglist.LogList{Logs: []loglist.Log{*log}}
+	ctx := context.Background()
+
+	rec := &EvidenceRecorder{Factory: func(log *loglist.Log, hc *http.Client) (*ctutil.LogInfo, error) {
+		li, err := ctutil.NewLogInfo(log, hc)
+		if err != nil {
+			return nil, err
+		}
+		li.Client = tl
+		return li, nil
+	}}
+	results := CheckTLS(ctx, [][]byte{sct, sct}, chain, rec.LogInfo, "", ll, nil)
+	if v, i := CountSCTs(results); v != 2 || i != 0 {
+		t.Fatalf("online check: %d valid %d invalid: %+v", v, i, results)
+	}
+
+	// Round trip the evidence as it would be stored
+	data, err := json.Marshal(rec.Evidence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evidence []LogEvidence
+	if err := json.Unmarshal(data, &evidence); err != nil {
+		t.Fatal(err)
+	}
+	if len(evidence) != 1 || len(evidence[0].Proofs) != 2 {
+		t.Fatalf("unexpected evidence %s", data)
+	}
+
+	tampered := make([]LogEvidence, 1)
+	tampered[0] = evidence[0]
+	sth := *evidence[0].STH
+	sth.TreeSize++
+	tampered[0].STH = &sth
+
+	calls := tl.calls
+	for ti, tt := range []struct {
+		evidence []LogEvidence
+		valid    bool
+	}{
+		{evidence, true},
+		{tampered, false},
+		{nil, false},
+	} {
+		results := CheckTLS(ctx, [][]byte{sct}, chain, OfflineLogInfo(tt.evidence), "", ll, nil)
+		if len(results) != 1 || results[0].Valid != tt.valid {
+			t.Errorf("%d: want valid %v got %+v", ti, tt.valid, results)
+		}
+	}
+	if tl.calls != calls {
+		t.Errorf("offline checks contacted the log")
+	}
+}
+
+func TestTiledLogSCT(t *testing.T) {
+	cert, _ := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "a.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, nil, nil)
+	chain := []*x509.Certificate{cert}
+
+	// Tiled logs are listed without a URL
+	tl, log, sct := newTestLog(t, chain)
+	log.URL = ""
+	ll := &loglist.LogList{Logs: []loglist.Log{*log}}
+
+	lf := func(log *loglist.Log, hc *http.Client) (*ctutil.LogInfo, error) {
+		li, err := ctutil.NewLogInfo(log, hc)
+		if err != nil {
+			return nil, err
+		}
+		li.Client = tl
+		return li, nil
+	}
+	results := CheckTLS(context.Background(), [][]byte{sct}, chain, lf, "", ll, nil)
+	if len(results) != 1 || !results[0].Valid || results[0].Signature != CheckOK || results[0].Inclusion != CheckSkipped {
+		t.Fatalf("tiled log SCT: %+v", results)
+	}
+	if tl.calls != 0 {
+		t.Errorf("%d calls to a tiled log", tl.calls)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build ignore
+// +build ignore
+
+// gen_roots.go generates roots_bundled.go from a PEM bundle of the roots
+// included in the Mozilla store of the CCADB. Run it with:
+//
+//	go run gen_roots.go [-src URL or file]
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ccadbURL = "https://ccadb-public.secure.force.com/mozilla/IncludedRootsPEMTxt?TrustBitsInclude=Websites"
+
+func main() {
+	src := flag.String("src", ccadbURL, "URL or file of the PEM bundle")
+	out := flag.String("out", "roots_bundled.go", "output file")
+	flag.Parse()
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(*src, "https://") {
+		var resp *http.Response
+		resp, err = http.Get(*src)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err = ioutil.ReadAll(resp.Body)
+	} else {
+		data, err = ioutil.ReadFile(*src)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Normalize the bundle so only the certificate blocks end up in the
+	// generated source.
+	var certs bytes.Buffer
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		pem.Encode(&certs, &pem.Block{Type: block.Type, Bytes: block.Bytes})
+		n++
+	}
+	if n == 0 {
+		log.Fatalf("no certificates found in %v", *src)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gen_roots.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package rgetct\n\n")
+	fmt.Fprintf(&buf, "// bundledRootsPEM are the %d roots of the Mozilla store as of %v.\n", n, time.Now().UTC().Format("2006-01-02"))
+	fmt.Fprintf(&buf, "const bundledRootsPEM = `%s`\n", certs.String())
+
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
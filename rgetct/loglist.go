@@ -0,0 +1,289 @@
+package rgetct
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/certificate-transparency-go/loglist"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+//go:generate go run gen_loglist.go
+
+const (
+	// LogListURL is the URL of Google Chrome's v3 log list.
+	LogListURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+	// LogListSignatureURL is the URL of the signature over LogListURL.
+	LogListSignatureURL = "https://www.gstatic.com/ct/log_list/v3/log_list.sig"
+
+	// LogListFile and LogListSignatureFile are the names a verified copy
+	// of the log list is cached under.
+	LogListFile          = "log_list.json"
+	LogListSignatureFile = "log_list.sig"
+)
+
+// LogListPubKeyPEM is the key Google signs the Chrome log list with.
+const LogListPubKeyPEM = `-----BEGIN PUBLIC KEY-----
+MIICIjANBgkqhkiG9w0BAQEFAAOCAg8AMIICCgKCAgEAsu0BHGnQ++W2CTdyZyxv
+HHRALOZPlnu/VMVgo2m+JZ8MNbAOH2cgXb8mvOj8flsX/qPMuKIaauO+PwROMjiq
+fUpcFm80Kl7i97ZQyBDYKm3MkEYYpGN+skAR2OebX9G2DfDqFY8+jUpOOWtBNr3L
+rmVcwx+FcFdMjGDlrZ5JRmoJ/SeGKiORkbbu9eY1Wd0uVhz/xI5bQb0OgII7hEj+
+i/IPbJqOHgB8xQ5zWAJJ0DmG+FM6o7gk403v6W3S8qRYiR84c50KppGwe4YqSMkF
+bLDleGQWLoaDSpEWtESisb4JiLaY4H+Kk0EyAhPSb+49JfUozYl+lf7iFN3qRq/S
+IXXTh6z0S7Qa8EYDhKGCrpI03/+qprwy+my6fpWHi6aUIk4holUCmWvFxZDfixox
+K0RlqbFDl2JXMBquwlQpm8u5wrsic1ksIv9z8x9zh4PJqNpCah0ciemI3YGRQqSe
+/mRRXBiSn9YQBUPcaeqCYan+snGADFwHuXCd9xIAdFBolw9R9HTedHGUfVXPJDiF
+4VusfX6BRR/qaadB+bqEArF/TzuDUr6FvOR4o8lUUxgLuZ/7HO+bHnaPFKYHHSm+
++z1lVDhhYuSZ8ax3T0C3FZpb7HMjZtpEorSV5ElKJEJwrhrBCMOD8L01EoSPrGlS
+1w22i9uGHMn/uGQKo28u7AsCAwEAAQ==
+-----END PUBLIC KEY-----`
+
+// ErrNoEmbeddedLogList is returned when rget was built without running
+// go generate to embed a log list.
+var ErrNoEmbeddedLogList = errors.New("no log list embedded in this build")
+
+// Log states as published in the v2 and v3 log list schemas.
+const (
+	LogStatePending   = "pending"
+	LogStateQualified = "qualified"
+	LogStateUsable    = "usable"
+	LogStateReadOnly  = "readonly"
+	LogStateRetired   = "retired"
+	LogStateRejected  = "rejected"
+)
+
+// LogList is a CT log list converted to the loglist.LogList used by the
+// certificate-transparency-go verification code. The state of each log is
+// kept alongside as the older schema has no room for it.
+type LogList struct {
+	loglist.LogList
+
+	// Version and Timestamp identify the published list
+	Version   string
+	Timestamp time.Time
+
+	states map[[sha256.Size]byte]string
+}
+
+// State returns the state the log list gives for log, or "" if the list
+// does not say.
+func (ll *LogList) State(log *loglist.Log) string {
+	if ll == nil {
+		return ""
+	}
+	return ll.states[sha256.Sum256(log.Key)]
+}
+
+// Manually mapped from https://www.gstatic.com/ct/log_list/v3/log_list_schema.json
+// keeping only the fields rget needs. The v2 schema is a subset.
+type logListV3 struct {
+	Version          string       `json:"version"`
+	LogListTimestamp time.Time    `json:"log_list_timestamp"`
+	Operators        []operatorV3 `json:"operators"`
+}
+
+type operatorV3 struct {
+	Name      string  `json:"name"`
+	Logs      []logV3 `json:"logs"`
+	TiledLogs []logV3 `json:"tiled_logs"`
+}
+
+// logV3 is an RFC 6962 log or a tiled, static CT API, log. Tiled logs have
+// a submission and monitoring URL instead of a URL.
+type logV3 struct {
+	Description   string       `json:"description"`
+	LogID         []byte       `json:"log_id"`
+	Key           []byte       `json:"key"`
+	URL           string       `json:"url"`
+	SubmissionURL string       `json:"submission_url"`
+	MonitoringURL string       `json:"monitoring_url"`
+	DNS           string       `json:"dns"`
+	MMD           int          `json:"mmd"`
+	State         *logStatesV3 `json:"state"`
+}
+
+type logStateV3 struct {
+	Timestamp     time.Time `json:"timestamp"`
+	FinalTreeHead *struct {
+		SHA256RootHash []byte `json:"sha256_root_hash"`
+		TreeSize       int    `json:"tree_size"`
+	} `json:"final_tree_head"`
+}
+
+type logStatesV3 struct {
+	Pending   *logStateV3 `json:"pending"`
+	Qualified *logStateV3 `json:"qualified"`
+	Usable    *logStateV3 `json:"usable"`
+	ReadOnly  *logStateV3 `json:"readonly"`
+	Retired   *logStateV3 `json:"retired"`
+	Rejected  *logStateV3 `json:"rejected"`
+}
+
+func (s *logStatesV3) active() (string, *logStateV3) {
+	switch {
+	case s == nil:
+		return "", nil
+	case s.Pending != nil:
+		return LogStatePending, s.Pending
+	case s.Qualified != nil:
+		return LogStateQualified, s.Qualified
+	case s.Usable != nil:
+		return LogStateUsable, s.Usable
+	case s.ReadOnly != nil:
+		return LogStateReadOnly, s.ReadOnly
+	case s.Retired != nil:
+		return LogStateRetired, s.Retired
+	case s.Rejected != nil:
+		return LogStateRejected, s.Rejected
+	}
+	return "", nil
+}
+
+// ParseLogList parses a v2 or v3 log list. Tiled logs are kept without a URL
+// as they serve no RFC 6962 API to prove inclusion with.
+func ParseLogList(data []byte) (*LogList, error) {
+	var v3 logListV3
+	if err := json.Unmarshal(data, &v3); err != nil {
+		return nil, fmt.Errorf("failed to parse log list: %v", err)
+	}
+	if len(v3.Operators) == 0 {
+		return nil, errors.New("failed to parse log list: no operators")
+	}
+
+	ll := &LogList{
+		Version:   v3.Version,
+		Timestamp: v3.LogListTimestamp,
+		states:    make(map[[sha256.Size]byte]string),
+	}
+	for i, op := range v3.Operators {
+		ll.Operators = append(ll.Operators, loglist.Operator{ID: i, Name: op.Name})
+		for _, l := range append(append([]logV3{}, op.Logs...), op.TiledLogs...) {
+			log := loglist.Log{
+				Description:       l.Description,
+				Key:               l.Key,
+				MaximumMergeDelay: l.MMD,
+				OperatedBy:        []int{i},
+				URL:               l.URL,
+				DNSAPIEndpoint:    l.DNS,
+			}
+
+			state, ls := l.State.active()
+			switch state {
+			case LogStateRetired, LogStateRejected:
+				log.DisqualifiedAt = int(ls.Timestamp.Unix())
+			case LogStateReadOnly:
+				if ls.FinalTreeHead != nil {
+					log.FinalSTH = &loglist.STH{
+						TreeSize:       ls.FinalTreeHead.TreeSize,
+						Timestamp:      int(ls.Timestamp.Unix()),
+						SHA256RootHash: ls.FinalTreeHead.SHA256RootHash,
+					}
+				}
+			}
+
+			ll.Logs = append(ll.Logs, log)
+			ll.states[sha256.Sum256(l.Key)] = state
+		}
+	}
+
+	return ll, nil
+}
+
+// VerifyLogList checks sig over data with pubKey and parses the log list.
+// A nil pubKey uses LogListPubKeyPEM.
+func VerifyLogList(data, sig []byte, pubKey crypto.PublicKey) (*LogList, error) {
+	if pubKey == nil {
+		block, _ := pem.Decode([]byte(LogListPubKeyPEM))
+		var err error
+		pubKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse log list key: %v", err)
+		}
+	}
+
+	var sigAlgo tls.SignatureAlgorithm
+	switch pkType := pubKey.(type) {
+	case *rsa.PublicKey:
+		sigAlgo = tls.RSA
+	case *ecdsa.PublicKey:
+		sigAlgo = tls.ECDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pkType)
+	}
+	tlsSig := tls.DigitallySigned{
+		Algorithm: tls.SignatureAndHashAlgorithm{
+			Hash:      tls.SHA256,
+			Signature: sigAlgo,
+		},
+		Signature: sig,
+	}
+	if err := tls.VerifySignature(pubKey, data, tlsSig); err != nil {
+		return nil, fmt.Errorf("failed to verify log list signature: %v", err)
+	}
+
+	return ParseLogList(data)
+}
+
+// EmbeddedLogList returns the log list embedded at build time.
+func EmbeddedLogList() (*LogList, error) {
+	if len(embeddedLogList) == 0 {
+		return nil, ErrNoEmbeddedLogList
+	}
+	return VerifyLogList([]byte(embeddedLogList), []byte(embeddedLogListSig), nil)
+}
+
+// FetchLogList downloads the log list and its signature and verifies them.
+// The raw list and signature are returned so a caller can cache them.
+func FetchLogList(hc *http.Client) (ll *LogList, data, sig []byte, err error) {
+	data, err = x509util.ReadFileOrURL(LogListURL, hc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read log list: %v", err)
+	}
+	sig, err = x509util.ReadFileOrURL(LogListSignatureURL, hc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read log list signature: %v", err)
+	}
+	ll, err = VerifyLogList(data, sig, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ll, data, sig, nil
+}
+
+// ReadLogList reads the log list in dir, as written by WriteLogList, and
+// verifies it.
+func ReadLogList(dir string) (*LogList, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, LogListFile))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ioutil.ReadFile(filepath.Join(dir, LogListSignatureFile))
+	if err != nil {
+		return nil, err
+	}
+	return VerifyLogList(data, sig, nil)
+}
+
+// WriteLogList saves a log list and its signature into dir.
+func WriteLogList(dir string, data, sig []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, LogListFile), data, 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, LogListSignatureFile), sig, 0644)
+}
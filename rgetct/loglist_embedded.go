@@ -0,0 +1,8 @@
+package rgetct
+
+// embeddedLogList and embeddedLogListSig are replaced by a verified copy of
+// LogListURL with "make loglist", whose output is committed. Until then rget
+// downloads the list, and TestEmbeddedLogList fails.
+const embeddedLogList = ""
+
+const embeddedLogListSig = ""
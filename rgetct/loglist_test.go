@@ -0,0 +1,170 @@
+package rgetct
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/tls"
+)
+
+const testLogList = `{
+  "version": "1.2",
+  "log_list_timestamp": "2019-10-01T12:00:00Z",
+  "operators": [
+    {
+      "name": "Google",
+      "logs": [
+        {
+          "description": "Google 'Argon2020' log",
+          "key": "AQID",
+          "url": "https://ct.googleapis.com/logs/argon2020/",
+          "mmd": 86400,
+          "state": {"usable": {"timestamp": "2018-06-15T02:30:13Z"}}
+        },
+        {
+          "description": "Google 'Aviator' log",
+          "key": "BAUG",
+          "url": "https://ct.googleapis.com/aviator/",
+          "mmd": 86400,
+          "state": {
+            "readonly": {
+              "timestamp": "2016-11-30T13:24:18Z",
+              "final_tree_head": {"sha256_root_hash": "AAAA", "tree_size": 46466472}
+            }
+          }
+        }
+      ]
+    },
+    {
+      "name": "Cloudflare",
+      "logs": [
+        {
+          "description": "Cloudflare 'Nimbus2020' Log",
+          "key": "BwgJ",
+          "url": "https://ct.cloudflare.com/logs/nimbus2020/",
+          "mmd": 86400,
+          "state": {"retired": {"timestamp": "2019-01-01T00:00:00Z"}}
+        }
+      ],
+      "tiled_logs": [
+        {
+          "description": "Cloudflare 'Raio2025h2b' Log",
+          "key": "CgsM",
+          "submission_url": "https://raio2025h2b.ct.cloudflare.com/",
+          "monitoring_url": "https://raio2025h2b.ct.cloudflare.com/",
+          "mmd": 60,
+          "state": {"usable": {"timestamp": "2025-06-01T00:00:00Z"}}
+        }
+      ]
+    }
+  ]
+}`
+
+func TestParseLogList(t *testing.T) {
+	ll, err := ParseLogList([]byte(testLogList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ll.Version != "1.2" || len(ll.Logs) != 4 || len(ll.Operators) != 2 {
+		t.Fatalf("unexpected log list %+v", ll)
+	}
+
+	testCases := []struct {
+		key          string
+		state        string
+		operator     int
+		disqualified bool
+		final        bool
+		tiled        bool
+	}{
+		{"AQID", LogStateUsable, 0, false, false, false},
+		{"BAUG", LogStateReadOnly, 0, false, true, false},
+		{"BwgJ", LogStateRetired, 1, true, false, false},
+		{"CgsM", LogStateUsable, 1, false, false, true},
+	}
+
+	for ti, tt := range testCases {
+		key, _ := base64.StdEncoding.DecodeString(tt.key)
+		log := ll.FindLogByKeyHash(sha256.Sum256(key))
+		if log == nil {
+			t.Errorf("%d: log %v not found", ti, tt.key)
+			continue
+		}
+		if s := ll.State(log); s != tt.state {
+			t.Errorf("%d: state %v != %v", ti, s, tt.state)
+		}
+		if log.OperatedBy[0] != tt.operator {
+			t.Errorf("%d: operator %v != %v", ti, log.OperatedBy, tt.operator)
+		}
+		if (log.DisqualifiedAt != 0) != tt.disqualified {
+			t.Errorf("%d: disqualified at %v", ti, log.DisqualifiedAt)
+		}
+		if (log.FinalSTH != nil) != tt.final {
+			t.Errorf("%d: final STH %v", ti, log.FinalSTH)
+		}
+		if (log.URL == "") != tt.tiled {
+			t.Errorf("%d: URL %q", ti, log.URL)
+		}
+	}
+
+	if _, err := ParseLogList([]byte(`{"logs": []}`)); err == nil {
+		t.Errorf("wanted err for v1 log list got nil")
+	}
+}
+
+func TestVerifyLogList(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := tls.CreateSignature(*key, tls.SHA256, []byte(testLogList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyLogList([]byte(testLogList), sig.Signature, &key.PublicKey); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tampered := []byte(testLogList)
+	tampered[10] = 'X'
+	if _, err := VerifyLogList(tampered, sig.Signature, &key.PublicKey); err == nil {
+		t.Errorf("wanted err for tampered list got nil")
+	}
+
+	// the test list is not signed by Google
+	if _, err := VerifyLogList([]byte(testLogList), sig.Signature, nil); err == nil {
+		t.Errorf("wanted err for wrong key got nil")
+	}
+
+	dir, err := ioutil.TempDir("", "TestVerifyLogList")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := WriteLogList(dir, []byte(testLogList), sig.Signature); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLogList(dir); err == nil {
+		t.Errorf("wanted err reading list not signed by Google got nil")
+	}
+}
+
+// TestEmbeddedLogList checks that the committed list, written by "make
+// loglist", is signed by Google and lists logs.
+func TestEmbeddedLogList(t *testing.T) {
+	ll, err := EmbeddedLogList()
+	if err != nil {
+		t.Fatalf("embedded log list: %v, run make loglist", err)
+	}
+	if len(ll.Logs) == 0 {
+		t.Errorf("embedded log list version %v lists no logs", ll.Version)
+	}
+}
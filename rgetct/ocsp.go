@@ -0,0 +1,120 @@
+package rgetct
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// The subset of RFC 6960 needed to find SCTs in a stapled OCSP response,
+// following the layout used by golang.org/x/crypto/ocsp.
+
+var (
+	oidOCSPBasic   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicOCSPResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPSCTs returns the SCTs carried in the single response for leaf of a
+// DER encoded OCSP response. The OCSP signature is not checked as each SCT
+// carries its own signature over the certificate.
+func OCSPSCTs(der []byte, leaf *x509.Certificate) ([][]byte, error) {
+	if len(der) == 0 {
+		return nil, nil
+	}
+
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse OCSP response: %v", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data in OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, errors.New("OCSP response is not a basic response")
+	}
+
+	var basic basicOCSPResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, fmt.Errorf("failed to parse basic OCSP response: %v", err)
+	}
+
+	var scts [][]byte
+	for _, r := range basic.TBSResponseData.Responses {
+		if r.CertID.SerialNumber == nil || r.CertID.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+			continue
+		}
+		for _, ext := range r.SingleExtensions {
+			if !ext.Id.Equal(oidOCSPSCTList) {
+				continue
+			}
+			var raw []byte
+			if _, err := asn1.Unmarshal(ext.Value, &raw); err != nil {
+				return nil, fmt.Errorf("failed to parse OCSP SCT extension: %v", err)
+			}
+			var list x509.SignedCertificateTimestampList
+			if _, err := tls.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("failed to parse OCSP SCT list: %v", err)
+			}
+			for _, sct := range list.SCTList {
+				scts = append(scts, sct.Val)
+			}
+		}
+	}
+
+	return scts, nil
+}
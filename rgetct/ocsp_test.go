@@ -0,0 +1,119 @@
+package rgetct
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+func ocspResponseWithSCTs(t *testing.T, serial int64, scts ...[]byte) []byte {
+	var list x509.SignedCertificateTimestampList
+	for _, sct := range scts {
+		list.SCTList = append(list.SCTList, x509.SerializedSCT{Val: sct})
+	}
+	tlsList, err := tls.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extValue, err := asn1.Marshal(tlsList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	basic, err := asn1.Marshal(basicOCSPResponse{
+		TBSResponseData: ocspResponseData{
+			RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: []byte{4, 1, 0}},
+			ProducedAt:     now,
+			Responses: []ocspSingleResponse{{
+				CertID: ocspCertID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+					NameHash:      []byte{1},
+					IssuerKeyHash: []byte{2},
+					SerialNumber:  big.NewInt(serial),
+				},
+				Good:             true,
+				ThisUpdate:       now,
+				SingleExtensions: []pkix.Extension{{Id: oidOCSPSCTList, Value: extValue}},
+			}},
+		},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}},
+		Signature:          asn1.BitString{Bytes: []byte{0}, BitLength: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := asn1.Marshal(ocspResponse{
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestOCSPSCTs(t *testing.T) {
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(42)}
+	sct1, sct2 := []byte{1, 2, 3}, []byte{4, 5, 6}
+
+	testCases := []struct {
+		der     []byte
+		want    [][]byte
+		wantErr bool
+	}{
+		{ocspResponseWithSCTs(t, 42, sct1, sct2), [][]byte{sct1, sct2}, false},
+		// response for another certificate
+		{ocspResponseWithSCTs(t, 7, sct1), nil, false},
+		{nil, nil, false},
+		{[]byte{0x30, 0x01}, nil, true},
+	}
+
+	for ti, tt := range testCases {
+		scts, err := OCSPSCTs(tt.der, leaf)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%d: wanted err got nil", ti)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", ti, err)
+		}
+		if !reflect.DeepEqual(scts, tt.want) {
+			t.Errorf("%d: SCTs %x != %x", ti, scts, tt.want)
+		}
+	}
+}
+
+func TestDedupeSCTs(t *testing.T) {
+	ll, err := ParseLogList([]byte(testLogList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := &ll.Logs[0], &ll.Logs[1]
+
+	results := []SCTResult{
+		{Subject: "embedded SCT[0]", Channel: ChannelEmbedded, LogID: [32]byte{1}, Log: a, Valid: false},
+		{Subject: "external SCT[0]", Channel: ChannelTLS, LogID: [32]byte{1}, Log: a, Valid: true},
+		{Subject: "OCSP SCT[0]", Channel: ChannelOCSP, LogID: [32]byte{1}, Log: a, Valid: true},
+		{Subject: "external SCT[1]", Channel: ChannelTLS, LogID: [32]byte{2}, Log: b, Valid: true},
+		{Subject: "external SCT[2]", Channel: ChannelTLS},
+	}
+
+	deduped := DedupeSCTs(results)
+	var subjects []string
+	for _, r := range deduped {
+		subjects = append(subjects, r.Subject)
+	}
+	want := []string{"external SCT[0]", "external SCT[1]", "external SCT[2]"}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("deduped %v != %v", subjects, want)
+	}
+}
@@ -0,0 +1,273 @@
+package rgetct
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// Policy describes the SCTs a record certificate needs before rget trusts
+// it. Policies can be built in, see PolicyByName, or loaded from the
+// "policies" key of the rget config file.
+type Policy struct {
+	Name string `mapstructure:"name" json:"name"`
+
+	// MinSCTs is the number of valid SCTs required.
+	MinSCTs int `mapstructure:"min-scts" json:"min_scts,omitempty"`
+
+	// MinOperators is the number of distinct log operators that must have
+	// issued a valid SCT.
+	MinOperators int `mapstructure:"min-operators" json:"min_operators,omitempty"`
+
+	// Lifetimes raises MinSCTs for longer lived certificates in the style
+	// of the Chrome and Apple CT policies. The first rule that covers the
+	// lifetime of the certificate applies, a certificate no rule covers
+	// fails the policy.
+	Lifetimes []LifetimeRule `mapstructure:"lifetimes" json:"lifetimes,omitempty"`
+
+	// DeliveredSCTs, if set, only counts embedded SCTs towards Lifetimes
+	// and instead accepts this many SCTs delivered in the TLS handshake or
+	// a stapled OCSP response from currently qualified, usable or read
+	// only logs.
+	DeliveredSCTs int `mapstructure:"delivered-scts" json:"delivered_scts,omitempty"`
+
+	// MinCurrent is the number of counted SCTs that must come from logs
+	// that are currently qualified, usable or read only.
+	MinCurrent int `mapstructure:"min-current" json:"min_current,omitempty"`
+
+	// AllowLogs, if not empty, is the list of base64 log IDs whose SCTs
+	// count. SCTs from DenyLogs never count.
+	AllowLogs []string `mapstructure:"allow-logs" json:"allow_logs,omitempty"`
+	DenyLogs  []string `mapstructure:"deny-logs" json:"deny_logs,omitempty"`
+
+	// States lists the log list states whose SCTs count. SCTs from retired
+	// logs only count if they were issued before the log was retired. If
+	// empty DefaultLogStates is used.
+	States []string `mapstructure:"states" json:"states,omitempty"`
+}
+
+// LifetimeRule requires MinSCTs for certificates valid for at most MaxDays.
+// A MaxDays of zero matches any lifetime.
+type LifetimeRule struct {
+	MaxDays int `mapstructure:"max-days" json:"max_days,omitempty"`
+	MinSCTs int `mapstructure:"min-scts" json:"min_scts"`
+}
+
+// DefaultLogStates are the log states whose SCTs count by default.
+var DefaultLogStates = []string{LogStateQualified, LogStateUsable, LogStateReadOnly, LogStateRetired}
+
+// currentLogStates are the log states Chrome and Apple consider current.
+var currentLogStates = map[string]bool{LogStateQualified: true, LogStateUsable: true, LogStateReadOnly: true}
+
+// DefaultPolicy is the name of the policy used when none is configured.
+const DefaultPolicy = "any"
+
+var builtinPolicies = map[string]Policy{
+	// any accepts a single valid SCT from any known log
+	"any": {
+		Name:    "any",
+		MinSCTs: 1,
+		States: []string{LogStatePending, LogStateQualified, LogStateUsable,
+			LogStateReadOnly, LogStateRetired, LogStateRejected, ""},
+	},
+	// chrome follows https://googlechrome.github.io/CertificateTransparency/ct_policy.html
+	"chrome": {
+		Name:          "chrome",
+		MinOperators:  2,
+		MinCurrent:    1,
+		DeliveredSCTs: 2,
+		Lifetimes: []LifetimeRule{
+			{MaxDays: 180, MinSCTs: 2},
+			{MinSCTs: 3},
+		},
+	},
+	// apple follows https://support.apple.com/en-us/HT205280, which also
+	// refuses certificates valid for more than 398 days
+	"apple": {
+		Name:          "apple",
+		MinOperators:  2,
+		MinCurrent:    1,
+		DeliveredSCTs: 2,
+		Lifetimes: []LifetimeRule{
+			{MaxDays: 180, MinSCTs: 2},
+			{MaxDays: 398, MinSCTs: 3},
+		},
+	},
+}
+
+// PolicyByName returns the built in policy called name.
+func PolicyByName(name string) (*Policy, error) {
+	p, ok := builtinPolicies[name]
+	if !ok {
+		var names []string
+		for n := range builtinPolicies {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown policy %q, known policies: %v", name, strings.Join(names, ", "))
+	}
+	return &p, nil
+}
+
+// Clause is the outcome of one requirement of a policy.
+type Clause struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// PolicyResult explains which clauses of a policy passed or failed.
+type PolicyResult struct {
+	Policy  string   `json:"policy"`
+	OK      bool     `json:"ok"`
+	Clauses []Clause `json:"clauses"`
+}
+
+func (r *PolicyResult) add(name string, ok bool, format string, args ...interface{}) {
+	r.Clauses = append(r.Clauses, Clause{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	r.OK = r.OK && ok
+}
+
+// Evaluate checks the SCT results for cert against the policy. results may
+// hold several SCTs from a log, as delivered through several channels; each
+// log counts once, but towards both embedded and delivered SCTs if it
+// delivered SCTs both ways.
+func (p *Policy) Evaluate(cert *x509.Certificate, results []SCTResult, ll *LogList) *PolicyResult {
+	pr := &PolicyResult{Policy: p.Name, OK: true}
+
+	allow := logIDSet(p.AllowLogs)
+	deny := logIDSet(p.DenyLogs)
+	states := p.States
+	if len(states) == 0 {
+		states = DefaultLogStates
+	}
+
+	var counted, current int
+	var excluded []string
+	operators := map[int]bool{}
+	countedLogs := map[[32]byte]bool{}
+	embeddedLogs := map[[32]byte]bool{}
+	deliveredLogs := map[[32]byte]bool{}
+	for _, r := range results {
+		if !r.Valid {
+			continue
+		}
+		if reason := p.exclude(r, allow, deny, states, ll); reason != "" {
+			excluded = append(excluded, fmt.Sprintf("%s (%s)", r.Subject, reason))
+			continue
+		}
+		isCurrent := currentLogStates[ll.State(r.Log)]
+		switch r.Channel {
+		case ChannelTLS, ChannelOCSP:
+			if isCurrent {
+				deliveredLogs[r.LogID] = true
+			}
+		default:
+			embeddedLogs[r.LogID] = true
+		}
+		if countedLogs[r.LogID] {
+			continue
+		}
+		countedLogs[r.LogID] = true
+		counted++
+		if isCurrent {
+			current++
+		}
+		for _, op := range r.Log.OperatedBy {
+			operators[op] = true
+		}
+	}
+	embedded, delivered := len(embeddedLogs), len(deliveredLogs)
+
+	if len(excluded) > 0 {
+		pr.Clauses = append(pr.Clauses, Clause{
+			Name:   "logs",
+			OK:     true,
+			Detail: fmt.Sprintf("not counting %s", strings.Join(excluded, ", ")),
+		})
+	}
+
+	if p.MinSCTs > 0 {
+		pr.add("min-scts", counted >= p.MinSCTs, "%d valid SCTs, %d required", counted, p.MinSCTs)
+	}
+
+	if len(p.Lifetimes) > 0 && cert != nil {
+		days := int(cert.NotAfter.Sub(cert.NotBefore) / (24 * time.Hour))
+		covered := false
+		for _, l := range p.Lifetimes {
+			if l.MaxDays != 0 && days > l.MaxDays {
+				continue
+			}
+			covered = true
+			if p.DeliveredSCTs == 0 {
+				pr.add("lifetime", counted >= l.MinSCTs,
+					"certificate valid for %d days needs %d valid SCTs, have %d", days, l.MinSCTs, counted)
+				break
+			}
+			pr.add("lifetime", embedded >= l.MinSCTs || delivered >= p.DeliveredSCTs,
+				"certificate valid for %d days needs %d embedded SCTs or %d delivered SCTs from current logs, have %d and %d",
+				days, l.MinSCTs, p.DeliveredSCTs, embedded, delivered)
+			break
+		}
+		if !covered {
+			pr.add("lifetime", false, "certificate valid for %d days is longer than the policy allows", days)
+		}
+	}
+
+	if p.MinCurrent > 0 {
+		pr.add("min-current", current >= p.MinCurrent,
+			"%d SCTs from current logs, %d required", current, p.MinCurrent)
+	}
+
+	if p.MinOperators > 0 {
+		pr.add("min-operators", len(operators) >= p.MinOperators,
+			"%d distinct log operators, %d required", len(operators), p.MinOperators)
+	}
+
+	if len(pr.Clauses) == 0 {
+		pr.add("empty", false, "policy has no requirements")
+	}
+
+	return pr
+}
+
+// exclude returns why the valid SCT r does not count towards the policy, or
+// "" if it does.
+func (p *Policy) exclude(r SCTResult, allow, deny map[string]bool, states []string, ll *LogList) string {
+	id := base64.StdEncoding.EncodeToString(r.LogID[:])
+	if deny[id] {
+		return "denied log " + id
+	}
+	if len(allow) > 0 && !allow[id] {
+		return "log not allowed " + id
+	}
+
+	state := ll.State(r.Log)
+	for _, s := range states {
+		if s != state {
+			continue
+		}
+		if state == LogStateRetired && r.Log.DisqualifiedAt != 0 &&
+			!r.Timestamp.Before(time.Unix(int64(r.Log.DisqualifiedAt), 0)) {
+			return fmt.Sprintf("issued after log %q retired", r.Log.Description)
+		}
+		return ""
+	}
+
+	if state == "" {
+		state = "unknown"
+	}
+	return fmt.Sprintf("log %q is %s", r.Log.Description, state)
+}
+
+func logIDSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,116 @@
+package rgetct
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	ll, err := ParseLogList([]byte(testLogList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same list with the Cloudflare log still usable
+	usable, err := ParseLogList([]byte(strings.Replace(testLogList,
+		`"retired": {"timestamp": "2019-01-01T00:00:00Z"}`,
+		`"usable": {"timestamp": "2019-01-01T00:00:00Z"}`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sct := func(ll *LogList, channel, key string, valid bool, ts time.Time) SCTResult {
+		k, _ := base64.StdEncoding.DecodeString(key)
+		id := sha256.Sum256(k)
+		return SCTResult{
+			Subject:   "SCT " + key,
+			Channel:   channel,
+			LogID:     id,
+			Log:       ll.FindLogByKeyHash(id),
+			Timestamp: ts,
+			Valid:     valid,
+		}
+	}
+	result := func(key string, valid bool, ts time.Time) SCTResult {
+		return sct(ll, ChannelEmbedded, key, valid, ts)
+	}
+	argonID := func() string {
+		k, _ := base64.StdEncoding.DecodeString("AQID")
+		id := sha256.Sum256(k)
+		return base64.StdEncoding.EncodeToString(id[:])
+	}()
+
+	before := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	short := &x509.Certificate{NotBefore: before, NotAfter: before.Add(90 * 24 * time.Hour)}
+	long := &x509.Certificate{NotBefore: before, NotAfter: before.Add(400 * 24 * time.Hour)}
+
+	chrome, err := PolicyByName("chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apple, err := PolicyByName("apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	any, err := PolicyByName("any")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		policy  *Policy
+		ll      *LogList
+		cert    *x509.Certificate
+		results []SCTResult
+		want    bool
+	}{
+		{any, ll, short, []SCTResult{result("AQID", true, before)}, true},
+		{any, ll, short, []SCTResult{result("AQID", false, before)}, false},
+		// Google and Cloudflare, Cloudflare SCT issued before retirement
+		{chrome, ll, short, []SCTResult{result("AQID", true, before), result("BwgJ", true, before)}, true},
+		// Cloudflare SCT issued after the log retired
+		{chrome, ll, short, []SCTResult{result("AQID", true, before), result("BwgJ", true, after)}, false},
+		// two SCTs from the same operator
+		{chrome, ll, short, []SCTResult{result("AQID", true, before), result("BAUG", true, before)}, false},
+		// long lived certificates need three SCTs
+		{chrome, ll, long, []SCTResult{result("AQID", true, before), result("BwgJ", true, before)}, false},
+		{chrome, ll, long, []SCTResult{result("AQID", true, before), result("BAUG", true, before), result("BwgJ", true, before)}, true},
+		{&Policy{Name: "deny", MinSCTs: 1, DenyLogs: []string{argonID}}, ll, short, []SCTResult{result("AQID", true, before)}, false},
+		{&Policy{Name: "allow", MinSCTs: 1, AllowLogs: []string{argonID}}, ll, short, []SCTResult{result("BAUG", true, before)}, false},
+		{&Policy{Name: "allow", MinSCTs: 1, AllowLogs: []string{argonID}}, ll, short, []SCTResult{result("AQID", true, before)}, true},
+		{&Policy{Name: "usable", MinSCTs: 1, States: []string{LogStateUsable}}, ll, short, []SCTResult{result("BAUG", true, before)}, false},
+		// delivered SCTs only count from current logs
+		{chrome, ll, long, []SCTResult{sct(ll, ChannelTLS, "AQID", true, before), sct(ll, ChannelTLS, "BwgJ", true, before)}, false},
+		{chrome, usable, long, []SCTResult{sct(usable, ChannelTLS, "AQID", true, before), sct(usable, ChannelOCSP, "BwgJ", true, before)}, true},
+		// a log whose SCT is both embedded and delivered counts towards both
+		{chrome, usable, long, []SCTResult{sct(usable, ChannelEmbedded, "AQID", true, before), sct(usable, ChannelTLS, "AQID", true, before), sct(usable, ChannelTLS, "BwgJ", true, before)}, true},
+		// but only once towards the other requirements
+		{chrome, ll, short, []SCTResult{result("AQID", true, before), sct(ll, ChannelTLS, "AQID", true, before)}, false},
+		{&Policy{Name: "twice", MinSCTs: 2}, ll, short, []SCTResult{result("AQID", true, before), sct(ll, ChannelOCSP, "AQID", true, before)}, false},
+		// apple refuses certificates valid for more than 398 days
+		{apple, usable, long, []SCTResult{sct(usable, ChannelTLS, "AQID", true, before), sct(usable, ChannelOCSP, "BwgJ", true, before)}, false},
+		{apple, ll, long, []SCTResult{result("AQID", true, before), result("BAUG", true, before), result("BwgJ", true, before)}, false},
+		{apple, ll, short, []SCTResult{result("AQID", true, before), result("BwgJ", true, before)}, true},
+		// only a retired log
+		{&Policy{Name: "current", MinSCTs: 1, MinCurrent: 1}, ll, short, []SCTResult{result("BwgJ", true, before)}, false},
+		{&Policy{Name: "empty"}, ll, short, []SCTResult{result("AQID", true, before)}, false},
+	}
+
+	for ti, tt := range testCases {
+		pr := tt.policy.Evaluate(tt.cert, tt.results, tt.ll)
+		if pr.OK != tt.want {
+			t.Errorf("%d: policy %v want %v got %+v", ti, tt.policy.Name, tt.want, pr.Clauses)
+		}
+	}
+
+	if _, err := PolicyByName("unknown"); err == nil {
+		t.Errorf("wanted err for unknown policy got nil")
+	}
+}
@@ -0,0 +1,83 @@
+package rgetct
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+//go:generate go run gen_roots.go
+
+const (
+	// RootsSystem selects the root certificates of the operating system.
+	RootsSystem = "system"
+	// RootsBundled selects the snapshot of the CCADB roots built into rget.
+	RootsBundled = "bundled"
+)
+
+// LoadRoots returns the root certificate pool named by spec which is either
+// RootsSystem, RootsBundled or the path to a file of PEM certificates.
+func LoadRoots(spec string) (*x509.CertPool, error) {
+	switch spec {
+	case "", RootsSystem:
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system roots: %v", err)
+		}
+		return pool, nil
+	case RootsBundled:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(bundledRootsPEM)) {
+			return nil, errors.New("no bundled roots")
+		}
+		return pool, nil
+	}
+
+	data, err := ioutil.ReadFile(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roots: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %v", spec)
+	}
+	return pool, nil
+}
+
+// VerifyChain builds a path from the leaf of chain to one of roots using the
+// remaining certificates as intermediates. The leaf must be valid for host at
+// the current time and allowed for server authentication. The verified chain,
+// ending in the root, is returned.
+func VerifyChain(chain []*x509.Certificate, host string, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	return VerifyChainAt(chain, host, roots, time.Now())
+}
+
+// VerifyChainAt is like VerifyChain but checks validity at time t. This is
+// used for certificates found in CT logs which may have expired since they
+// were logged.
+func VerifyChainAt(chain []*x509.Certificate, host string, roots *x509.CertPool, t time.Time) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chains[0], nil
+}
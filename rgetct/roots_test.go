@@ -0,0 +1,109 @@
+package rgetct
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+func newCert(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestVerifyChain(t *testing.T) {
+	now := time.Now()
+	ca, caKey := newCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rget test root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	leafTmpl := func(eku x509.ExtKeyUsage, notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "record.example.com"},
+			DNSNames:     []string{"record.example.com"},
+			NotBefore:    now.Add(-2 * time.Hour),
+			NotAfter:     notAfter,
+			ExtKeyUsage:  []x509.ExtKeyUsage{eku},
+		}
+	}
+
+	leaf, _ := newCert(t, leafTmpl(x509.ExtKeyUsageServerAuth, now.Add(time.Hour)), ca, caKey)
+	expired, _ := newCert(t, leafTmpl(x509.ExtKeyUsageServerAuth, now.Add(-time.Hour)), ca, caKey)
+	client, _ := newCert(t, leafTmpl(x509.ExtKeyUsageClientAuth, now.Add(time.Hour)), ca, caKey)
+	self, _ := newCert(t, leafTmpl(x509.ExtKeyUsageServerAuth, now.Add(time.Hour)), nil, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	testCases := []struct {
+		chain   []*x509.Certificate
+		host    string
+		wantErr bool
+	}{
+		{[]*x509.Certificate{leaf, ca}, "record.example.com", false},
+		{[]*x509.Certificate{leaf}, "record.example.com", false},
+		// wrong host
+		{[]*x509.Certificate{leaf, ca}, "other.example.com", true},
+		// expired leaf
+		{[]*x509.Certificate{expired, ca}, "record.example.com", true},
+		// not for server authentication
+		{[]*x509.Certificate{client, ca}, "record.example.com", true},
+		// self-signed with the right name
+		{[]*x509.Certificate{self}, "record.example.com", true},
+		{nil, "record.example.com", true},
+	}
+
+	for ti, tt := range testCases {
+		verified, err := VerifyChain(tt.chain, tt.host, roots)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%d: wanted err got nil", ti)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", ti, err)
+			continue
+		}
+		if !verified[len(verified)-1].Equal(ca) {
+			t.Errorf("%d: chain does not end in root", ti)
+		}
+	}
+}
+
+func TestLoadRootsBundled(t *testing.T) {
+	pool, err := LoadRoots(RootsBundled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Subjects()) == 0 {
+		t.Errorf("no bundled roots")
+	}
+}
@@ -0,0 +1,120 @@
+package rgetct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// DefaultSearchURL is the CT search index used to discover record
+// certificates without contacting the recorder.
+const DefaultSearchURL = "https://crt.sh/"
+
+// ErrNoLoggedCert is returned when a CT search index knows of no usable
+// certificate for a domain.
+var ErrNoLoggedCert = errors.New("no logged certificate found")
+
+// searchEntry is an entry of the crt.sh JSON search API.
+type searchEntry struct {
+	ID        int64  `json:"id"`
+	NameValue string `json:"name_value"`
+	NotBefore string `json:"not_before"`
+}
+
+// SearchLoggedCert finds a certificate for domain with embedded SCTs using
+// the crt.sh compatible CT search index at index. CT logs cannot be searched
+// by name so the index is only trusted to point at a certificate: the
+// returned chain must still be checked with VerifyChain and its SCTs with
+// CheckX509, which proves inclusion against the logs themselves. The issuer
+// is fetched from the certificate's AIA URL.
+func SearchLoggedCert(ctx context.Context, index, domain string, hc *http.Client) ([]*x509.Certificate, error) {
+	u, err := url.Parse(index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search index URL: %v", err)
+	}
+	q := url.Values{"q": {domain}, "output": {"json"}}
+	u.RawQuery = q.Encode()
+
+	body, err := searchGet(ctx, hc, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []searchEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse search results: %v", err)
+	}
+
+	// Newest certificates first as the recorder renews them
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].NotBefore > entries[j].NotBefore
+	})
+
+	for _, e := range entries {
+		if !nameValueContains(e.NameValue, domain) {
+			continue
+		}
+
+		q := url.Values{"d": {fmt.Sprintf("%d", e.ID)}}
+		u.RawQuery = q.Encode()
+		data, err := searchGet(ctx, hc, u.String())
+		if err != nil {
+			return nil, err
+		}
+		certs, err := x509util.CertificatesFromPEM(data)
+		if err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", e.ID, err)
+		}
+
+		// Skip precertificates, only the final certificate carries
+		// the SCTs
+		leaf := certs[0]
+		if leaf.IsPrecertificate() || len(leaf.SCTList.SCTList) == 0 {
+			continue
+		}
+
+		chain := []*x509.Certificate{leaf}
+		issuer, err := x509util.GetIssuer(leaf, hc)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil {
+			chain = append(chain, issuer)
+		}
+		return chain, nil
+	}
+
+	return nil, ErrNoLoggedCert
+}
+
+func searchGet(ctx context.Context, hc *http.Client, u string) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, hc, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search index %v: %v", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func nameValueContains(nameValue, domain string) bool {
+	for _, n := range strings.Split(nameValue, "\n") {
+		if strings.EqualFold(strings.TrimSpace(n), domain) {
+			return true
+		}
+	}
+	return false
+}
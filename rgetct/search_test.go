@@ -0,0 +1,71 @@
+package rgetct
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+func TestSearchLoggedCert(t *testing.T) {
+	const domain = "a.b.v1-0.repo.org.github.com.recorder.merklecounty.com"
+	now := time.Now()
+
+	tmpl := func(serial int64, name string, scts bool) *x509.Certificate {
+		c := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(time.Hour),
+		}
+		if scts {
+			c.SCTList.SCTList = []x509.SerializedSCT{{Val: []byte{1, 2, 3}}}
+		}
+		return c
+	}
+
+	certs := map[string]*x509.Certificate{}
+	certs["1"], _ = newCert(t, tmpl(1, domain, false), nil, nil)
+	certs["2"], _ = newCert(t, tmpl(2, domain, true), nil, nil)
+	certs["3"], _ = newCert(t, tmpl(3, "other.example.com", true), nil, nil)
+
+	entries := []searchEntry{
+		{ID: 3, NameValue: "other.example.com", NotBefore: "2019-10-03T00:00:00"},
+		{ID: 1, NameValue: domain, NotBefore: "2019-10-02T00:00:00"},
+		{ID: 2, NameValue: domain, NotBefore: "2019-10-01T00:00:00"},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("d"); id != "" {
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: certs[id].Raw})
+			return
+		}
+		if r.URL.Query().Get("q") != domain {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	chain, err := SearchLoggedCert(ctx, ts.URL+"/", domain, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || chain[0].SerialNumber.Int64() != 2 {
+		t.Errorf("found wrong certificate %v", chain[0].SerialNumber)
+	}
+
+	if _, err := SearchLoggedCert(ctx, ts.URL+"/", "missing.example.com", ts.Client()); err != ErrNoLoggedCert {
+		t.Errorf("want %v got %v", ErrNoLoggedCert, err)
+	}
+}
@@ -0,0 +1,160 @@
+// Package rgetforge publishes the sums of releases of code hosting sites
+// through their APIs.
+package rgetforge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-github/v24/github"
+
+	"go.merklecounty.com/rget/rgetgitea"
+	"go.merklecounty.com/rget/rgetgithub"
+	"go.merklecounty.com/rget/rgetgitlab"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// Forge is the API of a code hosting site. Releases are of the repo repo of
+// owner, which is the full namespace of GitLab projects.
+type Forge interface {
+	// ReleaseURLs returns the URLs of the assets of the release tagged
+	// tag, source archives included.
+	ReleaseURLs(ctx context.Context, owner, repo, tag string) ([]string, error)
+
+	// PublishSums adds the sums file read from r, called name, to the
+	// assets of the release tagged tag and returns its URL.
+	PublishSums(ctx context.Context, owner, repo, tag, name string, r io.Reader) (string, error)
+}
+
+// New returns the API of the instance of forge at host, authenticated with
+// token if not empty. GitHub is only at github.com and takes a client
+// authenticating its requests instead, see GitHub.
+func New(forge rgetwellknown.Forge, host, token string) (Forge, error) {
+	baseURL := "https://" + host
+	switch forge {
+	case rgetwellknown.GitLab:
+		return &GitLab{Client: &rgetgitlab.Client{BaseURL: baseURL, Token: token}}, nil
+	case rgetwellknown.Gitea:
+		return &Gitea{Client: &rgetgitea.Client{BaseURL: baseURL, Token: token}}, nil
+	}
+	return nil, fmt.Errorf("no API for forge %q", forge)
+}
+
+// GitHub is the API of github.com.
+type GitHub struct {
+	Client *github.Client
+}
+
+func (f *GitHub) release(ctx context.Context, owner, repo, tag string) (*github.RepositoryRelease, error) {
+	r, _, err := f.Client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	return r, err
+}
+
+// ReleaseURLs implements Forge.
+func (f *GitHub) ReleaseURLs(ctx context.Context, owner, repo, tag string) ([]string, error) {
+	r, err := f.release(ctx, owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, a := range r.Assets {
+		urls = append(urls, a.GetBrowserDownloadURL())
+	}
+	urls = append(urls, r.GetZipballURL(), r.GetTarballURL())
+
+	// Grab the git tag URLs
+	return append(urls, rgetgithub.ArchiveURLs(owner, repo, r.GetTagName())...), nil
+}
+
+// PublishSums implements Forge.
+func (f *GitHub) PublishSums(ctx context.Context, owner, repo, tag, name string, r io.Reader) (string, error) {
+	release, err := f.release(ctx, owner, repo, tag)
+	if err != nil {
+		return "", err
+	}
+
+	// github client, rightfully, expects a file at its beginning
+	tmpfile, err := ioutil.TempFile("", "rget*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	if _, err := io.Copy(tmpfile, r); err != nil {
+		return "", err
+	}
+	if _, err := tmpfile.Seek(0, 0); err != nil {
+		return "", err
+	}
+
+	uo := github.UploadOptions{Name: name}
+	a, _, err := f.Client.Repositories.UploadReleaseAsset(ctx, owner, repo, release.GetID(), &uo, tmpfile)
+	if err != nil {
+		return "", err
+	}
+	return a.GetBrowserDownloadURL(), nil
+}
+
+// GitLab is the API of a GitLab instance. Sums are uploaded to the project
+// and linked from the release.
+type GitLab struct {
+	Client *rgetgitlab.Client
+}
+
+// ReleaseURLs implements Forge.
+func (f *GitLab) ReleaseURLs(ctx context.Context, owner, repo, tag string) ([]string, error) {
+	r, err := f.Client.Release(ctx, owner+"/"+repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	return r.URLs(), nil
+}
+
+// PublishSums implements Forge.
+func (f *GitLab) PublishSums(ctx context.Context, owner, repo, tag, name string, r io.Reader) (string, error) {
+	project := owner + "/" + repo
+	u, err := f.Client.Upload(ctx, project, name, r)
+	if err != nil {
+		return "", err
+	}
+	l, err := f.Client.CreateLink(ctx, project, tag, name, u, "/"+name)
+	if err != nil {
+		return "", err
+	}
+	if l.DirectAssetURL != "" {
+		return l.DirectAssetURL, nil
+	}
+	return u, nil
+}
+
+// Gitea is the API of a Gitea or Forgejo instance.
+type Gitea struct {
+	Client *rgetgitea.Client
+}
+
+// ReleaseURLs implements Forge.
+func (f *Gitea) ReleaseURLs(ctx context.Context, owner, repo, tag string) ([]string, error) {
+	r, err := f.Client.Release(ctx, owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	return r.URLs(), nil
+}
+
+// PublishSums implements Forge.
+func (f *Gitea) PublishSums(ctx context.Context, owner, repo, tag, name string, r io.Reader) (string, error) {
+	release, err := f.Client.Release(ctx, owner, repo, tag)
+	if err != nil {
+		return "", err
+	}
+	a, err := f.Client.Attach(ctx, owner, repo, release.ID, name, r)
+	if err != nil {
+		return "", err
+	}
+	return a.BrowserDownloadURL, nil
+}
@@ -0,0 +1,103 @@
+// Package rgetgitea calls the parts of the Gitea REST API needed to publish
+// the sums of a release. Forgejo serves the same API.
+package rgetgitea
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.merklecounty.com/rget/internal/restapi"
+)
+
+// Client calls the API of a Gitea instance.
+type Client struct {
+	// BaseURL of the instance, for example https://gitea.com.
+	BaseURL string
+
+	// Token is an access token sent with every request if not empty.
+	Token string
+
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Release is a Gitea release and its attachments.
+type Release struct {
+	ID         int64        `json:"id"`
+	TagName    string       `json:"tag_name"`
+	TarballURL string       `json:"tarball_url"`
+	ZipballURL string       `json:"zipball_url"`
+	Assets     []Attachment `json:"assets"`
+}
+
+// Attachment is a file attached to a release.
+type Attachment struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// URLs returns the URLs of the attachments and source archives of r.
+func (r *Release) URLs() []string {
+	var urls []string
+	for _, a := range r.Assets {
+		urls = append(urls, a.BrowserDownloadURL)
+	}
+	for _, u := range []string{r.TarballURL, r.ZipballURL} {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// repoURL returns the API URL of elem of the repo owner/repo.
+func (c *Client) repoURL(owner, repo string, elem ...string) string {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/api/v1/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+	for _, e := range elem {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+// do sends req, with the token if any, and decodes the JSON response into v.
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) error {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+	return restapi.Do(ctx, c.HTTPClient, req, v)
+}
+
+// Release returns the release of the repo owner/repo tagged tag.
+func (c *Client) Release(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	req, err := http.NewRequest("GET", c.repoURL(owner, repo, "releases", "tags", tag), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Release
+	if err := c.do(ctx, req, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Attach attaches the contents of r as a file called name to the release of
+// the repo owner/repo with ID id.
+func (c *Client) Attach(ctx context.Context, owner, repo string, id int64, name string, r io.Reader) (*Attachment, error) {
+	u := c.repoURL(owner, repo, "releases", strconv.FormatInt(id, 10), "assets") + "?" + url.Values{"name": {name}}.Encode()
+	req, err := restapi.NewUpload(u, "attachment", name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var a Attachment
+	if err := c.do(ctx, req, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
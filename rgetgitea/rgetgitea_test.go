@@ -0,0 +1,81 @@
+package rgetgitea
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRelease = `{
+  "id": 7,
+  "tag_name": "v2.0",
+  "tarball_url": "https://gitea.com/philips/releases-test/archive/v2.0.tar.gz",
+  "zipball_url": "https://gitea.com/philips/releases-test/archive/v2.0.zip",
+  "assets": [
+    {"id": 1, "name": "rget-linux", "browser_download_url": "https://gitea.com/philips/releases-test/releases/download/v2.0/rget-linux"}
+  ]
+}`
+
+func TestClient(t *testing.T) {
+	var attached, name string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		const repo = "/api/v1/repos/philips/releases-test"
+		switch {
+		case r.Method == "GET" && r.URL.Path == repo+"/releases/tags/v2.0":
+			w.Write([]byte(testRelease))
+		case r.Method == "POST" && r.URL.Path == repo+"/releases/7/assets":
+			f, _, err := r.FormFile("attachment")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(f)
+			attached, name = string(data), r.URL.Query().Get("name")
+			w.Write([]byte(`{"id": 2, "name": "SHA256SUMS", "browser_download_url": "https://gitea.com/philips/releases-test/releases/download/v2.0/SHA256SUMS"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: ts.URL, Token: "secret"}
+
+	rel, err := c.Release(ctx, "philips", "releases-test", "v2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://gitea.com/philips/releases-test/releases/download/v2.0/rget-linux",
+		"https://gitea.com/philips/releases-test/archive/v2.0.tar.gz",
+		"https://gitea.com/philips/releases-test/archive/v2.0.zip",
+	}
+	if got := rel.URLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("release URLs %v want %v", got, want)
+	}
+
+	a, err := c.Attach(ctx, "philips", "releases-test", rel.ID, "SHA256SUMS", strings.NewReader("sums"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attached != "sums" || name != "SHA256SUMS" || a.ID != 2 {
+		t.Errorf("attached %q as %q: %+v", attached, name, a)
+	}
+
+	if _, err := c.Release(ctx, "philips", "releases-test", "v3.0"); err == nil {
+		t.Errorf("missing release found")
+	}
+	if _, err := (&Client{BaseURL: ts.URL}).Release(ctx, "philips", "releases-test", "v2.0"); err == nil {
+		t.Errorf("release found without a token")
+	}
+}
@@ -0,0 +1,146 @@
+// Package rgetgitlab calls the parts of the GitLab REST API needed to
+// publish the sums of a release.
+package rgetgitlab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.merklecounty.com/rget/internal/restapi"
+)
+
+// Client calls the API of a GitLab instance.
+type Client struct {
+	// BaseURL of the instance, for example https://gitlab.com.
+	BaseURL string
+
+	// Token is a personal, project or group access token sent with every
+	// request if not empty.
+	Token string
+
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Release is a GitLab release and its assets.
+type Release struct {
+	TagName string `json:"tag_name"`
+	Assets  struct {
+		Sources []Source `json:"sources"`
+		Links   []Link   `json:"links"`
+	} `json:"assets"`
+}
+
+// Source is a source archive of a release.
+type Source struct {
+	Format string `json:"format"`
+	URL    string `json:"url"`
+}
+
+// Link is a link asset of a release. DirectAssetURL is its permanent URL
+// under the release.
+type Link struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+// URLs returns the URLs of the assets of r: the links, by their permanent
+// URLs where known, and the source archives.
+func (r *Release) URLs() []string {
+	var urls []string
+	for _, l := range r.Assets.Links {
+		if l.DirectAssetURL != "" {
+			urls = append(urls, l.DirectAssetURL)
+		} else {
+			urls = append(urls, l.URL)
+		}
+	}
+	for _, s := range r.Assets.Sources {
+		urls = append(urls, s.URL)
+	}
+	return urls
+}
+
+// projectURL returns the API URL of elem of project, a path such as
+// group/project or a numeric ID.
+func (c *Client) projectURL(project string, elem ...string) string {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/api/v4/projects/" + url.PathEscape(project)
+	for _, e := range elem {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+// do sends req, with the token if any, and decodes the JSON response into v.
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) error {
+	if c.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.Token)
+	}
+	return restapi.Do(ctx, c.HTTPClient, req, v)
+}
+
+// Release returns the release of project tagged tag.
+func (c *Client) Release(ctx context.Context, project, tag string) (*Release, error) {
+	req, err := http.NewRequest("GET", c.projectURL(project, "releases", tag), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Release
+	if err := c.do(ctx, req, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Upload uploads the contents of r as a file called name to project and
+// returns its URL.
+func (c *Client) Upload(ctx context.Context, project, name string, r io.Reader) (string, error) {
+	req, err := restapi.NewUpload(c.projectURL(project, "uploads"), "file", name, r)
+	if err != nil {
+		return "", err
+	}
+
+	var upload struct {
+		URL      string `json:"url"`
+		FullPath string `json:"full_path"`
+	}
+	if err := c.do(ctx, req, &upload); err != nil {
+		return "", err
+	}
+
+	// Instances before full_path was added return the URL relative to
+	// the project
+	base := strings.TrimSuffix(c.BaseURL, "/")
+	if upload.FullPath != "" {
+		return base + upload.FullPath, nil
+	}
+	return base + "/" + project + upload.URL, nil
+}
+
+// CreateLink adds a link asset called name to the release of project tagged
+// tag. The asset is served from the release under filepath.
+func (c *Client) CreateLink(ctx context.Context, project, tag, name, assetURL, filepath string) (*Link, error) {
+	form := url.Values{
+		"name":      {name},
+		"url":       {assetURL},
+		"filepath":  {filepath},
+		"link_type": {"other"},
+	}
+	req, err := http.NewRequest("POST", c.projectURL(project, "releases", tag, "assets", "links"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var l Link
+	if err := c.do(ctx, req, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
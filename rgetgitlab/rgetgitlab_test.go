@@ -0,0 +1,97 @@
+package rgetgitlab
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRelease = `{
+  "tag_name": "v2.0",
+  "assets": {
+    "sources": [
+      {"format": "zip", "url": "https://gitlab.com/philips/releases-test/-/archive/v2.0/releases-test-v2.0.zip"}
+    ],
+    "links": [
+      {"id": 1, "name": "rget-linux", "url": "https://example.com/rget-linux", "direct_asset_url": "https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/rget-linux"},
+      {"id": 2, "name": "notes", "url": "https://example.com/notes"}
+    ]
+  }
+}`
+
+func TestClient(t *testing.T) {
+	var uploaded string
+	var link map[string][]string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		const project = "/api/v4/projects/philips%2Freleases-test"
+		switch path := r.URL.EscapedPath(); {
+		case r.Method == "GET" && path == project+"/releases/v2.0":
+			w.Write([]byte(testRelease))
+		case r.Method == "POST" && path == project+"/uploads":
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(f)
+			uploaded = string(data)
+			w.Write([]byte(`{"url": "/uploads/abc/SHA256SUMS", "full_path": "/philips/releases-test/uploads/abc/SHA256SUMS"}`))
+		case r.Method == "POST" && path == project+"/releases/v2.0/assets/links":
+			r.ParseForm()
+			link = r.PostForm
+			w.Write([]byte(`{"id": 3, "name": "SHA256SUMS", "direct_asset_url": "https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/SHA256SUMS"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: ts.URL, Token: "secret"}
+
+	rel, err := c.Release(ctx, "philips/releases-test", "v2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/rget-linux",
+		"https://example.com/notes",
+		"https://gitlab.com/philips/releases-test/-/archive/v2.0/releases-test-v2.0.zip",
+	}
+	if got := rel.URLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("release URLs %v want %v", got, want)
+	}
+
+	u, err := c.Upload(ctx, "philips/releases-test", "SHA256SUMS", strings.NewReader("sums"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded != "sums" || u != ts.URL+"/philips/releases-test/uploads/abc/SHA256SUMS" {
+		t.Errorf("uploaded %q to %v", uploaded, u)
+	}
+
+	l, err := c.CreateLink(ctx, "philips/releases-test", "v2.0", "SHA256SUMS", u, "/SHA256SUMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.ID != 3 || link["url"][0] != u || link["filepath"][0] != "/SHA256SUMS" {
+		t.Errorf("link %+v created with %v", l, link)
+	}
+
+	if _, err := c.Release(ctx, "philips/releases-test", "v3.0"); err == nil {
+		t.Errorf("missing release found")
+	}
+	if _, err := (&Client{BaseURL: ts.URL}).Release(ctx, "philips/releases-test", "v2.0"); err == nil {
+		t.Errorf("release found without a token")
+	}
+}
@@ -0,0 +1,383 @@
+// Package rgetgomod records Go module versions served by a module proxy as
+// releases: the .info, .mod and .zip files of a version are hashed with
+// SHA-256, and the zip and go.mod also with the h1 hash of go.sum so the
+// record can be cross-checked against a checksum database.
+package rgetgomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// DefaultProxy is the module proxy used if Client.Proxy is empty.
+const DefaultProxy = "https://proxy.golang.org"
+
+// Limits of the files of a module version, those of the go command. A zip
+// is limited in size both as downloaded and unzipped.
+const (
+	maxInfo     = 1 << 20
+	maxMod      = 16 << 20
+	maxZip      = 500 << 20
+	maxUnzipped = 500 << 20
+)
+
+// maxFile are the limits of the files of a module version by extension.
+var maxFile = map[string]int64{".info": maxInfo, ".mod": maxMod, ".zip": maxZip}
+
+// Files are the extensions of the files of a module version.
+var Files = []string{".info", ".mod", ".zip"}
+
+// Version is a version of a module.
+type Version struct {
+	Path    string
+	Version string
+}
+
+// ParseVersion parses s, a module path and version such as
+// golang.org/x/text@v0.3.2.
+func ParseVersion(s string) (Version, error) {
+	i := strings.LastIndexByte(s, '@')
+	if i < 0 {
+		return Version{}, fmt.Errorf("%q is not MODULE@VERSION", s)
+	}
+	mv := Version{Path: s[:i], Version: s[i+1:]}
+	if _, err := EscapePath(mv.Path); err != nil {
+		return Version{}, err
+	}
+	if !strings.HasPrefix(mv.Version, "v") || strings.ContainsAny(mv.Version, "/ ") {
+		return Version{}, fmt.Errorf("invalid version %q", mv.Version)
+	}
+	return mv, nil
+}
+
+func (mv Version) String() string {
+	return mv.Path + "@" + mv.Version
+}
+
+// EscapePath escapes the upper case letters of a module path or version
+// the way module proxies and checksum databases expect, as "!" followed by
+// the lower case letter.
+func EscapePath(path string) (string, error) {
+	if path == "" || strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return "", fmt.Errorf("invalid module path %q", path)
+	}
+
+	var b strings.Builder
+	for _, r := range path {
+		switch {
+		case r == '!' || r == ' ' || r == '@' || r < 0x20 || r > 0x7e:
+			return "", fmt.Errorf("invalid module path %q", path)
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte('!')
+			b.WriteRune(r + 'a' - 'A')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
+
+// UnescapePath reverses EscapePath.
+func UnescapePath(escaped string) (string, error) {
+	var b strings.Builder
+	bang := false
+	for _, r := range escaped {
+		switch {
+		case bang && r >= 'a' && r <= 'z':
+			b.WriteRune(r + 'A' - 'a')
+			bang = false
+		case bang || r >= 'A' && r <= 'Z':
+			return "", fmt.Errorf("invalid escaped module path %q", escaped)
+		case r == '!':
+			bang = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if bang {
+		return "", fmt.Errorf("invalid escaped module path %q", escaped)
+	}
+	return b.String(), nil
+}
+
+// VersionOf returns the module version the file at target, on
+// proxy.golang.org, is of.
+func VersionOf(target string) (Version, error) {
+	m, err := rgetwellknown.GomodMatches(target)
+	if err != nil {
+		return Version{}, err
+	}
+	p, err := UnescapePath(m["module"])
+	if err != nil {
+		return Version{}, err
+	}
+	v, err := UnescapePath(m["tag"])
+	if err != nil {
+		return Version{}, err
+	}
+	return ParseVersion(p + "@" + v)
+}
+
+// escaped returns the escaped path and version of mv.
+func (mv Version) escaped() (string, string) {
+	p, _ := EscapePath(mv.Path)
+	v, _ := EscapePath(mv.Version)
+	return p, v
+}
+
+// URL returns the URL of the file of mv with extension ext, one of Files,
+// on proxy.
+func (mv Version) URL(proxy, ext string) string {
+	p, v := mv.escaped()
+	return strings.TrimSuffix(proxy, "/") + "/" + p + "/@v/" + v + ext
+}
+
+// RecordURL returns the URL mv is recorded as a release of, that of its zip
+// on DefaultProxy whichever proxy it is downloaded from.
+func (mv Version) RecordURL() string {
+	return mv.URL(DefaultProxy, ".zip")
+}
+
+// Module is a downloaded module version.
+type Module struct {
+	Version Version
+
+	// Files by extension.
+	Files map[string][]byte
+}
+
+// Client downloads modules from a proxy and looks them up in a checksum
+// database.
+type Client struct {
+	// Proxy is the base URL of the module proxy, DefaultProxy if empty.
+	Proxy string
+
+	// SumDB is the base URL of the checksum database and SumDBKey the
+	// key verifying its signed tree heads, DefaultSumDB and
+	// DefaultSumDBKey if empty.
+	SumDB    string
+	SumDBKey string
+
+	// MaxZip is the largest zip downloaded, the 500 MB limit of the go
+	// command if zero. Servers downloading the modules of others may
+	// want less.
+	MaxZip int64
+
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) proxy() string {
+	if c.Proxy != "" {
+		return c.Proxy
+	}
+	return DefaultProxy
+}
+
+// get downloads u, reading at most max bytes.
+func (c *Client) get(ctx context.Context, u string, max int64) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, c.client(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", u, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%v: larger than %d bytes", u, max)
+	}
+	return data, nil
+}
+
+// Download downloads the files of mv from the proxy.
+func (c *Client) Download(ctx context.Context, mv Version) (*Module, error) {
+	m := &Module{Version: mv, Files: make(map[string][]byte)}
+	for _, ext := range Files {
+		max := maxFile[ext]
+		if ext == ".zip" && c.MaxZip > 0 {
+			max = c.MaxZip
+		}
+		data, err := c.get(ctx, mv.URL(c.proxy(), ext), max)
+		if err != nil {
+			return nil, err
+		}
+		m.Files[ext] = data
+	}
+	return m, nil
+}
+
+// ReleaseSums returns the sums of the module version the file at durl is
+// of, made from its files downloaded from Proxy, and the URL of its zip
+// there. ok is false if durl is not the URL of a file of a module version.
+func (c *Client) ReleaseSums(ctx context.Context, durl string) (sums rgethash.URLSumList, sumsURL string, ok bool, err error) {
+	mv, err := VersionOf(durl)
+	if err != nil {
+		return nil, "", false, nil
+	}
+	m, err := c.Download(ctx, mv)
+	if err != nil {
+		return nil, "", true, err
+	}
+	sums, err = m.Sums()
+	return sums, mv.URL(c.proxy(), ".zip"), true, err
+}
+
+// ParseSums returns ok false, module versions have no sums files.
+func (c *Client) ParseSums(loc string, data []byte) (sums rgethash.URLSumList, ok bool, err error) {
+	return nil, false, nil
+}
+
+// H1 returns the go.sum hashes of the zip and go.mod of m.
+func (m *Module) H1() (zipHash, modHash []byte, err error) {
+	z := m.Files[".zip"]
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", m.Version, err)
+	}
+
+	// archive/zip refuses to read more than the size a file declares
+	files := make(map[string]*zip.File)
+	var names []string
+	var size uint64
+	for _, f := range zr.File {
+		if _, ok := files[f.Name]; ok {
+			return nil, nil, fmt.Errorf("%v: duplicate file %q in zip", m.Version, f.Name)
+		}
+		size += f.UncompressedSize64
+		if size > maxUnzipped {
+			return nil, nil, fmt.Errorf("%v: zip larger than %d bytes unzipped", m.Version, maxUnzipped)
+		}
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	zipHash, err = hash1(names, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", m.Version, err)
+	}
+
+	modHash, err = hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(m.Files[".mod"])), nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", m.Version, err)
+	}
+	return zipHash, modHash, nil
+}
+
+// hash1 is the h1 hash of go.sum: the SHA-256 of a sha256sum style summary
+// of the files sorted by name.
+func hash1(names []string, open func(string) (io.ReadCloser, error)) ([]byte, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		if strings.Contains(name, "\n") {
+			return nil, errors.New("file names with newlines are not supported")
+		}
+		r, err := open(name)
+		if err != nil {
+			return nil, err
+		}
+		hf := sha256.New()
+		_, err = io.Copy(hf, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%x  %s\n", hf.Sum(nil), name)
+	}
+	return h.Sum(nil), nil
+}
+
+// H1String formats a hash returned by Module.H1 as go.sum does.
+func H1String(sum []byte) string {
+	return "h1:" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// Sums returns the sums list m is recorded with: the SHA-256 of each of its
+// files, named after the file as in the proxy URL, followed by the h1 hashes
+// of the zip and go.mod, named after the files with ".h1" appended.
+func (m *Module) Sums() (rgethash.URLSumList, error) {
+	_, v := m.Version.escaped()
+
+	var sums rgethash.URLSumList
+	for _, ext := range Files {
+		sum := sha256.Sum256(m.Files[ext])
+		sums = append(sums, rgethash.URLSum{URL: v + ext, Sum: sum[:], Algorithm: rgethash.SHA256})
+	}
+
+	zipHash, modHash, err := m.H1()
+	if err != nil {
+		return nil, err
+	}
+	sums = append(sums,
+		rgethash.URLSum{URL: v + ".zip.h1", Sum: zipHash, Algorithm: rgethash.SHA256},
+		rgethash.URLSum{URL: v + ".mod.h1", Sum: modHash, Algorithm: rgethash.SHA256},
+	)
+	return sums, nil
+}
+
+// CheckGoSum checks the lines of data, in the format of go.sum, for the
+// version of m against its h1 hashes. The line for the zip of m must be
+// present, that of its go.mod is checked if it is.
+func (m *Module) CheckGoSum(data []byte) error {
+	zipHash, modHash, err := m.H1()
+	if err != nil {
+		return err
+	}
+	want := map[string]string{
+		m.Version.Version:             H1String(zipHash),
+		m.Version.Version + "/go.mod": H1String(modHash),
+	}
+
+	zipFound := false
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 3 || f[0] != m.Version.Path {
+			continue
+		}
+		h, ok := want[f[1]]
+		if !ok {
+			continue
+		}
+		if f[2] != h {
+			return fmt.Errorf("%v %v: checksum mismatch: have %v want %v", f[0], f[1], h, f[2])
+		}
+		zipFound = zipFound || f[1] == m.Version.Version
+	}
+	if !zipFound {
+		return fmt.Errorf("no checksum for the zip of %v, only its go.mod could be checked", m.Version)
+	}
+	return nil
+}
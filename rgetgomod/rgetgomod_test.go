@@ -0,0 +1,167 @@
+package rgetgomod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.merklecounty.com/rget/internal/testutil"
+)
+
+func TestParseVersion(t *testing.T) {
+	for ti, tt := range []struct {
+		s       string
+		url     string
+		wantErr bool
+	}{
+		{"golang.org/x/text@v0.3.2", "https://proxy.golang.org/golang.org/x/text/@v/v0.3.2.zip", false},
+		{"github.com/BurntSushi/toml@v0.3.1", "https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v0.3.1.zip", false},
+		{"golang.org/x/text", "", true},
+		{"golang.org/x/text@0.3.2", "", true},
+		{"golang.org/x/te!xt@v0.3.2", "", true},
+		{"@v0.3.2", "", true},
+	} {
+		mv, err := ParseVersion(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+			continue
+		}
+		if err == nil && mv.URL(DefaultProxy, ".zip") != tt.url {
+			t.Errorf("%d: URL %v want %v", ti, mv.URL(DefaultProxy, ".zip"), tt.url)
+		}
+		if got, verr := VersionOf(tt.url); err == nil && (verr != nil || got != mv) {
+			t.Errorf("%d: version of URL %v: %v", ti, got, verr)
+		}
+	}
+
+	for _, u := range []string{
+		"https://proxy.golang.org/golang.org/x/text/@v/v0.3.2.txt",
+		"https://proxy.golang.org/github.com/!!burnt/toml/@v/v0.3.1.zip",
+		"https://github.com/merklecounty/rget/releases/download/v0.0.6/SHA256SUMS",
+	} {
+		if _, err := VersionOf(u); err == nil {
+			t.Errorf("version of %v", u)
+		}
+	}
+}
+
+func TestModule(t *testing.T) {
+	mv := Version{Path: "example.com/Tool", Version: "v1.0.0"}
+	files := testutil.ModuleFiles(t, mv.Path, mv.Version)
+	m := &Module{Version: mv, Files: files}
+	zipHash, modHash, err := m.H1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum := fmt.Sprintf("%v %v %v\n%v %v/go.mod %v\n", mv.Path, mv.Version, H1String(zipHash), mv.Path, mv.Version, H1String(modHash))
+
+	const id = 280
+	db := testutil.NewSumDB(t, 300, func(i int) []byte {
+		if i == id {
+			return []byte(goSum)
+		}
+		return []byte(fmt.Sprintf("example.com/m%d v1.0.0/go.mod h1:%d\n", i, i))
+	})
+
+	lookupID := id
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch p := r.URL.Path; {
+		case strings.HasPrefix(p, "/proxy/example.com/!tool/@v/v1.0.0."):
+			data, ok := files[strings.TrimPrefix(p, "/proxy/example.com/!tool/@v/v1.0.0")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case p == "/sumdb/lookup/example.com/!tool@v1.0.0":
+			fmt.Fprintf(w, "%d\n%s\n%s", lookupID, db.Records[id], db.Signed)
+		case strings.HasPrefix(p, "/sumdb/tile/8/"):
+			data, ok := db.Tile(strings.TrimPrefix(p, "/sumdb/tile/8/"))
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := &Client{Proxy: ts.URL + "/proxy", SumDB: ts.URL + "/sumdb", SumDBKey: db.Key}
+
+	got, err := c.Download(ctx, mv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums, err := got.Sums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"v1.0.0.info", "v1.0.0.mod", "v1.0.0.zip", "v1.0.0.zip.h1", "v1.0.0.mod.h1"}
+	for i, name := range names {
+		if i >= len(sums) || sums[i].URL != name {
+			t.Fatalf("sums %v", sums.SHA256SumFile())
+		}
+	}
+	if !bytes.Equal(sums[3].Sum, zipHash) || !bytes.Equal(sums[4].Sum, modHash) {
+		t.Errorf("h1 sums %x %x", sums[3].Sum, sums[4].Sum)
+	}
+
+	// The sums of a plain proxy URL are made the same way
+	relSums, sumsURL, ok, err := c.ReleaseSums(ctx, mv.RecordURL())
+	if !ok || err != nil || !reflect.DeepEqual(relSums, sums) {
+		t.Errorf("release sums %v %v: %v", relSums, ok, err)
+	}
+	if sumsURL != ts.URL+"/proxy/example.com/!tool/@v/v1.0.0.zip" {
+		t.Errorf("release sums read from %v", sumsURL)
+	}
+	if _, _, ok, _ := c.ReleaseSums(ctx, "https://github.com/merklecounty/rget/releases/download/v0.0.6/rget.tar.gz"); ok {
+		t.Errorf("release sums of a GitHub release")
+	}
+
+	record, err := c.Lookup(ctx, mv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.CheckGoSum(record); err != nil {
+		t.Errorf("sumdb record: %v", err)
+	}
+
+	// Only the go.mod line of a go.sum does not check the zip
+	modOnly := fmt.Sprintf("%v %v/go.mod %v\n", mv.Path, mv.Version, H1String(modHash))
+	if err := got.CheckGoSum([]byte(modOnly)); err == nil {
+		t.Errorf("go.sum without the zip line accepted")
+	}
+
+	// A different module version does not match the record
+	other := &Module{Version: mv, Files: testutil.ModuleFiles(t, mv.Path, "v1.0.1")}
+	if err := other.CheckGoSum(record); err == nil {
+		t.Errorf("different zip matched")
+	}
+
+	// The record must be the one at its id in the signed tree
+	lookupID = 5
+	if _, err := c.Lookup(ctx, mv); err == nil {
+		t.Errorf("record at the wrong id accepted")
+	}
+	lookupID = id
+
+	// Zips over the limit are not downloaded
+	small := *c
+	small.MaxZip = 10
+	if _, err := small.Download(ctx, mv); err == nil {
+		t.Errorf("zip over MaxZip downloaded")
+	}
+
+	c.SumDBKey = testutil.NewSumDB(t, 1, func(int) []byte { return []byte("x\n") }).Key
+	if _, err := c.Lookup(ctx, mv); err == nil {
+		t.Errorf("tree head signed by another key accepted")
+	}
+}
@@ -0,0 +1,277 @@
+package rgetgomod
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// DefaultSumDB and DefaultSumDBKey are the checksum database used by the go
+// command and the key verifying its signed tree heads.
+const (
+	DefaultSumDB    = "https://sum.golang.org"
+	DefaultSumDBKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ky2bXYGvKxDLGOQyF7X"
+)
+
+// tileHeight is the height of the tiles of the checksum database tree.
+const tileHeight = 8
+
+// maxLookup is the largest lookup response read.
+const maxLookup = 1 << 20
+
+func (c *Client) sumdb() (string, string) {
+	db, key := c.SumDB, c.SumDBKey
+	if db == "" {
+		db = DefaultSumDB
+	}
+	if key == "" {
+		key = DefaultSumDBKey
+	}
+	return strings.TrimSuffix(db, "/"), key
+}
+
+// Lookup returns the go.sum lines of mv in the checksum database. The
+// lines are only returned once the tree head is verified with SumDBKey and
+// the record of mv is proven to be in the tree through its tiles.
+func (c *Client) Lookup(ctx context.Context, mv Version) ([]byte, error) {
+	db, key := c.sumdb()
+	p, v := mv.escaped()
+
+	data, err := c.get(ctx, db+"/lookup/"+p+"@"+v, maxLookup)
+	if err != nil {
+		return nil, err
+	}
+
+	// A record id line, the record and the signed tree head
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, fmt.Errorf("%v: malformed lookup", mv)
+	}
+	id, err := strconv.ParseInt(string(data[:i]), 10, 64)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("%v: malformed record id", mv)
+	}
+	data = data[i+1:]
+	i = bytes.Index(data, []byte("\n\n"))
+	if i < 0 {
+		return nil, fmt.Errorf("%v: malformed lookup", mv)
+	}
+	record, signed := data[:i+1], data[i+2:]
+
+	text, err := verifyNote(signed, key)
+	if err != nil {
+		return nil, fmt.Errorf("%v: tree head: %v", mv, err)
+	}
+	size, root, err := parseTree(text)
+	if err != nil {
+		return nil, fmt.Errorf("%v: tree head: %v", mv, err)
+	}
+	if id >= size {
+		return nil, fmt.Errorf("%v: record %d is not in tree of size %d", mv, id, size)
+	}
+
+	t := &tileReader{ctx: ctx, c: c, db: db, size: size, tiles: make(map[string][]byte)}
+	got, err := t.treeHash(0, size, id, recordHash(record))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", mv, err)
+	}
+	if !bytes.Equal(got, root) {
+		return nil, fmt.Errorf("%v: record %d is not in the signed tree", mv, id)
+	}
+	return record, nil
+}
+
+// verifyNote returns the text of the signed note msg if it is signed by the
+// verifier key, in the "name+hash+keydata" format of the go command.
+func verifyNote(msg []byte, key string) ([]byte, error) {
+	f := strings.SplitN(key, "+", 3)
+	if len(f) != 3 {
+		return nil, errors.New("malformed verifier key")
+	}
+	name := f[0]
+	keyHash, err1 := hex.DecodeString(f[1])
+	keyData, err2 := base64.StdEncoding.DecodeString(f[2])
+	if err1 != nil || err2 != nil || len(keyHash) != 4 || len(keyData) != 1+ed25519.PublicKeySize || keyData[0] != 1 {
+		return nil, errors.New("malformed verifier key")
+	}
+	h := sha256.Sum256(append([]byte(name+"\n"), keyData...))
+	if !bytes.Equal(h[:4], keyHash) {
+		return nil, errors.New("verifier key hash does not match")
+	}
+	pub := ed25519.PublicKey(keyData[1:])
+
+	i := bytes.LastIndex(msg, []byte("\n\n"))
+	if i < 0 {
+		return nil, errors.New("malformed note")
+	}
+	text, sigs := msg[:i+1], msg[i+2:]
+
+	const prefix = "— "
+	for _, line := range strings.Split(strings.TrimSuffix(string(sigs), "\n"), "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			return nil, errors.New("malformed note signature")
+		}
+		f := strings.Fields(strings.TrimPrefix(line, prefix))
+		if len(f) != 2 || f[0] != name {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(f[1])
+		if err != nil || len(sig) < 4 || !bytes.Equal(sig[:4], keyHash) {
+			continue
+		}
+		if ed25519.Verify(pub, text, sig[4:]) {
+			return text, nil
+		}
+	}
+	return nil, fmt.Errorf("no valid signature by %v", name)
+}
+
+// parseTree parses the text of a signed tree head.
+func parseTree(text []byte) (int64, []byte, error) {
+	lines := strings.Split(string(text), "\n")
+	if len(lines) < 4 || lines[0] != "go.sum database tree" {
+		return 0, nil, errors.New("malformed tree")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, nil, errors.New("malformed tree size")
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(root) != sha256.Size {
+		return 0, nil, errors.New("malformed tree hash")
+	}
+	return size, root, nil
+}
+
+// recordHash and nodeHash are the RFC 6962 hashes of the tree.
+func recordHash(data []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, data...))
+	return h[:]
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// tileReader reads the hashes of a tree of size leaves from the tiles of a
+// checksum database.
+type tileReader struct {
+	ctx   context.Context
+	c     *Client
+	db    string
+	size  int64
+	tiles map[string][]byte
+}
+
+// treeHash returns the hash of the leaves [lo, hi) of the tree with the
+// record hash of leaf id being leaf. Subtrees without id are read from the
+// tiles so the result is the tree hash only if leaf is the record at id.
+func (t *tileReader) treeHash(lo, hi, id int64, leaf []byte) ([]byte, error) {
+	n := hi - lo
+	if (id < lo || id >= hi) && n&(n-1) == 0 {
+		level := uint(0)
+		for int64(1)<<level < n {
+			level++
+		}
+		return t.hash(level, lo>>level)
+	}
+	if n == 1 {
+		return leaf, nil
+	}
+
+	k := int64(1)
+	for k*2 < n {
+		k *= 2
+	}
+	left, err := t.treeHash(lo, lo+k, id, leaf)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.treeHash(lo+k, hi, id, leaf)
+	if err != nil {
+		return nil, err
+	}
+	return nodeHash(left, right), nil
+}
+
+// hash returns the hash of the complete subtree at level with index n,
+// computed from the hashes of the tile holding its leaves at the level of
+// the tile.
+func (t *tileReader) hash(level uint, n int64) ([]byte, error) {
+	tileLevel := level / tileHeight
+	sub := level % tileHeight
+	start := n << sub
+	count := int64(1) << sub
+
+	width := int64(1) << tileHeight
+	index := start / width
+	if w := t.size>>(tileLevel*tileHeight) - index*width; w < width {
+		width = w
+	}
+	data, err := t.tile(tileLevel, index, width)
+	if err != nil {
+		return nil, err
+	}
+
+	off := start - index*(int64(1)<<tileHeight)
+	if (off+count)*sha256.Size > int64(len(data)) {
+		return nil, fmt.Errorf("tile %d/%d too short", tileLevel, index)
+	}
+	var hashes [][]byte
+	for i := off; i < off+count; i++ {
+		hashes = append(hashes, data[i*sha256.Size:(i+1)*sha256.Size])
+	}
+	for len(hashes) > 1 {
+		var next [][]byte
+		for i := 0; i < len(hashes); i += 2 {
+			next = append(next, nodeHash(hashes[i], hashes[i+1]))
+		}
+		hashes = next
+	}
+	return hashes[0], nil
+}
+
+// tile returns the hashes of the tile at level with index n, which has
+// width hashes.
+func (t *tileReader) tile(level uint, n, width int64) ([]byte, error) {
+	p := fmt.Sprintf("%v/tile/%d/%d/%s", t.db, tileHeight, level, tileIndex(n))
+	if width < 1<<tileHeight {
+		p += fmt.Sprintf(".p/%d", width)
+	}
+	if data, ok := t.tiles[p]; ok {
+		return data, nil
+	}
+
+	data, err := t.c.get(t.ctx, p, width*sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != width*sha256.Size {
+		return nil, fmt.Errorf("%v: %d bytes", p, len(data))
+	}
+	t.tiles[p] = data
+	return data, nil
+}
+
+// tileIndex formats n as a tile path, in groups of three digits of which all
+// but the last are prefixed with "x", for example x001/x234/067.
+func tileIndex(n int64) string {
+	s := fmt.Sprintf("%03d", n%1000)
+	for n >= 1000 {
+		n /= 1000
+		s = fmt.Sprintf("x%03d/%s", n%1000, s)
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package rgethash
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// Algorithm is a digest algorithm that sums files are made with. The zero
+// value is SHA256, the algorithm of sums files recorded before others were
+// supported. Other methods must only be called on supported algorithms.
+type Algorithm string
+
+// Supported algorithms.
+const (
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+)
+
+// Algorithms are the supported algorithms in the default order their sums
+// files are looked for.
+var Algorithms = []Algorithm{SHA256, SHA512}
+
+type algorithmInfo struct {
+	file string // conventional name of the sums file
+	tag  string // tag of BSD style lines
+	size int
+	new  func() hash.Hash
+}
+
+var algorithms = map[Algorithm]algorithmInfo{
+	SHA256: {"SHA256SUMS", "SHA256", sha256.Size, sha256.New},
+	SHA512: {"SHA512SUMS", "SHA512", sha512.Size, sha512.New},
+}
+
+func (a Algorithm) info() algorithmInfo {
+	if a == "" {
+		a = SHA256
+	}
+	return algorithms[a]
+}
+
+// ParseAlgorithm returns the supported algorithm called name, SHA256 if name
+// is empty.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		return SHA256, nil
+	}
+	if _, ok := algorithms[Algorithm(name)]; !ok {
+		return "", fmt.Errorf("unsupported digest algorithm %q", name)
+	}
+	return Algorithm(name), nil
+}
+
+// AlgorithmForFile returns the algorithm of the sums file conventionally
+// called name, for example SHA512 for SHA512SUMS.
+func AlgorithmForFile(name string) (Algorithm, error) {
+	for _, a := range Algorithms {
+		if a.SumFile() == name {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sums file %q", name)
+}
+
+// SumFile returns the conventional name of sums files made with a.
+func (a Algorithm) SumFile() string {
+	return a.info().file
+}
+
+// Size returns the size of digests made with a in bytes.
+func (a Algorithm) Size() int {
+	return a.info().size
+}
+
+// New returns a new hash.Hash computing a.
+func (a Algorithm) New() hash.Hash {
+	return a.info().new()
+}
+
+// Digest returns the digest of r made with a.
+func (a Algorithm) Digest(r io.Reader) ([]byte, error) {
+	h := a.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Domain returns the domain labels for the Merkle tree root of a sums file
+// made with a. They are the labels of RootDomain followed by a label naming
+// the algorithm, which SHA256 omits to keep the domains recorded before
+// other algorithms were supported.
+func (a Algorithm) Domain(root []byte) string {
+	if a == "" || a == SHA256 {
+		return RootDomain(root)
+	}
+	return RootDomain(root) + "." + string(a)
+}
+
+// RecordDomain returns the record domain, less the service host, of a sums
+// file made with alg whose Merkle tree root is root, for the release of
+// target under scheme. Under Scheme1 the algorithm label is always present.
+// Domains too long for DNS, even before the service host is added, are an
+// error.
+func RecordDomain(root []byte, alg Algorithm, target string, scheme rgetwellknown.Scheme) (string, error) {
+	release, err := rgetwellknown.SchemeDomain(target, scheme)
+	if err != nil {
+		return "", err
+	}
+
+	var domain string
+	if scheme == rgetwellknown.Scheme0 {
+		domain = alg.Domain(root) + "." + release
+	} else {
+		if alg == "" {
+			alg = SHA256
+		}
+		domain = RootDomain(root) + "." + string(alg) + "." + release
+	}
+	if err := rgetwellknown.CheckDomain(domain); err != nil {
+		return "", err
+	}
+	return domain, nil
+}
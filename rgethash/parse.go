@@ -0,0 +1,161 @@
+package rgethash
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoSums is returned by ParseSumFile for a file without entries.
+var ErrNoSums = errors.New("no entries in sums file")
+
+// ParseError reports a line of a sums file that cannot be parsed.
+type ParseError struct {
+	Line int // line number, starting at 1
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ParseSHA256SumFile parses a sums file made with SHA256, see ParseSumFile.
+func ParseSHA256SumFile(file string) (URLSumList, error) {
+	return ParseSumFile(file, SHA256)
+}
+
+// ParseSumFile parses a sums file made with alg: the output of sha256sum or
+// sha512sum, in either text or binary mode, or with --tag, or of BSD sha256
+// or sha512. Escaped names are unescaped and lines may end in CRLF. Any line
+// that cannot be parsed, a digest of the wrong length or a name listed twice
+// is an error, as it would silently change the Merkle root.
+func ParseSumFile(file string, alg Algorithm) (URLSumList, error) {
+	lines := strings.Split(file, "\n")
+	// The final newline does not start another line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	list := URLSumList{}
+	seen := make(map[string]int)
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		u, err := parseSumLine(line, alg)
+		if err != nil {
+			return nil, &ParseError{Line: i + 1, Err: err}
+		}
+		if first, ok := seen[u.URL]; ok {
+			return nil, &ParseError{Line: i + 1, Err: fmt.Errorf("duplicate entry for %q, first on line %d", u.URL, first)}
+		}
+		seen[u.URL] = i + 1
+
+		list = append(list, u)
+	}
+
+	if len(list) == 0 {
+		return nil, ErrNoSums
+	}
+	return list, nil
+}
+
+// parseSumLine parses a "DIGEST  NAME", "DIGEST *NAME" or
+// "TAG (NAME) = DIGEST" line, each optionally prefixed with a backslash if
+// NAME is escaped.
+func parseSumLine(line string, alg Algorithm) (URLSum, error) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	for _, a := range Algorithms {
+		if a != alg && strings.HasPrefix(line, a.info().tag+" (") {
+			return URLSum{}, fmt.Errorf("%s line in a %s sums file", a.info().tag, alg.info().tag)
+		}
+	}
+
+	var digest, name string
+	if tag := alg.info().tag + " ("; strings.HasPrefix(line, tag) {
+		rest := strings.TrimPrefix(line, tag)
+		i := strings.LastIndex(rest, ") = ")
+		if i < 0 {
+			return URLSum{}, fmt.Errorf(`expected "%sNAME) = DIGEST"`, tag)
+		}
+		name, digest = rest[:i], rest[i+len(") = "):]
+	} else {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 || i+1 == len(line) || (line[i+1] != ' ' && line[i+1] != '*') {
+			return URLSum{}, errors.New(`expected "DIGEST  NAME" or "DIGEST *NAME"`)
+		}
+		digest, name = line[:i], line[i+2:]
+	}
+
+	sum, err := parseDigest(digest, alg)
+	if err != nil {
+		return URLSum{}, err
+	}
+
+	if escaped {
+		name, err = unescapeName(name)
+		if err != nil {
+			return URLSum{}, err
+		}
+	}
+	if name == "" {
+		return URLSum{}, errors.New("empty name")
+	}
+
+	return URLSum{URL: name, Sum: sum, Algorithm: alg}, nil
+}
+
+func parseDigest(digest string, alg Algorithm) ([]byte, error) {
+	if n := hex.EncodedLen(alg.Size()); len(digest) != n {
+		return nil, fmt.Errorf("digest %q has %d hex digits, want %d", digest, len(digest), n)
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("digest %q: %v", digest, err)
+	}
+	return sum, nil
+}
+
+// unescapeName reverses the escaping sha256sum applies to names containing
+// a backslash, newline or carriage return.
+func unescapeName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' {
+			b.WriteByte(name[i])
+			continue
+		}
+
+		i++
+		if i == len(name) {
+			return "", fmt.Errorf("name %q ends in an escape", name)
+		}
+		switch name[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("name %q has unknown escape \\%c", name, name[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// escapeName escapes name as sha256sum does, reporting whether it had to.
+func escapeName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	return r.Replace(name), true
+}
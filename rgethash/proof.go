@@ -0,0 +1,116 @@
+package rgethash
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// Proof is an RFC 6962 inclusion proof that an entry of a URLSumList is a
+// leaf of the tree whose root is the list's SchemeRoot under Scheme. It lets
+// a single file be checked against a recorded list without the rest of the
+// list. Only schemes whose leaves bind the names of the entries are used, so
+// the proof covers Name as well as Sum.
+type Proof struct {
+	Name      string   `json:"name"` // name of the entry in the list
+	Sum       []byte   `json:"sum"`  // digest of the entry
+	LeafIndex int64    `json:"leaf_index"`
+	TreeSize  int64    `json:"tree_size"`
+	AuditPath [][]byte `json:"audit_path"`
+
+	// Algorithm Sum is made with, omitted for SHA256.
+	Algorithm Algorithm `json:"algorithm,omitempty"`
+
+	// Scheme is the record domain scheme of the tree.
+	Scheme rgetwellknown.Scheme `json:"scheme"`
+}
+
+// leaf returns the Merkle tree leaf of the entry name with digest sum under
+// scheme. Names are followed by the digest, whose length is fixed by the
+// algorithm, so no two entries share a leaf.
+func leaf(scheme rgetwellknown.Scheme, name string, sum []byte) []byte {
+	if !scheme.BindsNames() {
+		return sum
+	}
+	return append([]byte(name), sum...)
+}
+
+func (s URLSumList) tree(scheme rgetwellknown.Scheme) *merkle.InMemoryMerkleTree {
+	t := merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher)
+
+	for _, u := range s {
+		t.AddLeaf(leaf(scheme, u.URL, u.Sum))
+	}
+	return t
+}
+
+// InclusionProof returns the proof for the first entry of the list named
+// name, under rgetwellknown.CurrentScheme.
+func (s URLSumList) InclusionProof(name string) (*Proof, error) {
+	for i, u := range s {
+		if u.URL != name {
+			continue
+		}
+
+		t := s.tree(rgetwellknown.CurrentScheme)
+		p := &Proof{
+			Name:      u.URL,
+			Sum:       u.Sum,
+			LeafIndex: int64(i),
+			TreeSize:  t.LeafCount(),
+			AuditPath: [][]byte{},
+			Algorithm: s.Algorithm(),
+			Scheme:    rgetwellknown.CurrentScheme,
+		}
+		if p.Algorithm == SHA256 {
+			p.Algorithm = ""
+		}
+		// The in memory tree numbers its leaves from 1
+		for _, e := range t.PathToCurrentRoot(int64(i) + 1) {
+			p.AuditPath = append(p.AuditPath, e.Value.Hash())
+		}
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("no entry for %q in sums list", name)
+}
+
+// leafHash returns the hash of the leaf of the entry, refusing schemes whose
+// leaves do not bind the name of the entry.
+func (p *Proof) leafHash() ([]byte, error) {
+	if p.Scheme == "" || !p.Scheme.BindsNames() {
+		return nil, fmt.Errorf("proof of scheme %q does not cover the name of its entry", p.Scheme)
+	}
+	return rfc6962.DefaultHasher.HashLeaf(leaf(p.Scheme, p.Name, p.Sum)), nil
+}
+
+// Root returns the Merkle tree root that the audit path leads to from the
+// entry.
+func (p *Proof) Root() ([]byte, error) {
+	h, err := p.leafHash()
+	if err != nil {
+		return nil, err
+	}
+	return merkle.NewLogVerifier(rfc6962.DefaultHasher).RootFromInclusionProof(
+		p.LeafIndex, p.TreeSize, p.AuditPath, h)
+}
+
+// Verify checks that the entry is in the tree with the given root.
+func (p *Proof) Verify(root []byte) error {
+	h, err := p.leafHash()
+	if err != nil {
+		return err
+	}
+	return merkle.NewLogVerifier(rfc6962.DefaultHasher).VerifyInclusionProof(
+		p.LeafIndex, p.TreeSize, p.AuditPath, root, h)
+}
+
+// RootDomain returns the domain labels for a Merkle tree root, as Domain
+// does for the root of a list.
+func RootDomain(root []byte) string {
+	return fmt.Sprintf("%s.%s", hex.EncodeToString(root[:16]), hex.EncodeToString(root[16:]))
+}
@@ -12,8 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/trillian/merkle"
-	"github.com/google/trillian/merkle/rfc6962"
 	"golang.org/x/net/context/ctxhttp"
 
 	"go.merklecounty.com/rget/autocert"
@@ -24,10 +22,16 @@ import (
 type URLSum struct {
 	URL string
 	Sum []byte
+
+	// Algorithm Sum is made with, the zero value is SHA256.
+	Algorithm Algorithm
 }
 
 type URLSumList []URLSum
 
+// FromSHA256SumFile parses file leniently, keeping whatever fmt.Sscanf makes
+// of lines it does not understand. It is only kept to compute the domains of
+// sums files recorded before ParseSHA256SumFile, use that instead.
 func FromSHA256SumFile(file string) URLSumList {
 	s := bufio.NewScanner(strings.NewReader(file))
 
@@ -60,14 +64,27 @@ func (s *URLSumList) AddURL(url string) error {
 		return err
 	}
 
-	*s = append(*s, URLSum{url, sum})
+	*s = append(*s, URLSum{URL: url, Sum: sum, Algorithm: SHA256})
 
 	return nil
 }
 
+// Algorithm returns the algorithm the digests of the list are made with.
+func (s URLSumList) Algorithm() Algorithm {
+	if len(s) == 0 || s[0].Algorithm == "" {
+		return SHA256
+	}
+	return s[0].Algorithm
+}
+
 func (s URLSumList) Domain() string {
-	root := s.MerkleRoot()
-	return fmt.Sprintf("%s.%s", hex.EncodeToString(root[:16]), hex.EncodeToString(root[16:]))
+	return s.Algorithm().Domain(s.MerkleRoot())
+}
+
+// RecordDomain returns the record domain of the list, less the service host,
+// for the release of target under scheme.
+func (s URLSumList) RecordDomain(target string, scheme rgetwellknown.Scheme) (string, error) {
+	return RecordDomain(s.SchemeRoot(scheme), s.Algorithm(), target, scheme)
 }
 
 func (s URLSumList) ShortDomain() string {
@@ -95,19 +112,81 @@ func (s URLSumList) SumExists(sum []byte) bool {
 	return false
 }
 
-func (s URLSumList) MerkleRoot() []byte {
-	t := merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher)
-
+// FindSum returns the first entry of the list with the digest sum.
+func (s URLSumList) FindSum(sum []byte) *URLSum {
 	for _, u := range s {
-		t.AddLeaf(u.Sum)
+		if bytes.Equal(sum, u.Sum) {
+			return &u
+		}
+	}
+
+	return nil
+}
+
+// MismatchError reports a digest that does not match the entry recorded for
+// a download in a URLSumList.
+type MismatchError struct {
+	Names    []string // names the download may be listed under
+	Expected *URLSum  // entry recorded for Names, nil if there is none
+	Actual   *URLSum  // entry with the digest of the download, nil if there is none
+	Sum      []byte   // digest of the download
+}
+
+func (e *MismatchError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("no entry for %q in sums list", e.Names)
+	}
+	if e.Actual == nil {
+		return fmt.Sprintf("expected %x for %q got %x which is not in the sums list",
+			e.Expected.Sum, e.Expected.URL, e.Sum)
+	}
+	return fmt.Sprintf("expected %x for %q got %x which is the entry for %q",
+		e.Expected.Sum, e.Expected.URL, e.Sum, e.Actual.URL)
+}
+
+// CheckSum verifies that the first entry listed under one of names has the
+// digest sum. A *MismatchError is returned otherwise.
+func (s URLSumList) CheckSum(names []string, sum []byte) error {
+	var expected *URLSum
+	for _, n := range names {
+		if expected = s.GetURLSum(n); expected != nil {
+			break
+		}
+	}
+
+	if expected != nil && bytes.Equal(expected.Sum, sum) {
+		return nil
+	}
+
+	return &MismatchError{
+		Names:    names,
+		Expected: expected,
+		Actual:   s.FindSum(sum),
+		Sum:      sum,
 	}
-	return t.CurrentRoot().Hash()
 }
 
+// MerkleRoot returns the root of the tree whose leaves are the digests of
+// the list, that of records made before Scheme2.
+func (s URLSumList) MerkleRoot() []byte {
+	return s.SchemeRoot(rgetwellknown.Scheme1)
+}
+
+// SchemeRoot returns the root of the tree of the list under scheme.
+func (s URLSumList) SchemeRoot(scheme rgetwellknown.Scheme) []byte {
+	return s.tree(scheme).CurrentRoot().Hash()
+}
+
+// SHA256SumFile returns the list in the format of sha256sum, or of the
+// matching tool for lists made with other algorithms.
 func (s URLSumList) SHA256SumFile() string {
 	var buf bytes.Buffer
 	for _, u := range s {
-		buf.Write([]byte(fmt.Sprintf("%x  %s\n", u.Sum, u.URL)))
+		name, escaped := escapeName(u.URL)
+		if escaped {
+			buf.WriteByte('\\')
+		}
+		buf.Write([]byte(fmt.Sprintf("%x  %s\n", u.Sum, name)))
 	}
 	return buf.String()
 
@@ -136,18 +215,19 @@ func init() {
 }
 
 // HostPolicyFunc returns a HostPolicy that returns Policies
-// based on Sums that exist in the GitCache repo
-func HostPolicyFunc(pubgc *gitcache.GitCache) autocert.HostPolicy {
+// based on Sums that exist in the GitCache repo for the recorder serving
+// under service, such as rgetwellknown.PublicServiceHost
+func HostPolicyFunc(pubgc *gitcache.GitCache, service string) autocert.HostPolicy {
 	hostPolicy := func(ctx context.Context, host string) (autocert.Policy, error) {
-		if rgetwellknown.PublicServiceHost == host {
+		if service == host {
 			return autocert.Policy{CommonName: host}, nil
 		}
 
-		if !strings.HasSuffix(host, "."+rgetwellknown.PublicServiceHost) {
-			return autocert.Policy{}, fmt.Errorf("not in TLD %v", rgetwellknown.PublicServiceHost)
+		if !strings.HasSuffix(host, "."+service) {
+			return autocert.Policy{}, fmt.Errorf("not in TLD %v", service)
 		}
 
-		key := strings.TrimSuffix(host, "."+rgetwellknown.PublicServiceHost)
+		key := strings.TrimSuffix(host, "."+service)
 
 		// Reduce to the shortest domain
 		parts := strings.Split(key, ".")
@@ -172,13 +252,26 @@ func HostPolicyFunc(pubgc *gitcache.GitCache) autocert.HostPolicy {
 			return autocert.Policy{}, err
 		}
 
-		sums := FromSHA256SumFile(string(content))
+		// Digest lengths tell the algorithms apart. Fall back to the
+		// lenient parser for sums recorded before submissions had to
+		// parse cleanly.
+		var sums URLSumList
+		for _, a := range Algorithms {
+			if sums, err = ParseSumFile(string(content), a); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			sums = FromSHA256SumFile(string(content))
+		}
 
+		// The root of the record is that of the scheme it was made with
+		root := sums.SchemeRoot(rgetwellknown.DomainScheme(matches[0]))
 		p := autocert.Policy{
-			CommonName: sums.ShortDomain() + "." + rgetwellknown.PublicServiceHost,
+			CommonName: hex.EncodeToString(root[:16]) + "." + service,
 			DNSNames: []string{
-				matches[0] + "." + rgetwellknown.PublicServiceHost,
-				sums.Domain() + "." + rgetwellknown.PublicServiceHost,
+				matches[0] + "." + service,
+				sums.Algorithm().Domain(root) + "." + service,
 			},
 		}
 
@@ -1,11 +1,17 @@
 package rgethash
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"go.merklecounty.com/rget/autocert"
@@ -39,6 +45,75 @@ func TestDomain(t *testing.T) {
 	}
 }
 
+func TestRecordDomainLength(t *testing.T) {
+	sums := URLSumList{{URL: "file.txt", Sum: make([]byte, 32), Algorithm: SHA256}}
+	long := strings.Repeat("a", 60)
+
+	testCases := []struct {
+		target  string
+		wantErr bool
+	}{
+		{"https://github.com/org/repo/releases/download/v1.0/file.txt", false},
+		{"https://github.com/" + long + "/" + long + "/releases/download/" + long + "/file.txt", true},
+	}
+
+	for ti, tt := range testCases {
+		for _, scheme := range rgetwellknown.Schemes {
+			d, err := sums.RecordDomain(tt.target, scheme)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%d: scheme %v: want error %v got %v", ti, scheme, tt.wantErr, err)
+			}
+			if len(d) > 253 {
+				t.Errorf("%d: scheme %v: domain of %d bytes", ti, scheme, len(d))
+			}
+		}
+	}
+}
+
+func TestCheckSum(t *testing.T) {
+	linux := []byte{1}
+	darwin := []byte{2}
+	ul := URLSumList{
+		{URL: "rget-linux.tar.gz", Sum: linux},
+		{URL: "rget-darwin.tar.gz", Sum: darwin},
+	}
+
+	testCases := []struct {
+		names    []string
+		sum      []byte
+		expected string
+		actual   string
+		wantErr  bool
+	}{
+		{[]string{"https://example.com/rget-linux.tar.gz", "rget-linux.tar.gz"}, linux, "", "", false},
+		// linux tarball served under the darwin URL
+		{[]string{"https://example.com/rget-darwin.tar.gz", "rget-darwin.tar.gz"}, linux, "rget-darwin.tar.gz", "rget-linux.tar.gz", true},
+		{[]string{"rget-darwin.tar.gz"}, []byte{3}, "rget-darwin.tar.gz", "", true},
+		{[]string{"rget-windows.zip"}, linux, "", "rget-linux.tar.gz", true},
+	}
+
+	for ti, tt := range testCases {
+		err := ul.CheckSum(tt.names, tt.sum)
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", ti, err)
+			}
+			continue
+		}
+
+		mm, ok := err.(*MismatchError)
+		if !ok {
+			t.Fatalf("%d: want *MismatchError got %v", ti, err)
+		}
+		if mm.Expected != nil && mm.Expected.URL != tt.expected || mm.Expected == nil && tt.expected != "" {
+			t.Errorf("%d: expected entry %v want %v", ti, mm.Expected, tt.expected)
+		}
+		if mm.Actual != nil && mm.Actual.URL != tt.actual || mm.Actual == nil && tt.actual != "" {
+			t.Errorf("%d: actual entry %v want %v", ti, mm.Actual, tt.actual)
+		}
+	}
+}
+
 func TestHostPolicy(t *testing.T) {
 	testCases := []struct {
 		put     bool
@@ -64,6 +139,34 @@ func TestHostPolicy(t *testing.T) {
 			},
 			nil,
 		},
+		// Recorded under Scheme1
+		{
+			true,
+			"ba441c80c69590a9325401e9faf07aa5.af4d754fd125ff3f8ca1b740d4284c8c.sha256.e-v0-2e0-2e7.rget.merklecounty.github.com.1",
+			[]byte("d4cb7fc206cbd147b3397c1e1b88513831c9780fc9675bebc300112365979465  rget-v0.0.7-linux-arm.tar.gz\n"),
+			autocert.Policy{
+				CommonName: "ba441c80c69590a9325401e9faf07aa5.recorder.merklecounty.com",
+				DNSNames: []string{
+					"ba441c80c69590a9325401e9faf07aa5.af4d754fd125ff3f8ca1b740d4284c8c.sha256.e-v0-2e0-2e7.rget.merklecounty.github.com.1.recorder.merklecounty.com",
+					"ba441c80c69590a9325401e9faf07aa5.af4d754fd125ff3f8ca1b740d4284c8c.recorder.merklecounty.com",
+				},
+			},
+			nil,
+		},
+		// Recorded under Scheme2, whose leaves bind the names
+		{
+			true,
+			"39cdd14d48e5c051e5b819717a565483.393875c5324bb4ceb5eedf039e9b4209.sha256.e-v0-2e0-2e8.rget.merklecounty.github.com.2",
+			[]byte("d4cb7fc206cbd147b3397c1e1b88513831c9780fc9675bebc300112365979465  rget-v0.0.8-linux-arm.tar.gz\n"),
+			autocert.Policy{
+				CommonName: "39cdd14d48e5c051e5b819717a565483.recorder.merklecounty.com",
+				DNSNames: []string{
+					"39cdd14d48e5c051e5b819717a565483.393875c5324bb4ceb5eedf039e9b4209.sha256.e-v0-2e0-2e8.rget.merklecounty.github.com.2.recorder.merklecounty.com",
+					"39cdd14d48e5c051e5b819717a565483.393875c5324bb4ceb5eedf039e9b4209.recorder.merklecounty.com",
+				},
+			},
+			nil,
+		},
 		{
 			false,
 			"67568fff9faa4928c8bd4dd4aeb1a31d.74e766a21475966740ecbf12685e6821cd83cf8f413393d30d53626c5f17f9ae.af90c0ab70bffa127b54cdb82d3c1499.v0-0-6.rget.merklecounty.github.com",
@@ -88,7 +191,7 @@ func TestHostPolicy(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	hp := HostPolicyFunc(gc)
+	hp := HostPolicyFunc(gc, rgetwellknown.PublicServiceHost)
 
 	ctx := context.Background()
 
@@ -125,4 +228,167 @@ func TestHostPolicy(t *testing.T) {
 		}
 
 	}
+
+	// Another recorder serves the same records under its own host
+	staging := HostPolicyFunc(gc, "staging.example.com")
+	p, err := staging(ctx, testCases[0].input+".staging.example.com")
+	if err != nil || p.CommonName != "cd83cf8f413393d30d53626c5f17f9ae.staging.example.com" {
+		t.Errorf("staging policy %v: %v", p, err)
+	}
+	if _, err := staging(ctx, testCases[0].input+"."+rgetwellknown.PublicServiceHost); err == nil {
+		t.Errorf("staging policy accepted the public recorder")
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	var ul URLSumList
+	for i := 0; i < 7; i++ {
+		sum := sha256.Sum256([]byte{byte(i)})
+		ul = append(ul, URLSum{URL: fmt.Sprintf("file%d", i), Sum: sum[:]})
+	}
+	root := ul.SchemeRoot(rgetwellknown.CurrentScheme)
+
+	for ti, u := range ul {
+		p, err := ul.InclusionProof(u.URL)
+		if err != nil {
+			t.Fatalf("%d: %v", ti, err)
+		}
+		if err := p.Verify(root); err != nil {
+			t.Errorf("%d: %v", ti, err)
+		}
+		r, err := p.Root()
+		if err != nil || !bytes.Equal(r, root) {
+			t.Errorf("%d: root %x != %x: %v", ti, r, root, err)
+		}
+
+		// A proof must not carry over to another digest or name
+		other := ul[(ti+1)%len(ul)]
+		q := *p
+		q.Sum = other.Sum
+		if err := q.Verify(root); err == nil {
+			t.Errorf("%d: proof verified for another digest", ti)
+		}
+		q = *p
+		q.Name = other.URL
+		if err := q.Verify(root); err == nil {
+			t.Errorf("%d: proof verified for another name", ti)
+		}
+
+		// Nor be taken for a proof of a digest only tree
+		q = *p
+		q.Scheme = rgetwellknown.Scheme1
+		if _, err := q.Root(); err == nil {
+			t.Errorf("%d: proof of a digest only tree accepted", ti)
+		}
+	}
+
+	if _, err := ul.InclusionProof("missing"); err == nil {
+		t.Errorf("proof for missing entry")
+	}
+}
+
+func TestParseSHA256SumFile(t *testing.T) {
+	a := "d4cb7fc206cbd147b3397c1e1b88513831c9780fc9675bebc300112365979465"
+	b := "7239591ab580c911738130cc62d8a5cd9c6c05c79fa7abfdf32bad0d68a70844"
+
+	testCases := []struct {
+		file  string
+		names []string
+		line  int // line of the parse error, 0 for none
+	}{
+		{a + "  a.tar.gz\n" + b + "  b.tar.gz\n", []string{"a.tar.gz", "b.tar.gz"}, 0},
+		{a + " *a.tar.gz\r\n" + b + " *b.tar.gz", []string{"a.tar.gz", "b.tar.gz"}, 0},
+		{a + "  name with spaces\n\n", []string{"name with spaces"}, 0},
+		{`\` + a + `  back\\slash\nnewline`, []string{"back\\slash\nnewline"}, 0},
+		{"SHA256 (a (1).tar.gz) = " + a + "\n", []string{"a (1).tar.gz"}, 0},
+		{strings.ToUpper(a) + "  a.tar.gz\n", []string{"a.tar.gz"}, 0},
+		{a + "  a.tar.gz\n" + b[:40] + "  b.tar.gz\n", nil, 2},
+		{a + "  a.tar.gz\n" + b + "  a.tar.gz\n", nil, 2},
+		{a + " a.tar.gz\n", nil, 1},
+		{a + "\n", nil, 1},
+		{"\n" + `\` + a + `  bad\escape`, nil, 2},
+		{"SHA256 (a.tar.gz)=" + a, nil, 1},
+		{"# comment\n" + a + "  a.tar.gz\n", nil, 1},
+	}
+
+	for ti, tt := range testCases {
+		ul, err := ParseSHA256SumFile(tt.file)
+		if tt.line != 0 {
+			pe, ok := err.(*ParseError)
+			if !ok || pe.Line != tt.line {
+				t.Errorf("%d: want error on line %d got %v", ti, tt.line, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", ti, err)
+			continue
+		}
+
+		var names []string
+		for _, u := range ul {
+			names = append(names, u.URL)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%d: names %q != %q", ti, names, tt.names)
+		}
+
+		rt, err := ParseSHA256SumFile(ul.SHA256SumFile())
+		if err != nil || !reflect.DeepEqual(rt, ul) {
+			t.Errorf("%d: round trip %v != %v: %v", ti, rt, ul, err)
+		}
+	}
+
+	if _, err := ParseSHA256SumFile("\n"); err != ErrNoSums {
+		t.Errorf("empty file: want %v got %v", ErrNoSums, err)
+	}
+}
+
+func TestParseSumFileAlgorithms(t *testing.T) {
+	sum256 := sha256.Sum256([]byte("a"))
+	sum512 := sha512.Sum512([]byte("a"))
+	a256 := hex.EncodeToString(sum256[:])
+	a512 := hex.EncodeToString(sum512[:])
+
+	testCases := []struct {
+		file    string
+		alg     Algorithm
+		wantErr bool
+	}{
+		{a512 + "  a.tar.gz\n", SHA512, false},
+		{"SHA512 (a.tar.gz) = " + a512 + "\n", SHA512, false},
+		{a256 + "  a.tar.gz\n", SHA512, true},
+		{a512 + "  a.tar.gz\n", SHA256, true},
+		{"SHA256 (a.tar.gz) = " + a256 + "\n", SHA512, true},
+	}
+
+	for ti, tt := range testCases {
+		ul, err := ParseSumFile(tt.file, tt.alg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%d: expected error", ti)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", ti, err)
+			continue
+		}
+
+		if ul.Algorithm() != tt.alg {
+			t.Errorf("%d: algorithm %v != %v", ti, ul.Algorithm(), tt.alg)
+		}
+		if want := RootDomain(ul.MerkleRoot()) + ".sha512"; ul.Domain() != want {
+			t.Errorf("%d: domain %v != %v", ti, ul.Domain(), want)
+		}
+	}
+
+	for _, a := range Algorithms {
+		if fa, err := AlgorithmForFile(a.SumFile()); err != nil || fa != a {
+			t.Errorf("%v: sums file %v is for %v: %v", a, a.SumFile(), fa, err)
+		}
+	}
+	if _, err := AlgorithmForFile("MD5SUMS"); err == nil {
+		t.Errorf("MD5SUMS is not supported")
+	}
 }
@@ -0,0 +1,79 @@
+package rgetoci
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistry is the registry of references that do not name one.
+const DefaultRegistry = "docker.io"
+
+// dockerHubHost serves the API of DefaultRegistry.
+const dockerHubHost = "registry-1.docker.io"
+
+var (
+	repositoryRE = regexp.MustCompile(`^[a-z0-9._\-]+(?:/[a-z0-9._\-]+)*$`)
+	tagRE        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]{0,127}$`)
+)
+
+// Reference names a tag of an image repository, for example
+// ghcr.io/merklecounty/rget:v0.0.6.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses s as a reference the way docker does: without a
+// registry it is of DefaultRegistry, whose single component repositories
+// are under library/, and without a tag it is of latest. References by
+// digest are refused as they need no recording.
+func ParseReference(s string) (Reference, error) {
+	var r Reference
+
+	rest := s
+	if i := strings.IndexByte(s, '/'); i >= 0 && (strings.ContainsAny(s[:i], ".:") || s[:i] == "localhost") {
+		r.Registry, rest = strings.ToLower(s[:i]), s[i+1:]
+	} else {
+		r.Registry = DefaultRegistry
+	}
+	if strings.Contains(rest, "@") {
+		return Reference{}, errors.New("references by digest already name a single image, use a tag")
+	}
+
+	r.Repository, r.Tag = rest, "latest"
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		r.Repository, r.Tag = rest[:i], rest[i+1:]
+	}
+	if r.Registry == DefaultRegistry && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+
+	if !repositoryRE.MatchString(r.Repository) {
+		return Reference{}, fmt.Errorf("invalid repository %q in %q", r.Repository, s)
+	}
+	if !tagRE.MatchString(r.Tag) {
+		return Reference{}, fmt.Errorf("invalid tag %q in %q", r.Tag, s)
+	}
+	return r, nil
+}
+
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// host returns the host serving the API of the registry of r.
+func (r Reference) host() string {
+	if r.Registry == DefaultRegistry {
+		return dockerHubHost
+	}
+	return r.Registry
+}
+
+// URL returns the registry API URL of the manifest of r. Images are
+// recorded as releases of that URL.
+func (r Reference) URL() string {
+	return "https://" + r.host() + "/v2/" + r.Repository + "/manifests/" + r.Tag
+}
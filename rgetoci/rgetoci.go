@@ -0,0 +1,261 @@
+// Package rgetoci resolves the tags of OCI and Docker images to the digests
+// of their manifests so they can be recorded and verified like the files of
+// a release.
+package rgetoci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"go.merklecounty.com/rget/rgethash"
+)
+
+// Media types of manifests.
+const (
+	MediaTypeImageIndex         = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest      = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// maxManifest is the largest manifest read.
+const maxManifest = 4 << 20
+
+// digestPrefix starts the only digests supported, those made with SHA-256.
+const digestPrefix = "sha256:"
+
+// acceptTypes are the manifests asked for, lists first so the manifests of
+// every platform are recorded.
+var acceptTypes = []string{
+	MediaTypeImageIndex,
+	MediaTypeDockerManifestList,
+	MediaTypeImageManifest,
+	MediaTypeDockerManifest,
+}
+
+// Platform is the platform a manifest of a list is for.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Descriptor is an entry of a manifest list.
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Image is what a tag resolved to.
+type Image struct {
+	Reference Reference
+
+	// Digest and MediaType of the manifest the tag points at, a list for
+	// images of several platforms.
+	Digest    string
+	MediaType string
+
+	// Manifests of the list, empty for single manifests.
+	Manifests []Descriptor
+}
+
+// Sums returns the digests of img as a sums list: that of the manifest the
+// tag points at, named after the tag, followed by those of the manifests of
+// the list, each named after its platform or, without a platform of its
+// own, after its digest.
+func (img *Image) Sums() (rgethash.URLSumList, error) {
+	sum, err := parseDigest(img.Digest)
+	if err != nil {
+		return nil, err
+	}
+	sums := rgethash.URLSumList{{URL: img.Reference.Tag, Sum: sum, Algorithm: rgethash.SHA256}}
+
+	names := make(map[string]bool)
+	for _, d := range img.Manifests {
+		sum, err := parseDigest(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		name := d.Digest
+		if d.Platform != nil && !names[d.Platform.String()] {
+			name = d.Platform.String()
+		}
+		names[name] = true
+		sums = append(sums, rgethash.URLSum{URL: name, Sum: sum, Algorithm: rgethash.SHA256})
+	}
+	return sums, nil
+}
+
+// parseDigest returns the SHA-256 of a digest.
+func parseDigest(digest string) ([]byte, error) {
+	if !strings.HasPrefix(digest, digestPrefix) {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	sum, err := hex.DecodeString(strings.TrimPrefix(digest, digestPrefix))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return sum, nil
+}
+
+// Client calls the v2 API of registries.
+type Client struct {
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Resolve returns the image ref points at. The digest of the manifest is
+// computed from its contents rather than taken from the registry.
+func (c *Client) Resolve(ctx context.Context, ref Reference) (*Image, error) {
+	resp, err := c.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifest))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	img := &Image{
+		Reference: ref,
+		Digest:    digestPrefix + hex.EncodeToString(sum[:]),
+		MediaType: resp.Header.Get("Content-Type"),
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" && d != img.Digest {
+		return nil, fmt.Errorf("%v: registry digest %v does not match manifest digest %v", ref, d, img.Digest)
+	}
+
+	var m struct {
+		MediaType string       `json:"mediaType"`
+		Manifests []Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%v: invalid manifest: %v", ref, err)
+	}
+	if m.MediaType != "" {
+		img.MediaType = m.MediaType
+	}
+
+	switch img.MediaType {
+	case MediaTypeImageIndex, MediaTypeDockerManifestList:
+		img.Manifests = m.Manifests
+	case MediaTypeImageManifest, MediaTypeDockerManifest:
+	default:
+		return nil, fmt.Errorf("%v: unsupported manifest type %q", ref, img.MediaType)
+	}
+	return img, nil
+}
+
+// get requests the manifest of ref, authenticating anonymously if the
+// registry asks for a token.
+func (c *Client) get(ctx context.Context, ref Reference) (*http.Response, error) {
+	resp, err := c.getManifest(ctx, ref, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := c.token(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = c.getManifest(ctx, ref, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %v", ref.URL(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Client) getManifest(ctx context.Context, ref Reference, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", ref.URL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(acceptTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return ctxhttp.Do(ctx, c.client(), req)
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token gets an anonymous token to pull ref from the realm of a Bearer
+// challenge.
+func (c *Client) token(ctx context.Context, ref Reference, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("%v: unauthorized", ref.URL())
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	if !strings.HasPrefix(params["realm"], "https://") {
+		return "", fmt.Errorf("%v: invalid token realm %q", ref.URL(), params["realm"])
+	}
+	if params["scope"] == "" {
+		params["scope"] = "repository:" + ref.Repository + ":pull"
+	}
+
+	q := url.Values{"scope": {params["scope"]}}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	resp, err := ctxhttp.Get(ctx, c.client(), params["realm"]+"?"+q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%v: token: %v", ref.URL(), resp.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("%v: token: %v", ref.URL(), err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	return t.Token, nil
+}
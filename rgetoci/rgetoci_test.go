@@ -0,0 +1,134 @@
+package rgetoci
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testIndex = `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.oci.image.index.v1+json",
+  "manifests": [
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:1111111111111111111111111111111111111111111111111111111111111111", "size": 1, "platform": {"architecture": "amd64", "os": "linux"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:2222222222222222222222222222222222222222222222222222222222222222", "size": 1, "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:3333333333333333333333333333333333333333333333333333333333333333", "size": 1, "platform": {"architecture": "amd64", "os": "linux"}}
+  ]
+}`
+
+func TestParseReference(t *testing.T) {
+	for ti, tt := range []struct {
+		ref     string
+		want    Reference
+		wantErr bool
+	}{
+		{"ghcr.io/merklecounty/rget:v0.0.6", Reference{"ghcr.io", "merklecounty/rget", "v0.0.6"}, false},
+		{"localhost:5000/tool", Reference{"localhost:5000", "tool", "latest"}, false},
+		{"nginx:1.17", Reference{DefaultRegistry, "library/nginx", "1.17"}, false},
+		{"org/tool:v1", Reference{DefaultRegistry, "org/tool", "v1"}, false},
+		{"ghcr.io/org/tool@sha256:1111", Reference{}, true},
+		{"ghcr.io/Org/tool:v1", Reference{}, true},
+		{"ghcr.io/org/tool:-v1", Reference{}, true},
+	} {
+		ref, err := ParseReference(tt.ref)
+		if (err != nil) != tt.wantErr || ref != tt.want {
+			t.Errorf("%d: %v parsed to %+v: %v", ti, tt.ref, ref, err)
+		}
+	}
+
+	ref, _ := ParseReference("nginx")
+	if u := ref.URL(); u != "https://registry-1.docker.io/v2/library/nginx/manifests/latest" {
+		t.Errorf("docker hub URL %v", u)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var ts *httptest.Server
+	digestHeader := ""
+	ts = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("scope") != "repository:org/tool:pull" {
+				http.Error(w, "bad scope", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token": "pull"}`))
+		case "/v2/org/tool/manifests/v1.0":
+			if r.Header.Get("Authorization") != "Bearer pull" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test"`, ts.URL))
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), MediaTypeImageIndex) {
+				http.Error(w, "not acceptable", http.StatusNotAcceptable)
+				return
+			}
+			w.Header().Set("Content-Type", MediaTypeImageIndex)
+			if digestHeader != "" {
+				w.Header().Set("Docker-Content-Digest", digestHeader)
+			}
+			w.Write([]byte(testIndex))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ref, err := ParseReference(strings.TrimPrefix(ts.URL, "https://") + "/org/tool:v1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := &Client{HTTPClient: ts.Client()}
+	img, err := c.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(testIndex)))
+	if img.Digest != indexDigest || img.MediaType != MediaTypeImageIndex || len(img.Manifests) != 3 {
+		t.Errorf("resolved to %+v", img)
+	}
+
+	sums, err := img.Sums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"v1.0",
+		"linux/amd64",
+		"linux/arm64/v8",
+		"sha256:3333333333333333333333333333333333333333333333333333333333333333",
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("sums %v", sums.SHA256SumFile())
+	}
+	for i, name := range want {
+		if sums[i].URL != name {
+			t.Errorf("%d: sum named %v want %v", i, sums[i].URL, name)
+		}
+	}
+	if fmt.Sprintf("sha256:%x", sums[0].Sum) != indexDigest {
+		t.Errorf("index sum %x", sums[0].Sum)
+	}
+
+	// The registry digest must match the manifest
+	digestHeader = indexDigest
+	if _, err := c.Resolve(ctx, ref); err != nil {
+		t.Errorf("matching registry digest: %v", err)
+	}
+	digestHeader = "sha256:" + strings.Repeat("0", 64)
+	if _, err := c.Resolve(ctx, ref); err == nil {
+		t.Errorf("mismatched registry digest accepted")
+	}
+
+	ref.Tag = "v2.0"
+	if _, err := c.Resolve(ctx, ref); err == nil {
+		t.Errorf("missing tag resolved")
+	}
+}
@@ -0,0 +1,374 @@
+// Package rgetregistry records versions of packages of the PyPI and npm
+// registries as releases. The files of a version are listed by the metadata
+// of the registry, and the sums list of a version is made from the SHA-256
+// of each file, which the recorder checks by hashing the files.
+package rgetregistry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// Default registry URLs, used if those of Client are empty.
+const (
+	DefaultPyPI = "https://pypi.org"
+	DefaultNPM  = "https://registry.npmjs.org"
+)
+
+// Limits of the metadata and files read.
+const (
+	maxMetadata = 16 << 20
+	maxFiles    = 1000
+	maxFile     = 1 << 30
+	maxTotal    = 4 << 30
+)
+
+// Version is a version of a package of a registry.
+type Version struct {
+	Registry rgetwellknown.Registry
+	Package  string
+	Version  string
+}
+
+// ParseVersion parses s, a package name and version of registry such as
+// left-pad@1.3.0. The names of PyPI packages are normalized.
+func ParseVersion(registry, s string) (Version, error) {
+	r := rgetwellknown.Registry(registry)
+	if r != rgetwellknown.PyPI && r != rgetwellknown.NPM {
+		return Version{}, fmt.Errorf("unknown registry %q", registry)
+	}
+
+	// Scoped npm packages start with "@"
+	i := strings.LastIndexByte(s, '@')
+	if i <= 0 {
+		return Version{}, fmt.Errorf("%q is not PACKAGE@VERSION", s)
+	}
+	pv := Version{Registry: r, Package: s[:i], Version: s[i+1:]}
+	if pv.Version == "" || strings.ContainsAny(pv.Version, "/ ") || strings.ContainsAny(pv.Package, " ?#") {
+		return Version{}, fmt.Errorf("%q is not PACKAGE@VERSION", s)
+	}
+	if r == rgetwellknown.PyPI {
+		pv.Package = rgetwellknown.NormalizePyPI(pv.Package)
+	}
+	return pv, nil
+}
+
+// VersionOf returns the package version the file at target is of.
+func VersionOf(target string) (Version, error) {
+	r, m, err := rgetwellknown.RegistryMatches(target)
+	if err != nil {
+		return Version{}, err
+	}
+	return Version{Registry: r, Package: m["package"], Version: m["tag"]}, nil
+}
+
+func (pv Version) String() string {
+	return pv.Package + "@" + pv.Version
+}
+
+// File is a file of a package version.
+type File struct {
+	Name string
+	URL  string
+
+	// SHA256 is the digest listed by the registry, nil if it lists none.
+	SHA256 []byte
+
+	// Integrity and SHA1 are the other digests listed by npm, a
+	// subresource integrity string and the SHA-1, checked when the file
+	// is hashed.
+	Integrity string
+	SHA1      []byte
+}
+
+// Release is the files of a package version, sorted by name.
+type Release struct {
+	Version Version
+
+	// URL is the metadata the files are listed in.
+	URL   string
+	Files []File
+}
+
+// Target returns the URL rel is recorded under, that of its first file.
+// Every file of rel has the same record domain.
+func (rel *Release) Target() string {
+	return rel.Files[0].URL
+}
+
+// Client reads the metadata of registries and downloads package files.
+type Client struct {
+	// PyPI and NPM are the base URLs of the registries, DefaultPyPI and
+	// DefaultNPM if empty. Package files are downloaded from where the
+	// metadata says.
+	PyPI string
+	NPM  string
+
+	// MaxFile is the largest file downloaded to hash it and MaxTotal the
+	// most bytes downloaded for one version, 1 GB and 4 GB if zero.
+	// Servers downloading the packages of others may want less.
+	MaxFile  int64
+	MaxTotal int64
+
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// MetadataURL returns the URL of the metadata of pv.
+func (c *Client) MetadataURL(pv Version) string {
+	switch pv.Registry {
+	case rgetwellknown.PyPI:
+		base := c.PyPI
+		if base == "" {
+			base = DefaultPyPI
+		}
+		return strings.TrimSuffix(base, "/") + "/pypi/" + pv.Package + "/" + pv.Version + "/json"
+	default:
+		base := c.NPM
+		if base == "" {
+			base = DefaultNPM
+		}
+		// The registry expects the "/" of scoped packages escaped
+		return strings.TrimSuffix(base, "/") + "/" + strings.Replace(pv.Package, "/", "%2f", 1) + "/" + pv.Version
+	}
+}
+
+// pypiVersion is the part of the PyPI JSON API response for a version that
+// is used.
+type pypiVersion struct {
+	URLs []struct {
+		Filename string `json:"filename"`
+		URL      string `json:"url"`
+		Digests  struct {
+			SHA256 string `json:"sha256"`
+		} `json:"digests"`
+	} `json:"urls"`
+}
+
+// npmVersion is the part of the npm registry document for a version that
+// is used.
+type npmVersion struct {
+	Dist struct {
+		Tarball   string `json:"tarball"`
+		Integrity string `json:"integrity"`
+		Shasum    string `json:"shasum"`
+	} `json:"dist"`
+}
+
+// Release reads the files of pv from the metadata of its registry. Every
+// file must be of pv.
+func (c *Client) Release(ctx context.Context, pv Version) (*Release, error) {
+	rel := &Release{Version: pv, URL: c.MetadataURL(pv)}
+
+	resp, err := ctxhttp.Get(ctx, c.client(), rel.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", rel.URL, resp.Status)
+	}
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxMetadata))
+
+	switch pv.Registry {
+	case rgetwellknown.PyPI:
+		var meta pypiVersion
+		if err := dec.Decode(&meta); err != nil {
+			return nil, fmt.Errorf("%v: %v", rel.URL, err)
+		}
+		for _, u := range meta.URLs {
+			sum, err := hex.DecodeString(u.Digests.SHA256)
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("%v: invalid sha256 %q of %v", rel.URL, u.Digests.SHA256, u.Filename)
+			}
+			rel.Files = append(rel.Files, File{Name: u.Filename, URL: u.URL, SHA256: sum})
+		}
+	case rgetwellknown.NPM:
+		var meta npmVersion
+		if err := dec.Decode(&meta); err != nil {
+			return nil, fmt.Errorf("%v: %v", rel.URL, err)
+		}
+		f := File{URL: meta.Dist.Tarball, Integrity: meta.Dist.Integrity}
+		f.Name = f.URL[strings.LastIndexByte(f.URL, '/')+1:]
+		if meta.Dist.Shasum != "" {
+			f.SHA1, err = hex.DecodeString(meta.Dist.Shasum)
+			if err != nil {
+				return nil, fmt.Errorf("%v: invalid shasum %q", rel.URL, meta.Dist.Shasum)
+			}
+		}
+		if f.Integrity == "" && f.SHA1 == nil {
+			return nil, fmt.Errorf("%v: no digest of %v", rel.URL, f.URL)
+		}
+		rel.Files = append(rel.Files, f)
+	}
+
+	if len(rel.Files) == 0 {
+		return nil, fmt.Errorf("%v: no files", rel.URL)
+	}
+	if len(rel.Files) > maxFiles {
+		return nil, fmt.Errorf("%v: more than %d files", rel.URL, maxFiles)
+	}
+	for _, f := range rel.Files {
+		fv, err := VersionOf(f.URL)
+		if err != nil {
+			return nil, err
+		}
+		if fv != pv {
+			return nil, fmt.Errorf("%v: %v is of %v not %v", rel.URL, f.Name, fv, pv)
+		}
+	}
+	sort.Slice(rel.Files, func(i, j int) bool { return rel.Files[i].Name < rel.Files[j].Name })
+
+	return rel, nil
+}
+
+// Sums returns the sums list rel is recorded with: the SHA-256 of each of
+// its files named by URL. Files the registry lists no SHA-256 for, or every
+// file if rehash is set, are downloaded and hashed, and must match every
+// digest the registry lists. Downloads are limited by MaxFile and MaxTotal.
+func (c *Client) Sums(ctx context.Context, rel *Release, rehash bool) (rgethash.URLSumList, error) {
+	total := c.MaxTotal
+	if total == 0 {
+		total = maxTotal
+	}
+
+	var sums rgethash.URLSumList
+	for _, f := range rel.Files {
+		sum := f.SHA256
+		if rehash || sum == nil {
+			max := c.MaxFile
+			if max == 0 {
+				max = maxFile
+			}
+			if max > total {
+				max = total
+			}
+			var n int64
+			var err error
+			sum, n, err = c.hash(ctx, f, max)
+			if err != nil {
+				return nil, err
+			}
+			total -= n
+		}
+		sums = append(sums, rgethash.URLSum{URL: f.URL, Sum: sum, Algorithm: rgethash.SHA256})
+	}
+	return sums, nil
+}
+
+// ReleaseSums returns the sums of the package version the file at durl is
+// of, made from the metadata of its registry, and the URL of the metadata.
+// ok is false if durl is not the URL of a file of a registry. npm lists no
+// SHA-256 digests so its tarballs are downloaded to make them; a caller
+// that goes on to download durl itself downloads an npm tarball twice.
+func (c *Client) ReleaseSums(ctx context.Context, durl string) (sums rgethash.URLSumList, sumsURL string, ok bool, err error) {
+	pv, err := VersionOf(durl)
+	if err != nil {
+		return nil, "", false, nil
+	}
+	rel, err := c.Release(ctx, pv)
+	if err != nil {
+		return nil, "", true, err
+	}
+	sums, err = c.Sums(ctx, rel, false)
+	return sums, rel.URL, true, err
+}
+
+// ParseSums returns ok false, registries have no sums files.
+func (c *Client) ParseSums(loc string, data []byte) (sums rgethash.URLSumList, ok bool, err error) {
+	return nil, false, nil
+}
+
+// hash downloads f, refusing it if larger than max bytes, and returns its
+// SHA-256 and size once it is checked against the digests of f.
+func (c *Client) hash(ctx context.Context, f File, max int64) ([]byte, int64, error) {
+	resp, err := ctxhttp.Get(ctx, c.client(), f.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%v: %v", f.URL, resp.Status)
+	}
+
+	h256, h512, h1 := sha256.New(), sha512.New(), sha1.New()
+	n, err := io.Copy(io.MultiWriter(h256, h512, h1), io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%v: %v", f.URL, err)
+	}
+	if n > max {
+		return nil, 0, fmt.Errorf("%v: larger than %d bytes", f.URL, max)
+	}
+	sum := h256.Sum(nil)
+
+	if f.SHA256 != nil && !bytes.Equal(f.SHA256, sum) {
+		return nil, 0, fmt.Errorf("%v: sha256 %x does not match %x listed by the registry", f.URL, sum, f.SHA256)
+	}
+	if f.SHA1 != nil && !bytes.Equal(f.SHA1, h1.Sum(nil)) {
+		return nil, 0, fmt.Errorf("%v: sha1 %x does not match %x listed by the registry", f.URL, h1.Sum(nil), f.SHA1)
+	}
+	if f.Integrity != "" {
+		if err := checkIntegrity(f.Integrity, map[string]hash.Hash{"sha256": h256, "sha512": h512}); err != nil {
+			return nil, 0, fmt.Errorf("%v: %v", f.URL, err)
+		}
+	}
+	return sum, n, nil
+}
+
+// checkIntegrity checks the hashes of a file against the subresource
+// integrity string integrity, which may list several digests. At least one
+// must be of a supported algorithm and all of those must match.
+func checkIntegrity(integrity string, hashes map[string]hash.Hash) error {
+	checked := 0
+	for _, d := range strings.Fields(integrity) {
+		i := strings.IndexByte(d, '-')
+		if i < 0 {
+			return fmt.Errorf("invalid integrity %q", d)
+		}
+		h, ok := hashes[d[:i]]
+		if !ok {
+			continue
+		}
+		// Options may follow the digest
+		digest := d[i+1:]
+		if j := strings.IndexByte(digest, '?'); j >= 0 {
+			digest = digest[:j]
+		}
+		want, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return fmt.Errorf("invalid integrity %q", d)
+		}
+		if !bytes.Equal(want, h.Sum(nil)) {
+			return fmt.Errorf("%s does not match integrity %q listed by the registry", d[:i], d)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return fmt.Errorf("unsupported integrity %q", integrity)
+	}
+	return nil
+}
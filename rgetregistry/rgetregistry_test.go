@@ -0,0 +1,202 @@
+package rgetregistry
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.merklecounty.com/rget/internal/testutil"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+func TestParseVersion(t *testing.T) {
+	for ti, tt := range []struct {
+		registry string
+		s        string
+		pkg      string
+		wantErr  bool
+	}{
+		{"pypi", "Python_Dateutil@2.8.2", "python-dateutil", false},
+		{"npm", "left-pad@1.3.0", "left-pad", false},
+		{"npm", "@types/node@12.7.2", "@types/node", false},
+		{"npm", "@types/node", "", true},
+		{"npm", "left-pad@", "", true},
+		{"cargo", "serde@1.0.0", "", true},
+	} {
+		pv, err := ParseVersion(tt.registry, tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+			continue
+		}
+		if err == nil && pv.Package != tt.pkg {
+			t.Errorf("%d: package %v want %v", ti, pv.Package, tt.pkg)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	const (
+		wheel   = "python_dateutil-2.8.2-py2.py3-none-any.whl"
+		sdist   = "python-dateutil-2.8.2.tar.gz"
+		tarball = "left-pad-1.3.0.tgz"
+		dir     = "/packages/36/7a/87837f39d0296e723bb9b62bbb257d0355c7f6128853c78955f57342a56d/"
+	)
+	files := map[string][]byte{
+		dir + wheel:              []byte("wheel"),
+		dir + sdist:              []byte("sdist"),
+		"/left-pad/-/" + tarball: []byte("tarball"),
+	}
+	digest := func(name string) string {
+		sum := sha256.Sum256(files[name])
+		return hex.EncodeToString(sum[:])
+	}
+	tgz512 := sha512.Sum512(files["/left-pad/-/"+tarball])
+	tgz1 := sha1.Sum(files["/left-pad/-/"+tarball])
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := files[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		switch r.Host + r.URL.Path {
+		case "pypi.org/pypi/python-dateutil/2.8.2/json":
+			fmt.Fprintf(w, `{"urls": [
+  {"filename": %q, "url": "https://files.pythonhosted.org%s", "digests": {"sha256": %q}},
+  {"filename": %q, "url": "https://files.pythonhosted.org%s", "digests": {"sha256": %q}}
+]}`, wheel, dir+wheel, digest(dir+wheel), sdist, dir+sdist, digest(dir+sdist))
+		case "pypi.org/pypi/python-dateutil/2.8.3/json":
+			// A file of another version
+			fmt.Fprintf(w, `{"urls": [{"filename": %q, "url": "https://files.pythonhosted.org%s", "digests": {"sha256": %q}}]}`,
+				wheel, dir+wheel, digest(dir+wheel))
+		case "pypi.org/pypi/python-dateutil/2.8.4/json":
+			// A digest that does not match
+			fmt.Fprintf(w, `{"urls": [{"filename": "python-dateutil-2.8.4.tar.gz", "url": "https://files.pythonhosted.org%spython-dateutil-2.8.4.tar.gz", "digests": {"sha256": %q}}]}`,
+				dir, digest(dir+wheel))
+		case "registry.npmjs.org/left-pad/1.3.0":
+			fmt.Fprintf(w, `{"dist": {"tarball": "https://registry.npmjs.org/left-pad/-/%s", "integrity": "sha512-%s", "shasum": "%x"}}`,
+				tarball, base64.StdEncoding.EncodeToString(tgz512[:]), tgz1)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	files[dir+"python-dateutil-2.8.4.tar.gz"] = []byte("other")
+
+	// Send requests for every site to the test server
+	c := &Client{HTTPClient: testutil.RedirectClient(ts.URL)}
+	ctx := context.Background()
+
+	for ti, tt := range []struct {
+		registry string
+		s        string
+		names    []string
+		wantErr  bool
+	}{
+		{"pypi", "python-dateutil@2.8.2", []string{sdist, wheel}, false},
+		{"pypi", "python_dateutil@2.8.3", nil, true},
+		{"pypi", "python-dateutil@2.8.4", nil, true},
+		{"pypi", "python-dateutil@2.9.0", nil, true},
+		{"npm", "left-pad@1.3.0", []string{tarball}, false},
+	} {
+		pv, err := ParseVersion(tt.registry, tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, err := c.Release(ctx, pv)
+		var sums []string
+		if err == nil {
+			for _, rehash := range []bool{false, true} {
+				s, serr := c.Sums(ctx, rel, rehash)
+				if serr != nil {
+					err = serr
+					break
+				}
+				sums = nil
+				for _, u := range s {
+					sums = append(sums, u.URL)
+				}
+			}
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(rel.Files) != len(tt.names) {
+			t.Errorf("%d: files %v want %v", ti, rel.Files, tt.names)
+			continue
+		}
+		for i, f := range rel.Files {
+			if f.Name != tt.names[i] || sums[i] != f.URL {
+				t.Errorf("%d: file %d %v %v want %v", ti, i, f.Name, sums[i], tt.names[i])
+			}
+			if v, err := VersionOf(f.URL); err != nil || v != pv {
+				t.Errorf("%d: version of %v: %v %v", ti, f.URL, v, err)
+			}
+		}
+	}
+
+	// Both files of 2.8.2 are 5 bytes
+	pv := Version{Registry: rgetwellknown.PyPI, Package: "python-dateutil", Version: "2.8.2"}
+	rel, err := c.Release(ctx, pv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ti, tt := range []struct {
+		maxFile  int64
+		maxTotal int64
+		wantErr  bool
+	}{
+		{5, 0, false},
+		{4, 0, true},
+		{0, 10, false},
+		{0, 9, true},
+	} {
+		lc := &Client{HTTPClient: c.HTTPClient, MaxFile: tt.maxFile, MaxTotal: tt.maxTotal}
+		if _, err := lc.Sums(ctx, rel, true); (err != nil) != tt.wantErr {
+			t.Errorf("limit %d: want error %v got %v", ti, tt.wantErr, err)
+		}
+		// Listed digests need no download
+		if _, err := lc.Sums(ctx, rel, false); err != nil {
+			t.Errorf("limit %d: %v", ti, err)
+		}
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	sum := sha512.Sum512([]byte("tarball"))
+	good := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	bad := "sha512-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size))
+
+	for ti, tt := range []struct {
+		integrity string
+		wantErr   bool
+	}{
+		{good, false},
+		{good + "?opt", false},
+		{"sha384-abcd " + good, false},
+		{bad, true},
+		{good + " " + bad, true},
+		{"sha384-abcd", true},
+		{"sha512", true},
+	} {
+		h := sha512.New()
+		h.Write([]byte("tarball"))
+		h256 := sha256.New()
+		h256.Write([]byte("tarball"))
+		err := checkIntegrity(tt.integrity, map[string]hash.Hash{"sha256": h256, "sha512": h})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+		}
+	}
+}
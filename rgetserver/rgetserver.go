@@ -4,21 +4,74 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"net/url"
+	"path"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context/ctxhttp"
 
 	"go.merklecounty.com/rget/gitcache"
+	"go.merklecounty.com/rget/rgetapt"
+	"go.merklecounty.com/rget/rgetgomod"
 	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetoci"
+	"go.merklecounty.com/rget/rgetregistry"
 	"go.merklecounty.com/rget/rgetwellknown"
 )
 
 type Server struct {
 	*gitcache.GitCache
 	ProjReqs *prometheus.CounterVec
+
+	// Host the recorder serves under, rgetwellknown.PublicServiceHost if
+	// empty.
+	Host string
+
+	// Resolver fetches the discovery documents of sites not built into
+	// rget so their releases can be submitted, only built in sites are
+	// accepted if nil.
+	Resolver *rgetwellknown.Resolver
+
+	// Registry fetches the manifests of submitted images, a default
+	// rgetoci.Client if nil.
+	Registry *rgetoci.Client
+
+	// GoProxy downloads submitted module versions and looks them up in
+	// the checksum database, a default rgetgomod.Client if nil.
+	GoProxy *rgetgomod.Client
+
+	// Registries read the metadata of submitted package versions and
+	// download their files, a default rgetregistry.Client if nil.
+	Registries *rgetregistry.Client
+
+	// Apt reads the Release files of submitted APT repository suites, a
+	// default rgetapt.Client if nil.
+	Apt *rgetapt.Client
+
+	// HTTPClient downloads submitted sums files, http.DefaultClient if
+	// nil.
+	HTTPClient *http.Client
+}
+
+// maxSums is the largest sums file read.
+const maxSums = 16 << 20
+
+func (s Server) host() string {
+	if s.Host != "" {
+		return s.Host
+	}
+	return rgetwellknown.PublicServiceHost
+}
+
+func (s Server) client() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return http.DefaultClient
 }
 
 type release struct {
@@ -62,12 +115,12 @@ func (s Server) ReleaseHandler(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if req.Host == rgetwellknown.PublicServiceHost {
+	if req.Host == s.host() {
 		rootTemplate.Execute(resp, nil)
 		return
 	}
 
-	short, err := rgetwellknown.TrimDigestDomain(req.Host)
+	short, err := rgetwellknown.TrimDigestDomain(req.Host, s.host())
 	if err != nil {
 		fmt.Printf("request for unknown host %v unable to parse: %v\n", req.Host, err)
 	}
@@ -75,7 +128,7 @@ func (s Server) ReleaseHandler(resp http.ResponseWriter, req *http.Request) {
 		s.ProjReqs.WithLabelValues(req.Method, short).Inc()
 	}
 
-	full := strings.TrimSuffix(req.Host, "."+rgetwellknown.PublicServiceHost)
+	full := strings.TrimSuffix(req.Host, "."+s.host())
 
 	r := &release{Full: full, Short: short}
 	releaseTemplate.Execute(resp, r)
@@ -95,11 +148,29 @@ func (r Server) APIHandler(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if image := req.Form.Get("image"); image != "" {
+		r.submitImage(resp, req, image)
+		return
+	}
+	if mod := req.Form.Get("gomod"); mod != "" {
+		r.submitModule(resp, req, mod)
+		return
+	}
+	if registry := req.Form.Get("registry"); registry != "" {
+		r.submitPackage(resp, req, registry, req.Form.Get("package"))
+		return
+	}
+
 	sumsURL := req.Form.Get("url")
 	fmt.Printf("submission: %v\n", sumsURL)
 
 	// ensure the URL is coming from a host we know how to generate a
 	// domain for by parsing it using the wellknown libraries
+	if r.Resolver != nil {
+		if _, err := r.Resolver.Resolve(req.Context(), sumsURL); err != nil {
+			fmt.Printf("wellknown discovery error: %v\n", err)
+		}
+	}
 	domain, err := rgetwellknown.Domain(sumsURL)
 	if err != nil {
 		fmt.Printf("wellknown domain error: %v\n", err)
@@ -109,36 +180,226 @@ func (r Server) APIHandler(resp http.ResponseWriter, req *http.Request) {
 
 	r.ProjReqs.WithLabelValues(req.Method, domain).Inc()
 
+	// The file name gives the digest algorithm of the sums
+	u, err := url.Parse(sumsURL)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The Release files of APT repository suites list their sums
+	if rgetapt.IsReleaseFile(path.Base(u.Path)) {
+		r.submitSuite(resp, req, sumsURL)
+		return
+	}
+	alg, err := rgethash.AlgorithmForFile(path.Base(u.Path))
+	if err != nil {
+		fmt.Printf("sums algorithm error: %v: %v\n", sumsURL, err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Step 1: Download the SHA256SUMS that is correct for the URL
-	response, err := http.Get(sumsURL)
-	var sha256file []byte
-	if err != nil {
-		fmt.Printf("%s", err)
-		os.Exit(1)
-	} else {
-		var err error
-		defer response.Body.Close()
-		sha256file, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
-		}
+	response, err := ctxhttp.Get(req.Context(), r.client(), sumsURL)
+	if err != nil {
+		fmt.Printf("sums download error: %v: %v\n", sumsURL, err)
+		http.Error(resp, fmt.Sprintf("%v: %v", sumsURL, err), http.StatusBadRequest)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Printf("sums download error: %v: %v\n", sumsURL, response.Status)
+		http.Error(resp, fmt.Sprintf("%v: %v", sumsURL, response.Status), http.StatusBadRequest)
+		return
+	}
+	sha256file, err := ioutil.ReadAll(io.LimitReader(response.Body, maxSums+1))
+	if err == nil && len(sha256file) > maxSums {
+		err = fmt.Errorf("larger than %d bytes", maxSums)
+	}
+	if err != nil {
+		fmt.Printf("sums read error: %v: %v\n", sumsURL, err)
+		http.Error(resp, fmt.Sprintf("%v: %v", sumsURL, err), http.StatusBadRequest)
+		return
+	}
+
+	sums, err := rgethash.ParseSumFile(string(sha256file), alg)
+	if err != nil {
+		fmt.Printf("sums parse error: %v: %v\n", sumsURL, err)
+		http.Error(resp, fmt.Sprintf("%v: %v", sumsURL, err), http.StatusBadRequest)
+		return
+	}
+
+	r.record(resp, sumsURL, sums, sha256file)
+}
+
+// submitImage records the digests of the image the reference image points
+// at, as listed by its registry, for the registry API URL of its manifest.
+func (r Server) submitImage(resp http.ResponseWriter, req *http.Request, image string) {
+	fmt.Printf("image submission: %v\n", image)
+
+	ref, err := rgetoci.ParseReference(image)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	domain, err := rgetwellknown.Domain(ref.URL())
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	sums := rgethash.FromSHA256SumFile(string(sha256file))
+	r.ProjReqs.WithLabelValues(req.Method, domain).Inc()
 
-	// Step 2: Save the file contents to the git repo by domain
-	_, err = r.GitCache.Get(context.Background(), sums.Domain())
+	registry := r.Registry
+	if registry == nil {
+		registry = &rgetoci.Client{}
+	}
+	img, err := registry.Resolve(req.Context(), ref)
+	if err != nil {
+		fmt.Printf("image resolve error: %v\n", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sums, err := img.Sums()
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("%v: %v", ref, err), http.StatusBadRequest)
+		return
+	}
+
+	r.record(resp, ref.URL(), sums, []byte(sums.SHA256SumFile()))
+}
+
+// submitModule records the files of the module version mod, refusing
+// versions whose hashes do not match the checksum database.
+func (r Server) submitModule(resp http.ResponseWriter, req *http.Request, mod string) {
+	fmt.Printf("module submission: %v\n", mod)
+
+	mv, err := rgetgomod.ParseVersion(mod)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	domain, err := rgetwellknown.Domain(mv.RecordURL())
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.ProjReqs.WithLabelValues(req.Method, domain).Inc()
+
+	proxy := r.GoProxy
+	if proxy == nil {
+		proxy = &rgetgomod.Client{}
+	}
+	m, err := proxy.Download(req.Context(), mv)
+	if err != nil {
+		fmt.Printf("module download error: %v\n", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record, err := proxy.Lookup(req.Context(), mv)
 	if err == nil {
-		// TODO(philips): add rate limiting and DDoS protections here
-		fmt.Printf("cache hit: %v\n", sumsURL)
-		resp.WriteHeader(http.StatusOK)
+		err = m.CheckGoSum(record)
+	}
+	if err != nil {
+		fmt.Printf("module checksum database error: %v\n", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sums, err := m.Sums()
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.record(resp, mv.RecordURL(), sums, []byte(sums.SHA256SumFile()))
+}
+
+// submitPackage records the files of the version pkg of a package of
+// registry, hashing each of them and refusing versions whose files do not
+// match the digests listed by the registry.
+func (r Server) submitPackage(resp http.ResponseWriter, req *http.Request, registry, pkg string) {
+	fmt.Printf("package submission: %v %v\n", registry, pkg)
+
+	pv, err := rgetregistry.ParseVersion(registry, pkg)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	registries := r.Registries
+	if registries == nil {
+		registries = &rgetregistry.Client{}
+	}
+	rel, err := registries.Release(req.Context(), pv)
+	if err != nil {
+		fmt.Printf("package metadata error: %v\n", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	domain, err := rgetwellknown.Domain(rel.Target())
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.ProjReqs.WithLabelValues(req.Method, domain).Inc()
+
+	sums, err := registries.Sums(req.Context(), rel, true)
+	if err != nil {
+		fmt.Printf("package download error: %v\n", err)
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.record(resp, rel.Target(), sums, []byte(sums.SHA256SumFile()))
+}
+
+// submitSuite records the SHA256 section of the Release file at releaseURL
+// of an APT repository suite, refusing Release files of other suites.
+func (r Server) submitSuite(resp http.ResponseWriter, req *http.Request, releaseURL string) {
+	apt := r.Apt
+	if apt == nil {
+		apt = &rgetapt.Client{}
+	}
+	rel, err := apt.Read(req.Context(), releaseURL)
+	if err != nil {
+		fmt.Printf("release read error: %v\n", err)
+		http.Error(resp, fmt.Sprintf("%v: %v", releaseURL, err), http.StatusBadRequest)
+		return
+	}
+	sums := rel.Sums()
+
+	r.record(resp, releaseURL, sums, []byte(sums.SHA256SumFile()))
+}
+
+// record saves data, the sums file read for target, to the git repo under its
+// record domain unless it is already recorded.
+func (r Server) record(resp http.ResponseWriter, target string, sums rgethash.URLSumList, data []byte) {
+	// Step 2: Save the file contents to the git repo by domain unless
+	// the release is already recorded under this or an older scheme
+	ctdomain, err := sums.RecordDomain(target, rgetwellknown.CurrentScheme)
+	if err == nil {
+		err = rgetwellknown.CheckDomain(ctdomain + "." + r.host())
+	}
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, scheme := range rgetwellknown.Schemes {
+		d, err := sums.RecordDomain(target, scheme)
+		if err != nil {
+			continue
+		}
+		if _, err := r.GitCache.Get(context.Background(), d); err == nil {
+			// TODO(philips): add rate limiting and DDoS protections here
+			fmt.Printf("cache hit: %v\n", target)
+			resp.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
 	// Step 3. Create the Certificate object for the domain and save that as well
-	ctdomain := sums.Domain() + "." + domain
-	err = r.GitCache.Put(context.Background(), ctdomain, sha256file)
+	err = r.GitCache.Put(context.Background(), ctdomain, data)
 	if err != nil {
 		fmt.Printf("git put error: %v", err)
 		http.Error(resp, "internal service error", http.StatusInternalServerError)
@@ -0,0 +1,244 @@
+package rgetserver
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go.merklecounty.com/rget/gitcache"
+	"go.merklecounty.com/rget/internal/testutil"
+	"go.merklecounty.com/rget/rgetapt"
+	"go.merklecounty.com/rget/rgetgomod"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetoci"
+	"go.merklecounty.com/rget/rgetregistry"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// newTestServer returns a Server recording to an empty git repo, with its
+// clients sending the requests for every site to handler.
+func newTestServer(t *testing.T, handler http.Handler) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "TestServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dir)
+
+	gitURL := testutil.EmptyGitRepo(t, filepath.Join(dir, "repo"))
+	gc, err := gitcache.NewGitCache(gitURL, nil, filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(handler)
+	hc := testutil.RedirectClient(ts.URL)
+	s := &Server{
+		GitCache: gc,
+		ProjReqs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rget_project_requests",
+		}, []string{"method", "project"}),
+		Registry:   &rgetoci.Client{HTTPClient: hc},
+		GoProxy:    &rgetgomod.Client{HTTPClient: hc},
+		Registries: &rgetregistry.Client{HTTPClient: hc},
+		Apt:        &rgetapt.Client{HTTPClient: hc},
+		HTTPClient: hc,
+	}
+	return s, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// records returns the number of files in the cache of s.
+func records(t *testing.T, s *Server) int {
+	names, err := s.GitCache.Prefix(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(names)
+}
+
+// submit posts form to the API of s and returns the status code.
+func submit(s *Server, form url.Values) int {
+	req := httptest.NewRequest("POST", "/api/sumsurl", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.APIHandler(w, req)
+	return w.Code
+}
+
+func TestRecord(t *testing.T) {
+	s, done := newTestServer(t, http.NotFoundHandler())
+	defer done()
+
+	const target = "https://github.com/merklecounty/rget/releases/download/v0.0.6/SHA256SUMS"
+	sums := rgethash.URLSumList{{URL: "rget.tar.gz", Sum: make([]byte, sha256.Size), Algorithm: rgethash.SHA256}}
+	data := []byte(sums.SHA256SumFile())
+
+	before := records(t, s)
+	for ti, tt := range []struct {
+		host    string
+		target  string
+		code    int
+		records int
+	}{
+		{"", target, http.StatusOK, 1},
+		// Already recorded
+		{"", target, http.StatusOK, 1},
+		// Too long for its record domain under the host to be a domain
+		{strings.Repeat("recorder.", 20) + "com", strings.Replace(target, "v0.0.6", "v0.0.7", 1), http.StatusBadRequest, 1},
+		// Not a release of a known site
+		{"", "https://example.com/SHA256SUMS", http.StatusBadRequest, 1},
+	} {
+		s.Host = tt.host
+		w := httptest.NewRecorder()
+		s.record(w, tt.target, sums, data)
+		if w.Code != tt.code {
+			t.Errorf("%d: status %d want %d: %v", ti, w.Code, tt.code, w.Body)
+		}
+		if n := records(t, s) - before; n != tt.records {
+			t.Errorf("%d: %d records want %d", ti, n, tt.records)
+		}
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	const index = `{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [
+  {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:1111111111111111111111111111111111111111111111111111111111111111", "size": 1, "platform": {"architecture": "amd64", "os": "linux"}}
+]}`
+
+	mod := rgetgomod.Version{Path: "example.com/tool", Version: "v1.0.0"}
+	modFiles := testutil.ModuleFiles(t, mod.Path, mod.Version)
+	zipHash, modHash, err := (&rgetgomod.Module{Version: mod, Files: modFiles}).H1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// v1.0.1 is served with the files of v1.0.0 but is in the checksum
+	// database with hashes of its own
+	other := rgetgomod.Version{Path: mod.Path, Version: "v1.0.1"}
+	otherFiles := testutil.ModuleFiles(t, mod.Path, mod.Version)
+
+	tarball := []byte("tarball")
+	tgz512 := sha512.Sum512(tarball)
+	tgz1 := sha1.Sum(tarball)
+
+	packages := []byte("Package: rget\n")
+	release := fmt.Sprintf("Suite: stable\nCodename: bookworm\nSHA256:\n %x %d main/binary-amd64/Packages\n", sha256.Sum256(packages), len(packages))
+
+	if err := rgetwellknown.AddAptHost("deb.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	sums := fmt.Sprintf("%x  tool.tar.gz\n", sha256.Sum256(tarball))
+	// A valid sums file only refused for its size
+	var large strings.Builder
+	for i := 0; large.Len() <= maxSums; i++ {
+		fmt.Fprintf(&large, "%x  tool-%d.tar.gz\n", sha256.Sum256(tarball), i)
+	}
+
+	db := testutil.NewSumDB(t, 2, func(i int) []byte {
+		if i == 0 {
+			return []byte(fmt.Sprintf("%v %v %v\n%v %v/go.mod %v\n",
+				mod.Path, mod.Version, rgetgomod.H1String(zipHash), mod.Path, mod.Version, rgetgomod.H1String(modHash)))
+		}
+		return []byte(fmt.Sprintf("%v %v h1:%s\n",
+			other.Path, other.Version, base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))))
+	})
+	s, done := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.Host + r.URL.Path
+		for ext, data := range modFiles {
+			if p == strings.TrimPrefix(mod.URL(rgetgomod.DefaultProxy, ext), "https://") {
+				w.Write(data)
+				return
+			}
+			if p == strings.TrimPrefix(other.URL(rgetgomod.DefaultProxy, ext), "https://") {
+				w.Write(otherFiles[ext])
+				return
+			}
+		}
+		if strings.HasPrefix(p, "sum.golang.org/tile/8/") {
+			if data, ok := db.Tile(strings.TrimPrefix(p, "sum.golang.org/tile/8/")); ok {
+				w.Write(data)
+				return
+			}
+		}
+		switch p {
+		case "ghcr.io/v2/org/tool/manifests/v1.0":
+			w.Header().Set("Content-Type", rgetoci.MediaTypeImageIndex)
+			w.Write([]byte(index))
+		case "sum.golang.org/lookup/" + mod.String():
+			fmt.Fprint(w, db.Lookup(0))
+		case "sum.golang.org/lookup/" + other.String():
+			fmt.Fprint(w, db.Lookup(1))
+		case "registry.npmjs.org/left-pad/1.3.0":
+			fmt.Fprintf(w, `{"dist": {"tarball": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz", "integrity": "sha512-%s", "shasum": "%x"}}`,
+				base64.StdEncoding.EncodeToString(tgz512[:]), tgz1)
+		case "registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz", "registry.npmjs.org/left-pad/-/left-pad-1.3.1.tgz":
+			w.Write(tarball)
+		case "registry.npmjs.org/left-pad/1.3.1":
+			// A tarball that does not match its integrity
+			fmt.Fprintf(w, `{"dist": {"tarball": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.1.tgz", "integrity": "sha512-%s"}}`,
+				base64.StdEncoding.EncodeToString(make([]byte, sha512.Size)))
+		case "github.com/org/tool/releases/download/v1.0/SHA256SUMS":
+			fmt.Fprint(w, sums)
+		case "github.com/org/tool/releases/download/v3.0/SHA256SUMS":
+			fmt.Fprint(w, large.String())
+		case "deb.example.com/debian/dists/bookworm/InRelease":
+			w.Write([]byte(release))
+		case "deb.example.com/debian/dists/sid/InRelease":
+			// The Release file of another suite
+			w.Write([]byte(release))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+	s.GoProxy.SumDBKey = db.Key
+
+	before := records(t, s)
+	for ti, tt := range []struct {
+		form    url.Values
+		code    int
+		records int
+	}{
+		{url.Values{"image": {"ghcr.io/org/tool:v1.0"}}, http.StatusOK, 1},
+		{url.Values{"image": {"ghcr.io/org/tool:v2.0"}}, http.StatusBadRequest, 1},
+		{url.Values{"image": {"ghcr.io/Org/tool:v1.0"}}, http.StatusBadRequest, 1},
+		{url.Values{"gomod": {mod.String()}}, http.StatusOK, 2},
+		// Refused as its hashes do not match the checksum database
+		{url.Values{"gomod": {other.String()}}, http.StatusBadRequest, 2},
+		{url.Values{"gomod": {"example.com/tool@v2.0.0"}}, http.StatusBadRequest, 2},
+		{url.Values{"registry": {"npm"}, "package": {"left-pad@1.3.0"}}, http.StatusOK, 3},
+		{url.Values{"registry": {"npm"}, "package": {"left-pad@1.3.1"}}, http.StatusBadRequest, 3},
+		{url.Values{"registry": {"cargo"}, "package": {"serde@1.0.0"}}, http.StatusBadRequest, 3},
+		{url.Values{"url": {"https://deb.example.com/debian/dists/bookworm/InRelease"}}, http.StatusOK, 4},
+		{url.Values{"url": {"https://deb.example.com/debian/dists/sid/InRelease"}}, http.StatusBadRequest, 4},
+		{url.Values{"url": {"https://github.com/org/tool/releases/download/v1.0/SHA256SUMS"}}, http.StatusOK, 5},
+		// Sums files that are missing or too large
+		{url.Values{"url": {"https://github.com/org/tool/releases/download/v2.0/SHA256SUMS"}}, http.StatusBadRequest, 5},
+		{url.Values{"url": {"https://github.com/org/tool/releases/download/v3.0/SHA256SUMS"}}, http.StatusBadRequest, 5},
+		// Submitting again records nothing more
+		{url.Values{"image": {"ghcr.io/org/tool:v1.0"}}, http.StatusOK, 5},
+		{url.Values{"gomod": {mod.String()}}, http.StatusOK, 5},
+		{url.Values{"url": {"https://github.com/org/tool/releases/download/v1.0/SHA256SUMS"}}, http.StatusOK, 5},
+	} {
+		if code := submit(s, tt.form); code != tt.code {
+			t.Errorf("%d: %v: status %d want %d", ti, tt.form, code, tt.code)
+		}
+		if n := records(t, s) - before; n != tt.records {
+			t.Errorf("%d: %v: %d records want %d", ti, tt.form, n, tt.records)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package rgetverify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+)
+
+// Bundles are identified by BundleFormat and BundleVersion. The format is
+// described in Documentation/bundle.md.
+const (
+	BundleFormat  = "rget-bundle"
+	BundleVersion = 1
+
+	// BundleExt is the conventional file extension of a bundle.
+	BundleExt = ".rgetbundle"
+)
+
+// Bundle holds everything needed to verify the files of a release without
+// network access: the sums file, the record certificate chain and its SCTs,
+// and the tree heads and inclusion proofs of the logs that issued them.
+type Bundle struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+
+	URL     string `json:"url"`
+	SumsURL string `json:"sums_url"`
+	Sums    string `json:"sums"`
+
+	// Algorithm of Sums, omitted for SHA256.
+	Algorithm rgethash.Algorithm `json:"algorithm,omitempty"`
+
+	// Chain is the DER record certificate chain, leaf first.
+	Chain [][]byte `json:"chain"`
+
+	// TLSSCTs and OCSPSCTs are TLS encoded SCTs delivered alongside the
+	// certificate rather than embedded in it.
+	TLSSCTs  [][]byte `json:"tls_scts,omitempty"`
+	OCSPSCTs [][]byte `json:"ocsp_scts,omitempty"`
+
+	Logs []rgetct.LogEvidence `json:"logs"`
+}
+
+// Bundle verifies the record for durl, as Record does, and returns a bundle
+// of the evidence that was checked.
+func (v *Verifier) Bundle(ctx context.Context, durl, sumsLoc string) (*Bundle, *Result, error) {
+	rec := &rgetct.EvidenceRecorder{Factory: v.LogInfo}
+	bv := *v
+	bv.LogInfo = rec.LogInfo
+
+	res, err := bv.Record(ctx, durl, sumsLoc)
+	if err != nil {
+		return nil, res, err
+	}
+
+	b := &Bundle{
+		Format:   BundleFormat,
+		Version:  BundleVersion,
+		Created:  time.Now().UTC(),
+		URL:      res.URL,
+		SumsURL:  res.SumsURL,
+		Sums:     res.Sums.SHA256SumFile(),
+		TLSSCTs:  res.TLSSCTs,
+		OCSPSCTs: res.OCSPSCTs,
+		Logs:     rec.Evidence(),
+	}
+	if a := res.Sums.Algorithm(); a != rgethash.SHA256 {
+		b.Algorithm = a
+	}
+	for _, cert := range res.Chain {
+		b.Chain = append(b.Chain, cert.Raw)
+	}
+
+	return b, res, nil
+}
+
+// ReadBundle decodes a bundle written by WriteBundle.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %v", err)
+	}
+	if b.Format != BundleFormat {
+		return nil, fmt.Errorf("not an rget bundle: format %q", b.Format)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if _, err := rgethash.ParseAlgorithm(string(b.Algorithm)); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// WriteBundle encodes b to w.
+func WriteBundle(w io.Writer, b *Bundle) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// NoNetwork is an http.RoundTripper that fails every request, so that
+// verifying a bundle, or anything else meant to stay offline, cannot reach
+// out.
+type NoNetwork struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (NoNetwork) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("no network access to fetch %v", req.URL)
+}
+
+// VerifyBundle checks the record in b without network access. The log list,
+// roots and policy of v are used; nothing in the bundle is trusted until it
+// has been checked against them. Use CheckDigest on the result to check
+// files of the release. Releases of sites not built into rget need their
+// discovery document cached by the Resolver of v, whose Client should be nil
+// to stay offline.
+func (v *Verifier) VerifyBundle(ctx context.Context, b *Bundle) (*Result, error) {
+	res := &Result{
+		URL:      b.URL,
+		SumsURL:  b.SumsURL,
+		TLSSCTs:  b.TLSSCTs,
+		OCSPSCTs: b.OCSPSCTs,
+	}
+
+	if err := v.Resolve(ctx, b.URL); err != nil {
+		res.Err = err
+		return res, err
+	}
+
+	alg, err := rgethash.ParseAlgorithm(string(b.Algorithm))
+	if err != nil {
+		return res, res.fail(StageSums, err)
+	}
+	res.Sums, err = rgethash.ParseSumFile(b.Sums, alg)
+	if err != nil {
+		return res, res.fail(StageSums, fmt.Errorf("bundle sums: %v", err))
+	}
+
+	// A bundle holds the record of a single recorder
+	recorders, quorum := v.recorders(res.URL)
+	if quorum > 1 {
+		return res, res.fail(StagePolicy, fmt.Errorf("bundle holds the record of one recorder, %d required", quorum))
+	}
+	var domains []recordDomain
+	hosts := make(map[string]string)
+	for _, host := range recorders {
+		ds, err := recordDomains(res, host)
+		if err != nil {
+			return res, res.fail(StageDomain, err)
+		}
+		for _, d := range ds {
+			hosts[d.domain] = host
+		}
+		domains = append(domains, ds...)
+	}
+
+	for i, der := range b.Chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return res, res.fail(StageDiscovery, fmt.Errorf("bundle certificate %d: %v", i, err))
+		}
+		res.Chain = append(res.Chain, cert)
+	}
+	if len(res.Chain) == 0 {
+		return res, res.fail(StageDiscovery, errors.New("bundle has no certificate"))
+	}
+
+	d := chainDomain(res.Chain[0], domains)
+	res.Domain, res.Root = d.domain, d.root
+	res.Recorder = hosts[res.Domain]
+
+	// The certificate may have expired since the bundle was made
+	hc := &http.Client{Transport: NoNetwork{}}
+	return res, v.checkRecord(ctx, res, res.Chain[0].NotBefore, rgetct.OfflineLogInfo(b.Logs), hc)
+}
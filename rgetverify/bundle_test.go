@@ -0,0 +1,99 @@
+package rgetverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509"
+
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+func TestBundle(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents)
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+
+	v := &Verifier{
+		Client:    ts.Client(),
+		LogList:   &rgetct.LogList{},
+		Roots:     trusted,
+		Policy:    &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}},
+		Discovery: DiscoveryCT,
+		SearchURL: ts.URL + "/",
+	}
+
+	ctx := context.Background()
+	b, _, err := v.Bundle(ctx, testURL, ts.URL+"/SHA256SUMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+
+	// Verification must not use the network
+	ts.Close()
+
+	future := strings.Replace(data, `"version": 1`, `"version": 2`, 1)
+	if _, err := ReadBundle(strings.NewReader(future)); err == nil {
+		t.Errorf("read bundle of unsupported version")
+	}
+
+	evil := sha256.Sum256([]byte("evil"))
+	digest := sha256.Sum256(contents)
+	for ti, tt := range []struct {
+		mutate func(b *Bundle)
+		stage  Stage
+	}{
+		{func(b *Bundle) {}, ""},
+		{func(b *Bundle) { b.Sums = fmt.Sprintf("%x  file.txt\n", evil) }, StageChain},
+		{func(b *Bundle) { b.URL = strings.Replace(b.URL, "v1.0", "v1.1", 1) }, StageChain},
+		{func(b *Bundle) { b.Chain = nil }, StageDiscovery},
+	} {
+		b, err := ReadBundle(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.mutate(b)
+
+		res, err := v.VerifyBundle(ctx, b)
+		if err == nil {
+			err = v.CheckDigest(res, testURL, digest[:])
+		}
+
+		var stage Stage
+		if verr, ok := err.(*Error); ok {
+			stage = verr.Stage
+		}
+		if stage != tt.stage {
+			t.Errorf("%d: want failure at %q got %v", ti, tt.stage, err)
+		}
+	}
+
+	// Without network access bundles verify but records cannot be looked up
+	v.Client = &http.Client{Transport: NoNetwork{}}
+	b, err = ReadBundle(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyBundle(ctx, b); err != nil {
+		t.Errorf("offline bundle: %v", err)
+	}
+	if _, err := v.Record(ctx, testURL, ""); err == nil || !strings.Contains(err.Error(), "no network access") {
+		t.Errorf("offline record: want no network access got %v", err)
+	}
+}
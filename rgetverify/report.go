@@ -0,0 +1,177 @@
+package rgetverify
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+)
+
+// ReportVersion is the version of the Report format. It changes only when
+// fields are removed or change meaning.
+const ReportVersion = 1
+
+// Verdicts of a Report.
+const (
+	VerdictOK   = "ok"
+	VerdictFail = "fail"
+)
+
+// Report is a Result, and the files checked against it, in a form suitable
+// for encoding as JSON. The format is described in Documentation/report.md.
+type Report struct {
+	Version int    `json:"version"`
+	URL     string `json:"url"`
+
+	SumsURL    string `json:"sums_url,omitempty"`
+	SumsDigest string `json:"sums_digest,omitempty"`
+	Domain     string `json:"domain,omitempty"`
+	Recorder   string `json:"recorder,omitempty"`
+
+	// Records describe the check of each recorder when there is more
+	// than one.
+	Records []RecordReport `json:"records,omitempty"`
+
+	// Algorithm of the sums and file digests.
+	Algorithm rgethash.Algorithm `json:"algorithm,omitempty"`
+
+	Certificate *CertificateReport   `json:"certificate,omitempty"`
+	SCTs        []SCTReport          `json:"scts"`
+	Policy      *rgetct.PolicyResult `json:"policy,omitempty"`
+	Files       []FileReport         `json:"files"`
+
+	Verdict string `json:"verdict"`
+	Stage   Stage  `json:"failed_stage,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CertificateReport describes the record certificate.
+type CertificateReport struct {
+	Serial    string    `json:"serial"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+
+	// Root is the root the chain was verified to, empty if the chain
+	// did not verify.
+	Root string `json:"root,omitempty"`
+}
+
+// SCTReport describes the check of one SCT.
+type SCTReport struct {
+	Subject   string    `json:"subject"`
+	Channel   string    `json:"channel"`
+	LogID     string    `json:"log_id"`
+	Log       string    `json:"log,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature string    `json:"signature,omitempty"`
+	Inclusion string    `json:"inclusion,omitempty"`
+	Valid     bool      `json:"valid"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// RecordReport describes the check of the record of one recorder.
+type RecordReport struct {
+	Recorder string `json:"recorder"`
+	Domain   string `json:"domain,omitempty"`
+	Verdict  string `json:"verdict"`
+	Stage    Stage  `json:"failed_stage,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// FileReport describes the digest check of one file.
+type FileReport struct {
+	Path   string `json:"path,omitempty"`
+	URL    string `json:"url"`
+	Digest string `json:"digest,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewReport describes res and the files checked against it. err is the
+// error verification ended with, if any. res may be nil if verification
+// failed before it started.
+func NewReport(durl string, res *Result, files []FileReport, err error) *Report {
+	rep := &Report{
+		Version: ReportVersion,
+		URL:     durl,
+		SCTs:    []SCTReport{},
+		Files:   files,
+		Verdict: VerdictOK,
+	}
+	if rep.Files == nil {
+		rep.Files = []FileReport{}
+	}
+
+	if err != nil {
+		rep.Verdict = VerdictFail
+		rep.Error = err.Error()
+		if verr, ok := err.(*Error); ok {
+			rep.Stage = verr.Stage
+		}
+	}
+
+	if res == nil {
+		return rep
+	}
+
+	rep.SumsURL = res.SumsURL
+	if len(res.Root) > 0 {
+		rep.SumsDigest = hex.EncodeToString(res.Root)
+		rep.Algorithm = res.Algorithm()
+	}
+	rep.Domain = res.Domain
+	rep.Recorder = res.Recorder
+
+	for _, rr := range res.Records {
+		r := RecordReport{Recorder: rr.Recorder, Domain: rr.Domain, Verdict: VerdictOK}
+		if rr.Err != nil {
+			r.Verdict = VerdictFail
+			r.Error = rr.Err.Error()
+			if verr, ok := rr.Err.(*Error); ok {
+				r.Stage = verr.Stage
+			}
+		}
+		rep.Records = append(rep.Records, r)
+	}
+
+	if len(res.Chain) > 0 {
+		leaf := res.Chain[0]
+		rep.Certificate = &CertificateReport{
+			Serial:    leaf.SerialNumber.Text(16),
+			Subject:   leaf.Subject.String(),
+			Issuer:    leaf.Issuer.String(),
+			NotBefore: leaf.NotBefore,
+			NotAfter:  leaf.NotAfter,
+		}
+		if len(res.VerifiedChain) > 0 {
+			rep.Certificate.Root = res.VerifiedChain[len(res.VerifiedChain)-1].Subject.String()
+		}
+	}
+
+	for _, r := range res.SCTs {
+		sr := SCTReport{
+			Subject:   r.Subject,
+			Channel:   r.Channel,
+			LogID:     base64.StdEncoding.EncodeToString(r.LogID[:]),
+			Timestamp: r.Timestamp,
+			Signature: r.Signature,
+			Inclusion: r.Inclusion,
+			Valid:     r.Valid,
+		}
+		if r.Log != nil {
+			sr.Log = r.Log.Description
+		}
+		if r.Err != nil {
+			sr.Error = r.Err.Error()
+		}
+		rep.SCTs = append(rep.SCTs, sr)
+	}
+
+	rep.Policy = res.Policy
+
+	return rep
+}
@@ -0,0 +1,192 @@
+package rgetverify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// DefaultMaxMemory is the size above which Spool, and so Transport, writes
+// bodies to a temporary file rather than holding them in memory.
+const DefaultMaxMemory = 32 << 20
+
+// Transport is an http.RoundTripper that only returns a response once its
+// body matches the digest recorded for the request URL. The body is read in
+// full, and spooled to disk if large, before the response is returned.
+//
+// Requests that were redirected, for example from a GitHub release download
+// to its storage backend, are verified against the URL originally requested.
+// Redirect responses themselves are returned unverified so the client can
+// follow them; any other status than 200 OK fails the request.
+//
+// A failed verification is returned as an *Error, which http.Client wraps in
+// a *url.Error. The record of each release is cached so further downloads
+// from the same release only need their digest checked.
+type Transport struct {
+	// Verifier checks the record of each release. Its Client must not use
+	// this Transport.
+	Verifier *Verifier
+
+	// Base makes the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+
+	// MaxMemory is the largest body kept in memory, DefaultMaxMemory if
+	// zero. TempDir is where larger bodies are spooled, os.TempDir() if
+	// empty.
+	MaxMemory int64
+	TempDir   string
+
+	mu      sync.Mutex
+	records map[string]*Result // by release sums prefix
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// record returns the verified record of the release of durl, from the cache
+// if possible.
+func (t *Transport) record(req *http.Request, durl string) (*Result, error) {
+	if err := t.Verifier.Resolve(req.Context(), durl); err != nil {
+		return nil, err
+	}
+	prefix, err := rgetwellknown.SumPrefix(durl)
+	if err != nil {
+		return nil, &Error{Stage: StageDomain, Err: err}
+	}
+
+	t.mu.Lock()
+	res, ok := t.records[prefix]
+	t.mu.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	res, err = t.Verifier.Record(req.Context(), durl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if t.records == nil {
+		t.records = make(map[string]*Result)
+	}
+	t.records[prefix] = res
+	t.mu.Unlock()
+
+	return res, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "" && req.Method != http.MethodGet {
+		return nil, fmt.Errorf("rgetverify: cannot verify %s request", req.Method)
+	}
+	if req.Header.Get("Range") != "" {
+		return nil, errors.New("rgetverify: cannot verify range request")
+	}
+
+	// Verify redirected requests against the URL the caller asked for
+	orig := req
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+	durl := orig.URL.String()
+
+	// Check the release before downloading anything from it
+	res, err := t.record(req, durl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, &Error{Stage: StageDownload, Err: err}
+	}
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return resp, nil
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, &Error{Stage: StageDownload, Err: fmt.Errorf("%v: %v", durl, resp.Status)}
+	}
+
+	body, digest, err := Spool(resp.Body, res.Algorithm(), t.MaxMemory, t.TempDir)
+	resp.Body.Close()
+	if err != nil {
+		return nil, &Error{Stage: StageDownload, Err: fmt.Errorf("%v: %v", durl, err)}
+	}
+
+	if err := t.Verifier.CheckDigest(res, durl, digest); err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	resp.Body = body
+	return resp, nil
+}
+
+// Spool reads r into memory, or a temporary file in dir once it grows beyond
+// max bytes, returning a reader over the contents and their digest made with
+// alg. A max of zero uses DefaultMaxMemory. Closing the reader removes any
+// temporary file.
+func Spool(r io.Reader, alg rgethash.Algorithm, max int64, dir string) (io.ReadCloser, []byte, error) {
+	if max == 0 {
+		max = DefaultMaxMemory
+	}
+
+	h := alg.New()
+	var buf bytes.Buffer
+	n, err := io.Copy(io.MultiWriter(h, &buf), io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n <= max {
+		return ioutil.NopCloser(&buf), h.Sum(nil), nil
+	}
+
+	f, err := ioutil.TempFile(dir, "rget")
+	if err != nil {
+		return nil, nil, err
+	}
+	body := &spoolFile{f}
+	if _, err := buf.WriteTo(f); err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(h, f), r); err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+
+	return body, h.Sum(nil), nil
+}
+
+// spoolFile is a response body spooled to a temporary file that is removed
+// when the body is closed.
+type spoolFile struct {
+	*os.File
+}
+
+func (f *spoolFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package rgetverify
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/certificate-transparency-go/x509"
+
+	"go.merklecounty.com/rget/internal/testutil"
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+func TestTransport(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents)
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+
+	// Serve the SHA256SUMS of GitHub releases from the recorder
+	var lookups int
+	recorder := ts.Client().Transport
+	v := &Verifier{
+		Client: &http.Client{Transport: testutil.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			lookups++
+			if req.URL.Host == "github.com" {
+				u, _ := url.Parse(ts.URL + "/SHA256SUMS")
+				req = &http.Request{Method: req.Method, URL: u, Header: req.Header}
+			}
+			return recorder.RoundTrip(req)
+		})},
+		LogList:   &rgetct.LogList{},
+		Roots:     trusted,
+		Policy:    &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}},
+		Discovery: DiscoveryCT,
+		SearchURL: ts.URL + "/",
+	}
+
+	// Serve the release from GitHub, optionally redirecting to storage
+	// which has a tampered copy at badURL, nothing at missingURL, a body
+	// that fails part way at brokenURL and is unreachable at downURL
+	const (
+		goodURL    = "https://storage.example.com/file.txt"
+		badURL     = "https://storage.example.com/bad/file.txt"
+		missingURL = "https://storage.example.com/missing/file.txt"
+		brokenURL  = "https://storage.example.com/broken/file.txt"
+		downURL    = "https://down.example.com/file.txt"
+	)
+	var redirect string
+	base := testutil.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(contents)),
+			Request:    req,
+		}
+		switch req.URL.String() {
+		case testURL:
+			if redirect != "" {
+				resp.StatusCode = http.StatusFound
+				resp.Header.Set("Location", redirect)
+			}
+		case goodURL:
+		case missingURL:
+			resp.StatusCode = http.StatusNotFound
+		case brokenURL:
+			resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(contents[:8]), iotest.TimeoutReader(bytes.NewReader(contents))))
+		case downURL:
+			return nil, errors.New("connection refused")
+		default:
+			resp.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+		}
+		return resp, nil
+	})
+
+	for ti, tt := range []struct {
+		maxMemory int64
+		url       string
+		redirect  string
+		stage     Stage
+	}{
+		{0, testURL, "", ""},
+		{4, testURL, "", ""},
+		{0, testURL, goodURL, ""},
+		{0, testURL, badURL, StageDigest},
+		{0, testURL, missingURL, StageDownload},
+		{0, testURL, brokenURL, StageDownload},
+		{4, testURL, brokenURL, StageDownload},
+		{0, testURL, downURL, StageDownload},
+		{0, strings.Replace(testURL, "file.txt", "other.txt", 1), "", StageDigest},
+	} {
+		redirect = tt.redirect
+		hc := &http.Client{Transport: &Transport{Verifier: v, Base: base, MaxMemory: tt.maxMemory}}
+		resp, err := hc.Get(tt.url)
+		if tt.stage != "" {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("%d: expected verification to fail", ti)
+			} else if verr, ok := err.(*url.Error).Err.(*Error); !ok {
+				t.Errorf("%d: want *Error got %T: %v", ti, err.(*url.Error).Err, err)
+			} else if verr.Stage != tt.stage {
+				t.Errorf("%d: want failure at %q got %q: %v", ti, tt.stage, verr.Stage, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", ti, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%d: %v", ti, err)
+		}
+		if !bytes.Equal(body, contents) {
+			t.Errorf("%d: want body %q got %q", ti, contents, body)
+		}
+	}
+
+	// Downloads from the same release only look the record up once
+	tr := &Transport{Verifier: v, Base: base}
+	hc := &http.Client{Transport: tr}
+	redirect = ""
+	lookups = 0
+	resp, err := hc.Get(testURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if first := lookups; first == 0 {
+		t.Errorf("record was never looked up")
+	} else {
+		resp, err := hc.Get(testURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if lookups != first {
+			t.Errorf("record looked up again: %d requests, want %d", lookups, first)
+		}
+	}
+}
@@ -0,0 +1,726 @@
+// Package rgetverify performs the verification behind rget: a file is only
+// trusted if its digest is in a SHA256SUMS whose own digest is recorded, via
+// a CT logged certificate, by the recorder.
+package rgetverify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/google/certificate-transparency-go/ctutil"
+	"github.com/google/certificate-transparency-go/loglist"
+	"github.com/google/certificate-transparency-go/x509"
+
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+// Ways of discovering the record certificate for a release.
+const (
+	DiscoveryTLS = "tls" // TLS handshake with the recorder
+	DiscoveryCT  = "ct"  // search the CT logs
+)
+
+// Stage identifies the step of verification that failed.
+type Stage string
+
+// Stages of verification in the order they run.
+const (
+	StageSums      Stage = "sums"      // fetching the SHA256SUMS
+	StageDomain    Stage = "domain"    // mapping the URL to its release
+	StageDiscovery Stage = "discovery" // finding the record certificate
+	StageChain     Stage = "chain"     // validating the certificate chain
+	StagePolicy    Stage = "policy"    // meeting the CT policy
+	StageDownload  Stage = "download"  // downloading the file
+	StageDigest    Stage = "digest"    // matching the file digest
+)
+
+// Error is returned when verification fails.
+type Error struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+// Verifier checks files against the SHA256SUMS recorded for their release.
+type Verifier struct {
+	// Client is used for all requests, http.DefaultClient if nil.
+	Client *http.Client
+
+	// LogList is the CT log list SCTs are checked against.
+	LogList *rgetct.LogList
+
+	// Roots the record certificate must chain to, the system roots if nil.
+	Roots *x509.CertPool
+
+	// Policy the SCTs must meet, rgetct.DefaultPolicy if nil.
+	Policy *rgetct.Policy
+
+	// Discovery is DiscoveryTLS, the default, or DiscoveryCT. SearchURL is
+	// the CT search index used by DiscoveryCT, rgetct.DefaultSearchURL if
+	// empty.
+	Discovery string
+	SearchURL string
+
+	// AllowSiblingDigests accepts any digest in the SHA256SUMS rather than
+	// only the one recorded for the URL itself.
+	AllowSiblingDigests bool
+
+	// Algorithms of the sums files Record looks for, in order of
+	// preference, rgethash.Algorithms if empty.
+	Algorithms []rgethash.Algorithm
+
+	// Recorders are the hosts of the recorders a release is looked up
+	// with. If empty those listed by the discovery document of its site
+	// are used, or else rgetwellknown.PublicServiceHost. Quorum is how
+	// many of them must have recorded it, all of them if zero.
+	Recorders []string
+	Quorum    int
+
+	// Resolver fetches the discovery documents of sites not built into
+	// rget, only built in sites are known if nil.
+	Resolver *rgetwellknown.Resolver
+
+	// Sources make the sums of the releases whose files have no sums file
+	// named after its algorithm, such as the packages of registries. The
+	// first that knows the release of a file is used.
+	Sources []SumsSource
+
+	// LogInfo creates the client for a CT log, ctutil.NewLogInfo if nil.
+	LogInfo func(*loglist.Log, *http.Client) (*ctutil.LogInfo, error)
+}
+
+// SumsSource makes the sums of releases whose files are not listed by a
+// sums file named after its algorithm.
+type SumsSource interface {
+	// ReleaseSums returns the sums of the release of durl and the URL they
+	// were read from. ok is false if durl is not a file of a release the
+	// source knows.
+	ReleaseSums(ctx context.Context, durl string) (sums rgethash.URLSumList, sumsURL string, ok bool, err error)
+
+	// ParseSums parses data, read from loc, if it is a sums file of the
+	// source. ok is false if it is not.
+	ParseSums(loc string, data []byte) (sums rgethash.URLSumList, ok bool, err error)
+}
+
+// Result describes a verification, as far as it got.
+type Result struct {
+	URL     string              // URL being verified
+	SumsURL string              // where the SHA256SUMS was read from
+	Sums    rgethash.URLSumList // the SHA256SUMS
+
+	// Proof is the inclusion proof of the file in the SHA256SUMS when
+	// the release is verified from a proof rather than Sums.
+	Proof *rgethash.Proof
+
+	// Root is the Merkle tree root of Sums, or the root Proof leads to,
+	// and Domain is the domain holding it of the recorder serving under
+	// Recorder.
+	Root     []byte
+	Domain   string
+	Recorder string
+
+	// Records are the results for each recorder when there is more than
+	// one. The fields above are then those of the first that verified,
+	// or the first recorder if none did.
+	Records []*Result
+
+	Chain         []*x509.Certificate // record certificate chain found
+	VerifiedChain []*x509.Certificate // Chain as verified to a root
+
+	// TLSSCTs and OCSPSCTs are the SCTs delivered in the TLS handshake and
+	// stapled OCSP response, SCTs embedded in the certificate are not
+	// repeated.
+	TLSSCTs  [][]byte
+	OCSPSCTs [][]byte
+
+	// OCSPErr is why the stapled OCSP response could not be read. It only
+	// fails the OCSP channel.
+	OCSPErr error
+
+	// SCTs are the results of checking every SCT found, including the
+	// same log through several channels.
+	SCTs   []rgetct.SCTResult
+	Policy *rgetct.PolicyResult
+
+	// FileDigest is the SHA-256 digest of the verified file.
+	FileDigest []byte
+
+	// Err is the reason verification failed, always an *Error.
+	Err error
+}
+
+// Algorithm returns the algorithm files are checked with, that of the sums
+// or proof.
+func (res *Result) Algorithm() rgethash.Algorithm {
+	if res.Proof == nil {
+		return res.Sums.Algorithm()
+	}
+	if res.Proof.Algorithm == "" {
+		return rgethash.SHA256
+	}
+	return res.Proof.Algorithm
+}
+
+func (v *Verifier) client() *http.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+	return http.DefaultClient
+}
+
+func (res *Result) fail(stage Stage, err error) error {
+	res.Err = &Error{Stage: stage, Err: err}
+	return res.Err
+}
+
+// algorithms returns the algorithms of the sums files looked for in order of
+// preference.
+func (v *Verifier) algorithms() []rgethash.Algorithm {
+	if len(v.Algorithms) > 0 {
+		return v.Algorithms
+	}
+	return rgethash.Algorithms
+}
+
+// recorders returns the hosts of the recorders and how many of them must
+// have recorded the release of durl. Hosts are case insensitive so one
+// listed twice in another case only counts once towards the quorum.
+func (v *Verifier) recorders(durl string) ([]string, int) {
+	hosts := v.Recorders
+	if len(hosts) == 0 {
+		hosts = rgetwellknown.Recorders(durl)
+	}
+	var recorders []string
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		h = strings.TrimSuffix(strings.ToLower(h), ".")
+		if !seen[h] {
+			seen[h] = true
+			recorders = append(recorders, h)
+		}
+	}
+	if len(recorders) == 0 {
+		recorders = []string{rgetwellknown.PublicServiceHost}
+	}
+	if v.Quorum <= 0 {
+		return recorders, len(recorders)
+	}
+	return recorders, v.Quorum
+}
+
+// Resolve makes the release of durl known to rgetwellknown, fetching the
+// discovery document of its site with Resolver if it is not built in. Record
+// and the other methods verifying a release call it first.
+func (v *Verifier) Resolve(ctx context.Context, durl string) error {
+	if v.Resolver == nil {
+		return nil
+	}
+	if _, err := v.Resolver.Resolve(ctx, durl); err != nil {
+		return &Error{Stage: StageDomain, Err: err}
+	}
+	return nil
+}
+
+// SumsLocations returns the URLs of the sums files looked for by Record for
+// durl in order of preference.
+func (v *Verifier) SumsLocations(durl string) ([]string, error) {
+	prefix, err := rgetwellknown.SumPrefix(durl)
+	if err != nil {
+		return nil, err
+	}
+
+	var locs []string
+	for _, a := range v.algorithms() {
+		locs = append(locs, prefix+a.SumFile())
+	}
+	return locs, nil
+}
+
+// notFoundError is returned by readSums for a sums file that does not exist.
+type notFoundError struct {
+	loc string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("%v: not found", e.loc)
+}
+
+// readSums reads the sums file at loc which is either a URL or a local file
+// path.
+func (v *Verifier) readSums(ctx context.Context, loc string) ([]byte, error) {
+	if !strings.HasPrefix(loc, "https://") && !strings.HasPrefix(loc, "http://") {
+		data, err := ioutil.ReadFile(loc)
+		if os.IsNotExist(err) {
+			return nil, &notFoundError{loc}
+		}
+		return data, err
+	}
+
+	resp, err := ctxhttp.Get(ctx, v.client(), loc)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, &notFoundError{loc}
+	default:
+		return nil, fmt.Errorf("%v: %v", loc, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// FetchSums reads the sums file at loc which is either a URL or a local file
+// path. The algorithm of the file is found from its name or, if it is not
+// named after one, from its digests.
+func (v *Verifier) FetchSums(ctx context.Context, loc string) (rgethash.URLSumList, error) {
+	data, err := v.readSums(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+	return v.parseSums(loc, data)
+}
+
+// parseSums parses the sums file read from loc, which may be a sums file of
+// one of Sources.
+func (v *Verifier) parseSums(loc string, data []byte) (rgethash.URLSumList, error) {
+	for _, src := range v.Sources {
+		if sums, ok, err := src.ParseSums(loc, data); ok {
+			return sums, err
+		}
+	}
+
+	algs := v.algorithms()
+	if a, err := rgethash.AlgorithmForFile(path.Base(loc)); err == nil {
+		algs = []rgethash.Algorithm{a}
+	}
+
+	var firstErr error
+	for _, a := range algs {
+		sums, err := rgethash.ParseSumFile(string(data), a)
+		if err == nil {
+			return sums, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, fmt.Errorf("%v: %v", loc, firstErr)
+}
+
+// Record reads the sums file for durl, from sumsLoc if not empty or else
+// the first of SumsLocations that exists, and checks that it is recorded.
+// The sums of the releases Sources know are made by them instead. The
+// returned Result is filled in as far as verification
+// got even if an error is returned.
+func (v *Verifier) Record(ctx context.Context, durl, sumsLoc string) (*Result, error) {
+	res := &Result{URL: durl, SumsURL: sumsLoc}
+	if err := v.Resolve(ctx, durl); err != nil {
+		res.Err = err
+		return res, err
+	}
+	if sumsLoc == "" {
+		for _, src := range v.Sources {
+			sums, u, ok, err := src.ReleaseSums(ctx, durl)
+			if !ok {
+				continue
+			}
+			res.SumsURL = u
+			if err != nil {
+				return res, res.fail(StageSums, err)
+			}
+			res.Sums = sums
+			return res, v.verifyRecord(ctx, res)
+		}
+	}
+
+	locs := []string{sumsLoc}
+	if sumsLoc == "" {
+		var err error
+		locs, err = v.SumsLocations(durl)
+		if err != nil {
+			return res, res.fail(StageDomain, err)
+		}
+	}
+
+	var data []byte
+	var err error
+	for _, loc := range locs {
+		data, err = v.readSums(ctx, loc)
+		if _, ok := err.(*notFoundError); ok && len(locs) > 1 {
+			continue
+		}
+		res.SumsURL = loc
+		break
+	}
+	if res.SumsURL == "" {
+		return res, res.fail(StageSums, fmt.Errorf("no sums file found at %q", locs))
+	}
+	if err != nil {
+		return res, res.fail(StageSums, err)
+	}
+
+	res.Sums, err = v.parseSums(res.SumsURL, data)
+	if err != nil {
+		return res, res.fail(StageSums, err)
+	}
+
+	return res, v.verifyRecord(ctx, res)
+}
+
+// RecordProof checks that the tree root p leads to is recorded for the
+// release of durl. The record certificate chain, leaf first, is discovered if
+// chain is empty. Only the file of p can then be checked with CheckDigest.
+func (v *Verifier) RecordProof(ctx context.Context, durl string, p *rgethash.Proof, chain []*x509.Certificate) (*Result, error) {
+	res := &Result{URL: durl, Proof: p, Chain: chain}
+	if err := v.Resolve(ctx, durl); err != nil {
+		res.Err = err
+		return res, err
+	}
+	return res, v.verifyRecord(ctx, res)
+}
+
+// RecordSums checks that sums, made by the caller rather than read from a
+// sums file, are recorded for the release of durl. Images are verified this
+// way from the digests their registry lists.
+func (v *Verifier) RecordSums(ctx context.Context, durl string, sums rgethash.URLSumList) (*Result, error) {
+	res := &Result{URL: durl, Sums: sums}
+	if err := v.Resolve(ctx, durl); err != nil {
+		res.Err = err
+		return res, err
+	}
+	return res, v.verifyRecord(ctx, res)
+}
+
+func (v *Verifier) verifyRecord(ctx context.Context, res *Result) error {
+	recorders, quorum := v.recorders(res.URL)
+	if quorum > len(recorders) {
+		return res.fail(StagePolicy, fmt.Errorf("quorum of %d with only %d recorders", quorum, len(recorders)))
+	}
+	if len(recorders) == 1 {
+		res.Recorder = recorders[0]
+		return v.verifyRecorder(ctx, res)
+	}
+
+	var verified []*Result
+	var failed []string
+	var firstErr *Error
+	for _, host := range recorders {
+		rr := &Result{
+			URL:      res.URL,
+			SumsURL:  res.SumsURL,
+			Sums:     res.Sums,
+			Proof:    res.Proof,
+			Chain:    res.Chain,
+			Recorder: host,
+		}
+		res.Records = append(res.Records, rr)
+
+		if err := v.verifyRecorder(ctx, rr); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", host, err))
+			if firstErr == nil {
+				firstErr = err.(*Error)
+			}
+			continue
+		}
+		verified = append(verified, rr)
+	}
+
+	first := res.Records[0]
+	if len(verified) > 0 {
+		first = verified[0]
+	}
+	records := res.Records
+	*res = *first
+	res.Records = records
+
+	if len(verified) < quorum {
+		return res.fail(firstErr.Stage, fmt.Errorf("recorded by %d of %d recorders, %d required: %s",
+			len(verified), len(recorders), quorum, strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
+// verifyRecorder checks that the tree root of res is recorded by the
+// recorder serving under res.Recorder.
+func (v *Verifier) verifyRecorder(ctx context.Context, res *Result) error {
+	hc := v.client()
+
+	domains, err := recordDomains(res, res.Recorder)
+	if err != nil {
+		return res.fail(StageDomain, err)
+	}
+
+	var chainTime time.Time
+	if len(res.Chain) > 0 {
+		// A chain that was supplied may have expired since
+		d := chainDomain(res.Chain[0], domains)
+		res.Domain, res.Root = d.domain, d.root
+		chainTime = res.Chain[0].NotBefore
+	} else {
+		// Releases recorded before the current scheme are only found
+		// under the domain of an older one
+		var firstErr error
+		for _, d := range domains {
+			res.Domain, res.Root = d.domain, d.root
+			chainTime, err = v.discover(ctx, res, hc)
+			if err == nil {
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if err != nil {
+			res.Domain, res.Root = domains[0].domain, domains[0].root
+			return res.fail(StageDiscovery, firstErr)
+		}
+	}
+
+	lf := v.LogInfo
+	if lf == nil {
+		lf = ctutil.NewLogInfo
+	}
+	return v.checkRecord(ctx, res, chainTime, lf, hc)
+}
+
+// discover finds the record certificate chain of res.Domain and returns the
+// time it must be valid at.
+func (v *Verifier) discover(ctx context.Context, res *Result, hc *http.Client) (time.Time, error) {
+	cturl := "https://" + res.Domain
+
+	var err error
+	chainTime := time.Now()
+	switch v.Discovery {
+	case "", DiscoveryTLS:
+		res.Chain, res.TLSSCTs, res.OCSPSCTs, res.OCSPErr, err = rgetct.GetSiteSCTs(ctx, cturl, hc)
+	case DiscoveryCT:
+		// Look the certificate up in the logs and check it was valid
+		// when issued as the recorder may not have renewed it
+		searchURL := v.SearchURL
+		if searchURL == "" {
+			searchURL = rgetct.DefaultSearchURL
+		}
+		res.Chain, err = rgetct.SearchLoggedCert(ctx, searchURL, res.Domain, hc)
+		if err == nil {
+			chainTime = res.Chain[0].NotBefore
+		}
+	default:
+		err = fmt.Errorf("unknown discovery mode %q", v.Discovery)
+	}
+	if err != nil {
+		return chainTime, fmt.Errorf("%s: failed to get cert chain: %v", cturl, err)
+	}
+	return chainTime, nil
+}
+
+// recordDomain is a domain a release may be recorded under and the tree
+// root it holds.
+type recordDomain struct {
+	domain string
+	root   []byte
+}
+
+// recordDomains returns the domains of the tree root of res, made from its
+// sums or its proof if it has one, of the recorder serving under host under
+// each of rgetwellknown.Schemes in order. A proof only leads to the root of
+// its own scheme.
+func recordDomains(res *Result, host string) ([]recordDomain, error) {
+	var roots []rgetwellknown.Scheme
+	if res.Proof != nil {
+		if _, err := rgethash.ParseAlgorithm(string(res.Proof.Algorithm)); err != nil {
+			return nil, err
+		}
+		roots = []rgetwellknown.Scheme{res.Proof.Scheme}
+	} else {
+		roots = rgetwellknown.Schemes
+	}
+
+	var domains []recordDomain
+	for _, scheme := range roots {
+		var root []byte
+		if res.Proof != nil {
+			var err error
+			if root, err = res.Proof.Root(); err != nil {
+				return nil, fmt.Errorf("inclusion proof: %v", err)
+			}
+		} else {
+			root = res.Sums.SchemeRoot(scheme)
+		}
+		d, err := rgethash.RecordDomain(root, res.Algorithm(), res.URL, scheme)
+		if err != nil {
+			return nil, err
+		}
+		d += "." + host
+		if err := rgetwellknown.CheckDomain(d); err != nil {
+			return nil, err
+		}
+		domains = append(domains, recordDomain{domain: d, root: root})
+	}
+	return domains, nil
+}
+
+// chainDomain returns the first of domains leaf is valid for, or the first
+// domain if there is none so the chain fails verification.
+func chainDomain(leaf *x509.Certificate, domains []recordDomain) recordDomain {
+	for _, d := range domains {
+		if leaf.VerifyHostname(d.domain) == nil {
+			return d
+		}
+	}
+	return domains[0]
+}
+
+// checkRecord checks the certificate chain and SCTs found for res at
+// chainTime, using lf to create the log clients.
+func (v *Verifier) checkRecord(ctx context.Context, res *Result, chainTime time.Time, lf func(*loglist.Log, *http.Client) (*ctutil.LogInfo, error), hc *http.Client) error {
+	var err error
+	if v.LogList == nil {
+		return res.fail(StagePolicy, errors.New("no CT log list"))
+	}
+
+	policy := v.Policy
+	if policy == nil {
+		policy, err = rgetct.PolicyByName(rgetct.DefaultPolicy)
+		if err != nil {
+			return res.fail(StagePolicy, err)
+		}
+	}
+
+	roots := v.Roots
+	if roots == nil {
+		roots, err = rgetct.LoadRoots(rgetct.RootsSystem)
+		if err != nil {
+			return res.fail(StageChain, err)
+		}
+	}
+
+	// Check the x509 chain before trusting anything it carries
+	res.VerifiedChain, err = rgetct.VerifyChainAt(res.Chain, res.Domain, roots, chainTime)
+	if err != nil {
+		return res.fail(StageChain, err)
+	}
+
+	// Check SCTs from every delivery channel, the policy counts each log
+	// once
+	ll := &v.LogList.LogList
+	res.SCTs = rgetct.CheckX509(ctx, lf, res.Chain, ll, hc)
+	res.SCTs = append(res.SCTs, rgetct.CheckTLS(ctx, res.TLSSCTs, res.Chain, lf, "https://"+res.Domain, ll, hc)...)
+	res.SCTs = append(res.SCTs, rgetct.CheckOCSP(ctx, res.OCSPSCTs, res.Chain, lf, ll, hc)...)
+	if res.OCSPErr != nil {
+		res.SCTs = append(res.SCTs, rgetct.OCSPFailure(res.OCSPErr))
+	}
+
+	res.Policy = policy.Evaluate(res.Chain[0], res.SCTs, v.LogList)
+	if !res.Policy.OK {
+		return res.fail(StagePolicy, fmt.Errorf("record certificate does not meet policy %s", res.Policy.Policy))
+	}
+
+	return nil
+}
+
+// CheckDigest checks that digest is in the SHA256SUMS of a recorded res for
+// the file at durl. Only the entry for durl is accepted unless
+// AllowSiblingDigests is set. The leaves of the trees proofs are made for
+// bind the names of their entries, so the entry of a proof must be named
+// for durl too.
+func (v *Verifier) CheckDigest(res *Result, durl string, digest []byte) error {
+	var err error
+	switch {
+	case res.Proof != nil:
+		if !v.AllowSiblingDigests {
+			err = checkProofName(res.Proof, durl)
+		}
+		if err == nil && !bytes.Equal(res.Proof.Sum, digest) {
+			err = fmt.Errorf("expected %x for %q got %x", res.Proof.Sum, res.Proof.Name, digest)
+		}
+	case v.AllowSiblingDigests:
+		if !res.Sums.SumExists(digest) {
+			err = fmt.Errorf("cannot find %x", digest)
+		}
+	default:
+		var names []string
+		names, err = rgetwellknown.SumNames(durl)
+		if err == nil {
+			err = res.Sums.CheckSum(names, digest)
+		}
+	}
+	if err != nil {
+		return &Error{Stage: StageDigest, Err: fmt.Errorf("https://%v list: %v", res.Domain, err)}
+	}
+	return nil
+}
+
+// checkProofName returns an error unless the entry of p is listed under one
+// of the names of durl.
+func checkProofName(p *rgethash.Proof, durl string) error {
+	names, err := rgetwellknown.SumNames(durl)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if p.Name == n {
+			return nil
+		}
+	}
+	return fmt.Errorf("proof is for %q not %q", p.Name, names)
+}
+
+// Verify checks the contents of r, downloaded from durl, against the
+// recorded SHA256SUMS for durl.
+func (v *Verifier) Verify(ctx context.Context, durl string, r io.Reader) (*Result, error) {
+	res, err := v.Record(ctx, durl, "")
+	if err != nil {
+		return res, err
+	}
+
+	res.FileDigest, err = res.Algorithm().Digest(r)
+	if err != nil {
+		return res, res.fail(StageDigest, err)
+	}
+
+	if err := v.CheckDigest(res, durl, res.FileDigest); err != nil {
+		res.Err = err
+		return res, err
+	}
+	return res, nil
+}
+
+// VerifyFile is like Verify for the file at path.
+func (v *Verifier) VerifyFile(ctx context.Context, durl, path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return v.Verify(ctx, durl, f)
+}
+
+// FileDigest returns the digest of the file at path made with alg.
+func FileDigest(alg rgethash.Algorithm, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return alg.Digest(f)
+}
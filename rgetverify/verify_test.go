@@ -0,0 +1,528 @@
+package rgetverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+
+	"go.merklecounty.com/rget/internal/testutil"
+	"go.merklecounty.com/rget/rgetapt"
+	"go.merklecounty.com/rget/rgetct"
+	"go.merklecounty.com/rget/rgethash"
+	"go.merklecounty.com/rget/rgetregistry"
+	"go.merklecounty.com/rget/rgetwellknown"
+)
+
+const testURL = "https://github.com/org/repo/releases/download/v1.0/file.txt"
+
+// newRecorder serves a sums file made with alg for contents and a CT search
+// index with a self-signed record certificate for it under scheme. The
+// certificate is for the record domain of each of hosts, of
+// rgetwellknown.PublicServiceHost if there are none.
+func newRecorder(t *testing.T, scheme rgetwellknown.Scheme, alg rgethash.Algorithm, contents []byte, hosts ...string) (*httptest.Server, *x509.Certificate) {
+	digest, err := alg.Digest(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumsFile := fmt.Sprintf("%x  file.txt\n", digest)
+
+	sums, err := rgethash.ParseSumFile(sumsFile, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain, err := sums.RecordDomain(testURL, scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) == 0 {
+		hosts = []string{rgetwellknown.PublicServiceHost}
+	}
+	recorded := make(map[string]bool)
+	var domains []string
+	for _, host := range hosts {
+		recorded[domain+"."+host] = true
+		domains = append(domains, domain+"."+host)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	tmpl.SCTList.SCTList = []x509.SerializedSCT{{Val: []byte{1, 2, 3}}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/"+alg.SumFile():
+			w.Write([]byte(sumsFile))
+		case strings.HasSuffix(r.URL.Path, "SUMS"):
+			http.NotFound(w, r)
+		case r.URL.Query().Get("d") == "1":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		case recorded[r.URL.Query().Get("q")]:
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 1, "name_value": r.URL.Query().Get("q"), "not_before": "2019-10-01T00:00:00"},
+			})
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+
+	return ts, cert
+}
+
+func TestVerify(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents)
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+
+	// A policy that is met without any valid SCTs as the test
+	// certificate is not logged
+	noSCTs := &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}}
+	anySCT, err := rgetct.PolicyByName("any")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ti, tt := range []struct {
+		roots    *x509.CertPool
+		policy   *rgetct.Policy
+		contents []byte
+		stage    Stage
+	}{
+		{trusted, noSCTs, contents, ""},
+		{trusted, noSCTs, []byte("tampered"), StageDigest},
+		{x509.NewCertPool(), noSCTs, contents, StageChain},
+		{trusted, anySCT, contents, StagePolicy},
+	} {
+		v := &Verifier{
+			Client:    ts.Client(),
+			LogList:   &rgetct.LogList{},
+			Roots:     tt.roots,
+			Policy:    tt.policy,
+			Discovery: DiscoveryCT,
+			SearchURL: ts.URL + "/",
+		}
+
+		res, err := v.Record(context.Background(), testURL, ts.URL+"/SHA256SUMS")
+		if err == nil {
+			var digest []byte
+			digest, err = rgethash.SHA256.Digest(bytes.NewReader(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = v.CheckDigest(res, testURL, digest)
+		}
+
+		var stage Stage
+		if verr, ok := err.(*Error); ok {
+			stage = verr.Stage
+		} else if err != nil {
+			t.Errorf("%d: unexpected error type %T: %v", ti, err, err)
+			continue
+		}
+		if stage != tt.stage {
+			t.Errorf("%d: want failure at %q got %q: %v", ti, tt.stage, stage, err)
+		}
+
+		rep := NewReport(testURL, res, nil, err)
+		if rep.Stage != tt.stage || (rep.Verdict == VerdictOK) != (tt.stage == "") {
+			t.Errorf("%d: report has verdict %q at %q", ti, rep.Verdict, rep.Stage)
+		}
+		if rep.Certificate == nil || rep.Certificate.Serial != "1" {
+			t.Errorf("%d: report missing certificate: %+v", ti, rep.Certificate)
+		}
+	}
+}
+
+func TestRecordProof(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents)
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+	noSCTs := &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}}
+
+	digest := sha256.Sum256(contents)
+	sums := rgethash.URLSumList{{URL: "file.txt", Sum: digest[:], Algorithm: rgethash.SHA256}}
+	proof, err := sums.InclusionProof("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := *proof
+	other.Sum = []byte("other")
+	renamed := *proof
+	renamed.Name = "other.txt"
+	digestOnly := *proof
+	digestOnly.Scheme = rgetwellknown.Scheme1
+
+	for ti, tt := range []struct {
+		proof    *rgethash.Proof
+		chain    []*x509.Certificate
+		durl     string
+		contents []byte
+		siblings bool
+		stage    Stage
+	}{
+		{proof, nil, testURL, contents, false, ""},
+		{proof, []*x509.Certificate{cert}, testURL, contents, false, ""},
+		{proof, nil, testURL, []byte("tampered"), false, StageDigest},
+		// The name of the entry is part of the proof
+		{proof, nil, "https://github.com/org/repo/releases/download/v1.0/other.txt", contents, false, StageDigest},
+		{proof, nil, "https://github.com/org/repo/releases/download/v1.0/other.txt", contents, true, ""},
+		// A proof for another digest or name leads to a root that is not recorded
+		{&other, nil, testURL, contents, false, StageDiscovery},
+		{&renamed, nil, "https://github.com/org/repo/releases/download/v1.0/other.txt", contents, false, StageDiscovery},
+		// Trees of digests alone cannot prove the name
+		{&digestOnly, nil, testURL, contents, false, StageDomain},
+	} {
+		v := &Verifier{
+			Client:    ts.Client(),
+			LogList:   &rgetct.LogList{},
+			Roots:     trusted,
+			Policy:    noSCTs,
+			Discovery: DiscoveryCT,
+			SearchURL: ts.URL + "/",
+
+			AllowSiblingDigests: tt.siblings,
+		}
+		if tt.chain != nil {
+			// A supplied chain needs no discovery
+			v.SearchURL = "https://invalid.example/"
+		}
+
+		res, err := v.RecordProof(context.Background(), tt.durl, tt.proof, tt.chain)
+		if err == nil {
+			var digest []byte
+			digest, err = rgethash.SHA256.Digest(bytes.NewReader(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = v.CheckDigest(res, tt.durl, digest)
+		}
+
+		var stage Stage
+		if verr, ok := err.(*Error); ok {
+			stage = verr.Stage
+		} else if err != nil {
+			t.Errorf("%d: unexpected error type %T: %v", ti, err, err)
+			continue
+		}
+		if stage != tt.stage {
+			t.Errorf("%d: want failure at %q got %q: %v", ti, tt.stage, stage, err)
+		}
+	}
+}
+
+func TestRecordSchemes(t *testing.T) {
+	contents := []byte("release contents\n")
+	noSCTs := &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}}
+
+	for ti, tt := range []struct {
+		scheme rgetwellknown.Scheme
+		served rgethash.Algorithm
+		prefer []rgethash.Algorithm
+		stage  Stage
+	}{
+		{rgetwellknown.CurrentScheme, rgethash.SHA256, nil, ""},
+		{rgetwellknown.CurrentScheme, rgethash.SHA512, nil, ""},
+		{rgetwellknown.CurrentScheme, rgethash.SHA512, []rgethash.Algorithm{rgethash.SHA512, rgethash.SHA256}, ""},
+		{rgetwellknown.CurrentScheme, rgethash.SHA256, []rgethash.Algorithm{rgethash.SHA512}, StageSums},
+		// Releases recorded under older schemes
+		{rgetwellknown.Scheme1, rgethash.SHA256, nil, ""},
+		{rgetwellknown.Scheme1, rgethash.SHA512, nil, ""},
+		{rgetwellknown.Scheme0, rgethash.SHA256, nil, ""},
+		{rgetwellknown.Scheme0, rgethash.SHA512, nil, ""},
+	} {
+		ts, cert := newRecorder(t, tt.scheme, tt.served, contents)
+		trusted := x509.NewCertPool()
+		trusted.AddCert(cert)
+
+		// Serve the sums files of GitHub releases from the recorder
+		recorder := ts.Client().Transport
+		v := &Verifier{
+			Client: &http.Client{Transport: testutil.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.Host == "github.com" {
+					u, _ := url.Parse(ts.URL + "/" + path.Base(req.URL.Path))
+					req = &http.Request{Method: req.Method, URL: u, Header: req.Header}
+				}
+				return recorder.RoundTrip(req)
+			})},
+			LogList:    &rgetct.LogList{},
+			Roots:      trusted,
+			Policy:     noSCTs,
+			Discovery:  DiscoveryCT,
+			SearchURL:  ts.URL + "/",
+			Algorithms: tt.prefer,
+		}
+
+		res, err := v.Verify(context.Background(), testURL, bytes.NewReader(contents))
+		ts.Close()
+
+		var stage Stage
+		if verr, ok := err.(*Error); ok {
+			stage = verr.Stage
+		} else if err != nil {
+			t.Errorf("%d: unexpected error type %T: %v", ti, err, err)
+			continue
+		}
+		if stage != tt.stage {
+			t.Errorf("%d: want failure at %q got %q: %v", ti, tt.stage, stage, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if res.Algorithm() != tt.served || !strings.HasSuffix(res.SumsURL, tt.served.SumFile()) {
+			t.Errorf("%d: verified with %v from %v", ti, res.Algorithm(), res.SumsURL)
+		}
+		if len(res.FileDigest) != tt.served.Size() {
+			t.Errorf("%d: file digest %x is not %v", ti, res.FileDigest, tt.served)
+		}
+		want, err := rgethash.RecordDomain(res.Root, tt.served, testURL, tt.scheme)
+		if err != nil || res.Domain != want+"."+rgetwellknown.PublicServiceHost {
+			t.Errorf("%d: domain %v want %v: %v", ti, res.Domain, want, err)
+		}
+	}
+}
+
+func TestRecordQuorum(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents, "a.example.com", "b.example.com")
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+	noSCTs := &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}}
+
+	for ti, tt := range []struct {
+		recorders []string
+		quorum    int
+		recorder  string
+		stage     Stage
+	}{
+		{[]string{"a.example.com"}, 0, "a.example.com", ""},
+		{[]string{"a.example.com", "b.example.com"}, 0, "a.example.com", ""},
+		{[]string{"c.example.com", "b.example.com", "a.example.com"}, 2, "b.example.com", ""},
+		{[]string{"c.example.com", "b.example.com", "a.example.com"}, 0, "b.example.com", StageDiscovery},
+		{[]string{"c.example.com", "d.example.com", "a.example.com"}, 2, "a.example.com", StageDiscovery},
+		{[]string{"a.example.com"}, 2, "", StagePolicy},
+		// Only the public recorder by default
+		{nil, 0, rgetwellknown.PublicServiceHost, StageDiscovery},
+	} {
+		v := &Verifier{
+			Client:    ts.Client(),
+			LogList:   &rgetct.LogList{},
+			Roots:     trusted,
+			Policy:    noSCTs,
+			Discovery: DiscoveryCT,
+			SearchURL: ts.URL + "/",
+			Recorders: tt.recorders,
+			Quorum:    tt.quorum,
+		}
+
+		res, err := v.Record(context.Background(), testURL, ts.URL+"/SHA256SUMS")
+
+		var stage Stage
+		if verr, ok := err.(*Error); ok {
+			stage = verr.Stage
+		} else if err != nil {
+			t.Errorf("%d: unexpected error type %T: %v", ti, err, err)
+			continue
+		}
+		if stage != tt.stage {
+			t.Errorf("%d: want failure at %q got %q: %v", ti, tt.stage, stage, err)
+		}
+		if res.Recorder != tt.recorder || (tt.recorder != "" && !strings.HasSuffix(res.Domain, "."+tt.recorder)) {
+			t.Errorf("%d: recorder %q with domain %v want %q", ti, res.Recorder, res.Domain, tt.recorder)
+		}
+		if n := len(tt.recorders); n > 1 && len(res.Records) != n {
+			t.Errorf("%d: %d records for %d recorders", ti, len(res.Records), n)
+		}
+	}
+}
+
+func TestRecorders(t *testing.T) {
+	doc, err := rgetwellknown.ParseDocument("downloads.example.org", []byte(`{
+  "version": 1,
+  "patterns": [{"regexp": "(?P<root>downloads\\.example\\.org)/(?P<tag>[a-z0-9.]+)/(?P<file>[a-z.]+)", "domain": "{dnstag}.{root}"}],
+  "recorders": ["a.example.com", "b.example.com"]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgetwellknown.Register(doc)
+
+	const site = "https://downloads.example.org/v1.0/file.txt"
+	for ti, tt := range []struct {
+		recorders []string
+		durl      string
+		want      []string
+	}{
+		{nil, testURL, []string{rgetwellknown.PublicServiceHost}},
+		{nil, site, []string{"a.example.com", "b.example.com"}},
+		{[]string{"c.example.com"}, site, []string{"c.example.com"}},
+		{[]string{"c.example.com", "C.Example.com", "c.example.com."}, site, []string{"c.example.com"}},
+	} {
+		v := &Verifier{Recorders: tt.recorders}
+		if got, quorum := v.recorders(tt.durl); !reflect.DeepEqual(got, tt.want) || quorum != len(tt.want) {
+			t.Errorf("%d: recorders %v quorum %d want %v", ti, got, quorum, tt.want)
+		}
+	}
+}
+
+func TestRecordSums(t *testing.T) {
+	contents := []byte("release contents\n")
+	ts, cert := newRecorder(t, rgetwellknown.CurrentScheme, rgethash.SHA256, contents)
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(cert)
+
+	v := &Verifier{
+		Client:    ts.Client(),
+		LogList:   &rgetct.LogList{},
+		Roots:     trusted,
+		Policy:    &rgetct.Policy{Name: "test", Lifetimes: []rgetct.LifetimeRule{{MinSCTs: 0}}},
+		Discovery: DiscoveryCT,
+		SearchURL: ts.URL + "/",
+	}
+
+	digest := sha256.Sum256(contents)
+	sums := rgethash.URLSumList{{URL: "file.txt", Sum: digest[:], Algorithm: rgethash.SHA256}}
+	if _, err := v.RecordSums(context.Background(), testURL, sums); err != nil {
+		t.Errorf("recorded sums: %v", err)
+	}
+
+	sums[0].Sum = make([]byte, sha256.Size)
+	_, err := v.RecordSums(context.Background(), testURL, sums)
+	if verr, ok := err.(*Error); !ok || verr.Stage != StageDiscovery {
+		t.Errorf("unrecorded sums: %v", err)
+	}
+}
+
+func TestRecordPackage(t *testing.T) {
+	const (
+		dir   = "https://files.pythonhosted.org/packages/36/7a/87837f39d0296e723bb9b62bbb257d0355c7f6128853c78955f57342a56d/"
+		wheel = "python_dateutil-2.8.2-py2.py3-none-any.whl"
+	)
+	digest := sha256.Sum256([]byte("wheel"))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pypi/python-dateutil/2.8.2/json":
+			fmt.Fprintf(w, `{"urls": [{"filename": %q, "url": %q, "digests": {"sha256": "%x"}}]}`, wheel, dir+wheel, digest)
+		case "/":
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	v := &Verifier{
+		Client:    ts.Client(),
+		LogList:   &rgetct.LogList{},
+		Discovery: DiscoveryCT,
+		SearchURL: ts.URL + "/",
+		Sources:   []SumsSource{&rgetregistry.Client{PyPI: ts.URL, HTTPClient: ts.Client()}},
+	}
+
+	// The sums are made from the metadata, and are not recorded
+	res, err := v.Record(context.Background(), dir+wheel, "")
+	if verr, ok := err.(*Error); !ok || verr.Stage != StageDiscovery {
+		t.Errorf("unrecorded package: %v", err)
+	}
+	if res.SumsURL != ts.URL+"/pypi/python-dateutil/2.8.2/json" {
+		t.Errorf("sums read from %v", res.SumsURL)
+	}
+	want := rgethash.URLSumList{{URL: dir + wheel, Sum: digest[:], Algorithm: rgethash.SHA256}}
+	if !reflect.DeepEqual(res.Sums, want) {
+		t.Errorf("sums %v want %v", res.Sums, want)
+	}
+
+	_, err = v.Record(context.Background(), dir+"python_dateutil-2.9.0-py3-none-any.whl", "")
+	if verr, ok := err.(*Error); !ok || verr.Stage != StageSums {
+		t.Errorf("missing package version: %v", err)
+	}
+}
+
+func TestRecordAptSuite(t *testing.T) {
+	if err := rgetwellknown.AddAptHost("deb.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	const durl = "https://deb.example.com/debian/dists/bookworm/main/binary-amd64/Packages"
+	digest := sha256.Sum256([]byte("Package: rget\n"))
+	release := fmt.Sprintf("Suite: stable\nCodename: bookworm\nSHA256:\n %x 14 main/binary-amd64/Packages\n", digest)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/debian/dists/bookworm/Release":
+			w.Write([]byte(release))
+		case "/":
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Send requests for every site to the test server
+	hc := testutil.RedirectClient(ts.URL)
+	v := &Verifier{
+		Client:    hc,
+		LogList:   &rgetct.LogList{},
+		Discovery: DiscoveryCT,
+		SearchURL: ts.URL + "/",
+		Sources:   []SumsSource{&rgetapt.Client{HTTPClient: hc}},
+	}
+
+	// The InRelease file is looked for first
+	res, err := v.Record(context.Background(), durl, "")
+	if verr, ok := err.(*Error); !ok || verr.Stage != StageDiscovery {
+		t.Errorf("unrecorded suite: %v", err)
+	}
+	if res.SumsURL != "https://deb.example.com/debian/dists/bookworm/Release" {
+		t.Errorf("sums read from %v", res.SumsURL)
+	}
+	want := rgethash.URLSumList{{URL: "main/binary-amd64/Packages", Sum: digest[:], Algorithm: rgethash.SHA256}}
+	if !reflect.DeepEqual(res.Sums, want) {
+		t.Errorf("sums %v want %v", res.Sums, want)
+	}
+}
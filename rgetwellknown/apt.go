@@ -0,0 +1,76 @@
+package rgetwellknown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// aptPaths returns the paths of the files of the suites of the APT
+// repositories at host, the directories under dists. A suite is recorded as
+// a release whose sums are the SHA256 section of its Release file, which
+// names the files relative to the directory of the suite. The "apt-repo"
+// label cannot be made by EncodeLabel so suite domains never clash with
+// release domains.
+func aptPaths(host string) []*vcsPath {
+	root := `(?P<root>` + regexp.QuoteMeta(host) + `)`
+	return []*vcsPath{
+		{
+			prefix: host + "/",
+			// https://deb.debian.org/debian/dists/bookworm/main/binary-amd64/Packages.xz
+			regexp:    regexp.MustCompile(`^` + root + `/(?P<repo>[A-Za-z0-9._\-~]+(?:/[A-Za-z0-9._\-~]+)*)/dists/(?P<tag>[A-Za-z0-9._\-]+)/(?P<file>[A-Za-z0-9._\-+~]+(?:/[A-Za-z0-9._\-+~]+)*)$`),
+			domain:    "{dnstag}.{repo}.apt-repo.{root}",
+			sumPrefix: "https://{root}/{repo}/dists/{tag}/",
+		},
+		{
+			prefix: host + "/dists/",
+			// https://apt.example.com/dists/stable/InRelease
+			regexp:    regexp.MustCompile(`^` + root + `/dists/(?P<tag>[A-Za-z0-9._\-]+)/(?P<file>[A-Za-z0-9._\-+~]+(?:/[A-Za-z0-9._\-+~]+)*)$`),
+			domain:    "{dnstag}.apt-repo.{root}",
+			sumPrefix: "https://{root}/dists/{tag}/",
+		},
+	}
+}
+
+// aptHosts are the hosts added with AddAptHost. Their paths follow those of
+// the forges and registries.
+var aptHosts = struct {
+	sync.RWMutex
+	paths []*vcsPath
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+var aptHost = regexp.MustCompile(`^[a-z0-9.\-]+$`)
+
+// AddAptHost makes the files of the APT repositories at host known. Any
+// URL of host with a dists/SUITE/ directory is then taken to be of a suite.
+// Only the suites of added hosts are recorded, so a recorder never fetches
+// from hosts it was not configured for.
+func AddAptHost(host string) error {
+	host = strings.ToLower(host)
+	if !aptHost.MatchString(host) {
+		return fmt.Errorf("invalid APT repository host %q", host)
+	}
+
+	aptHosts.Lock()
+	defer aptHosts.Unlock()
+	if aptHosts.hosts[host] {
+		return nil
+	}
+	aptHosts.hosts[host] = true
+	for _, p := range aptPaths(host) {
+		p.source = SourceBuiltin
+		aptHosts.paths = append(aptHosts.paths, p)
+	}
+	return nil
+}
+
+// AptMatches returns a parsed out matches map for the URLs of the files of
+// APT repository suites, which are checked against the Release file of the
+// suite rather than a sums file.
+func AptMatches(target string) (map[string]string, error) {
+	aptHosts.RLock()
+	defer aptHosts.RUnlock()
+	return matchesFromURL(target, aptHosts.paths)
+}
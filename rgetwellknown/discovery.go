@@ -0,0 +1,363 @@
+package rgetwellknown
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DocumentPath is where a site publishes the Document describing its
+// releases, see Documentation/wellknown.md.
+const DocumentPath = "/.well-known/rget.json"
+
+// DocumentVersion is the only version of Document understood.
+const DocumentVersion = 1
+
+// DefaultTTL is how long a Resolver uses a Document before fetching it again.
+const DefaultTTL = 24 * time.Hour
+
+// maxDocument is the largest Document read.
+const maxDocument = 1 << 20
+
+// Document lets a site that is not built into rget describe how its
+// download URLs map to releases.
+type Document struct {
+	Version  int       `json:"version"`
+	Patterns []Pattern `json:"patterns"`
+
+	// Recorders are the hosts of the recorders the site's releases are
+	// recorded by.
+	Recorders []string `json:"recorders,omitempty"`
+
+	host  string
+	paths []*vcsPath
+}
+
+// ParseDocument parses the Document published by host.
+func ParseDocument(host string, data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %v%v: %v", host, DocumentPath, err)
+	}
+	if doc.Version != DocumentVersion {
+		return nil, fmt.Errorf("%v%v: unsupported version %d", host, DocumentPath, doc.Version)
+	}
+	if len(doc.Patterns) == 0 {
+		return nil, fmt.Errorf("%v%v: no patterns", host, DocumentPath)
+	}
+
+	doc.host = strings.ToLower(host)
+	for i, p := range doc.Patterns {
+		// Sites only describe their own URLs
+		p.Prefix = doc.host + "/"
+		path, err := compilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("%v%v: pattern %d: %v", host, DocumentPath, i, err)
+		}
+		path.site = doc.host
+		path.source = doc.host
+		doc.paths = append(doc.paths, path)
+	}
+	for _, r := range doc.Recorders {
+		if r == "" || strings.ContainsAny(r, "/:") {
+			return nil, fmt.Errorf("%v%v: invalid recorder %q", host, DocumentPath, r)
+		}
+	}
+
+	return &doc, nil
+}
+
+// sites are the Documents of sites registered with Register, by host.
+var sites = struct {
+	sync.RWMutex
+	docs map[string]*Document
+}{docs: make(map[string]*Document)}
+
+// Register makes the URLs described by doc known to Domain, SumPrefix and
+// the other functions of the package, replacing any Document registered
+// for the same host. Sites built into rget cannot be replaced.
+func Register(doc *Document) {
+	sites.Lock()
+	defer sites.Unlock()
+	sites.docs[doc.host] = doc
+}
+
+// Unregister forgets doc if it is still the Document registered for its
+// host.
+func Unregister(doc *Document) {
+	sites.Lock()
+	defer sites.Unlock()
+	if sites.docs[doc.host] == doc {
+		delete(sites.docs, doc.host)
+	}
+}
+
+// knownPaths returns the paths of localPaths followed by those of the
+// registered sites.
+func knownPaths() []*vcsPath {
+	paths := localPaths()
+
+	sites.RLock()
+	defer sites.RUnlock()
+	for _, doc := range sites.docs {
+		paths = append(paths, doc.paths...)
+	}
+	return paths
+}
+
+// Recorders returns the recorders listed by the registered Document of the
+// site of target, if any.
+func Recorders(target string) []string {
+	host, err := siteHost(target)
+	if err != nil {
+		return nil
+	}
+
+	sites.RLock()
+	defer sites.RUnlock()
+	if doc, ok := sites.docs[host]; ok {
+		return doc.Recorders
+	}
+	return nil
+}
+
+// siteHost returns the lowercased host of the https URL target.
+func siteHost(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("%v is not an https URL", target)
+	}
+	return strings.ToLower(u.Host), nil
+}
+
+// ErrNoDocument is returned by Resolve for a site that does not publish a
+// Document.
+var ErrNoDocument = errors.New("site has no rget discovery document")
+
+// Resolver fetches the Documents of sites that are not built into rget and
+// registers them.
+type Resolver struct {
+	// Client fetches Documents. If nil only cached Documents are used.
+	Client *http.Client
+
+	// Dir caches Documents across processes if not empty.
+	Dir string
+
+	// TTL is how long a Document is used before it is fetched again,
+	// DefaultTTL if zero. A cached Document is used beyond that while it
+	// cannot be fetched.
+	TTL time.Duration
+
+	// MaxSites, if not zero, is how many sites are remembered. The
+	// Documents of the least recently resolved sites beyond it are
+	// unregistered. Servers resolving the sites of URLs sent to them
+	// should set it.
+	MaxSites int
+
+	mu       sync.Mutex
+	fetched  map[string]*resolved // by host
+	inflight map[string]*lookup   // by host
+}
+
+// resolved is the outcome of looking up the Document of a host.
+type resolved struct {
+	doc  *Document
+	err  error
+	time time.Time
+	used time.Time
+}
+
+// lookup is a fetch of the Document of a host that concurrent calls to
+// Resolve for the host wait for.
+type lookup struct {
+	done chan struct{}
+	doc  *Document
+	err  error
+}
+
+func (r *Resolver) ttl() time.Duration {
+	if r.TTL > 0 {
+		return r.TTL
+	}
+	return DefaultTTL
+}
+
+// Resolve makes sure the functions of the package know target, fetching and
+// registering the Document of its site if target is not built in or
+// configured. The Document is returned, nil for built in or configured URLs.
+func (r *Resolver) Resolve(ctx context.Context, target string) (*Document, error) {
+	if _, err := matchesFromURL(target, localPaths()); err == nil {
+		return nil, nil
+	}
+	host, err := siteHost(target)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	var prev resolved
+	if p, ok := r.fetched[host]; ok {
+		prev = *p
+		if time.Since(p.time) < r.ttl() {
+			p.used = time.Now()
+			r.mu.Unlock()
+			return p.doc, p.err
+		}
+	}
+	// Only one fetch of a host runs at a time, and without holding mu so
+	// other hosts are not held up by it
+	if l, ok := r.inflight[host]; ok {
+		r.mu.Unlock()
+		select {
+		case <-l.done:
+			return l.doc, l.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l := &lookup{done: make(chan struct{})}
+	if r.inflight == nil {
+		r.inflight = make(map[string]*lookup)
+	}
+	r.inflight[host] = l
+	r.mu.Unlock()
+
+	l.doc, l.err = r.lookup(ctx, host, prev)
+
+	r.mu.Lock()
+	delete(r.inflight, host)
+	r.mu.Unlock()
+	close(l.done)
+	return l.doc, l.err
+}
+
+// lookup reads the Document of host from the cache or the site, falling
+// back to prev, the outcome of the last lookup, if it cannot be fetched.
+func (r *Resolver) lookup(ctx context.Context, host string, prev resolved) (*Document, error) {
+	// Fall back to the disk cache, and then to a stale Document, while
+	// the site cannot be reached
+	cached, cachedTime := r.readCache(host)
+	if cached != nil && (time.Since(cachedTime) < r.ttl() || r.Client == nil) {
+		return r.store(host, cached, nil, cachedTime)
+	}
+	if r.Client == nil {
+		return nil, fmt.Errorf("no cached discovery document for %v", host)
+	}
+
+	data, err := r.fetch(ctx, host)
+	if err != nil {
+		switch {
+		case cached != nil:
+			return r.store(host, cached, nil, cachedTime)
+		case prev.doc != nil:
+			return prev.doc, nil
+		case err == ErrNoDocument:
+			r.store(host, nil, err, time.Now())
+		}
+		return nil, err
+	}
+
+	doc, err := ParseDocument(host, data)
+	if err != nil {
+		return nil, err
+	}
+	if r.Dir != "" {
+		// The cache only saves fetches so failing to write it is
+		// not an error
+		if err := os.MkdirAll(r.Dir, 0755); err == nil {
+			ioutil.WriteFile(r.cacheFile(host), data, 0644)
+		}
+	}
+	return r.store(host, doc, nil, time.Now())
+}
+
+// store records the outcome of looking up the Document of host and
+// registers the Document if there is one.
+func (r *Resolver) store(host string, doc *Document, err error, t time.Time) (*Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fetched == nil {
+		r.fetched = make(map[string]*resolved)
+	}
+	if old, ok := r.fetched[host]; ok && old.doc != nil && old.doc != doc {
+		Unregister(old.doc)
+	}
+	r.fetched[host] = &resolved{doc: doc, err: err, time: t, used: time.Now()}
+	if doc != nil {
+		Register(doc)
+	}
+
+	for r.MaxSites > 0 && len(r.fetched) > r.MaxSites {
+		var oldest string
+		for h, res := range r.fetched {
+			if oldest == "" || res.used.Before(r.fetched[oldest].used) {
+				oldest = h
+			}
+		}
+		if old := r.fetched[oldest]; old.doc != nil {
+			Unregister(old.doc)
+		}
+		delete(r.fetched, oldest)
+	}
+	return doc, err
+}
+
+func (r *Resolver) cacheFile(host string) string {
+	return filepath.Join(r.Dir, host+".json")
+}
+
+// readCache returns the Document of host in Dir and when it was fetched, or
+// nil if there is none.
+func (r *Resolver) readCache(host string) (*Document, time.Time) {
+	if r.Dir == "" {
+		return nil, time.Time{}
+	}
+	fi, err := os.Stat(r.cacheFile(host))
+	if err != nil {
+		return nil, time.Time{}
+	}
+	data, err := ioutil.ReadFile(r.cacheFile(host))
+	if err != nil {
+		return nil, time.Time{}
+	}
+	doc, err := ParseDocument(host, data)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	return doc, fi.ModTime()
+}
+
+// fetch downloads the Document of host.
+func (r *Resolver) fetch(ctx context.Context, host string) ([]byte, error) {
+	durl := "https://" + host + DocumentPath
+	resp, err := ctxhttp.Get(ctx, r.Client, durl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoDocument
+	default:
+		return nil, fmt.Errorf("%v: %v", durl, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxDocument))
+}
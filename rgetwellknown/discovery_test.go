@@ -0,0 +1,189 @@
+package rgetwellknown
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.merklecounty.com/rget/internal/testutil"
+)
+
+const testDocument = `{
+  "version": 1,
+  "patterns": [
+    {
+      "regexp": "(?P<root>downloads\\.example\\.com)/(?P<repo>[A-Za-z0-9_.-]+)/(?P<tag>[A-Za-z0-9_.+-]+)/(?P<file>[A-Za-z0-9_.-]+)",
+      "domain": "{dnstag}.{repo}.{root}",
+      "sum_prefix": "https://downloads.example.com/{repo}/{tag}/"
+    },
+    {
+      "regexp": "(?P<root>downloads\\.example\\.com)/other/(?P<tag>[A-Za-z0-9_.+-]+)\\.zip",
+      "domain": "{dnstag}.example.net"
+    }
+  ],
+  "recorders": ["recorder.example.com"]
+}`
+
+func TestResolver(t *testing.T) {
+	fetches := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches[r.Host]++
+		if r.Host != "downloads.example.com" || r.URL.Path != DocumentPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDocument))
+	}))
+	defer ts.Close()
+
+	// Send requests for every site to the test server
+	hc := testutil.RedirectClient(ts.URL)
+
+	dir, err := ioutil.TempDir("", "TestResolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	r := &Resolver{Client: hc, Dir: dir}
+
+	doc, err := r.Resolve(ctx, "https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS")
+	if doc != nil || err != nil || len(fetches) != 0 {
+		t.Errorf("built in site resolved to %v: %v", doc, err)
+	}
+
+	const target = "https://downloads.example.com/Tool/v1.0/tool.tar.gz"
+	for i := 0; i < 2; i++ {
+		if _, err := r.Resolve(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches["downloads.example.com"] != 1 {
+		t.Errorf("document fetched %d times", fetches["downloads.example.com"])
+	}
+
+	if d, err := Domain(target); err != nil || d != "v1-0.Tool.downloads.example.com" {
+		t.Errorf("domain %v: %v", d, err)
+	}
+	if d, err := SchemeDomain(target, Scheme1); err != nil || d != "e-v1-2e0.e--54ool.downloads.example.com.1" {
+		t.Errorf("scheme 1 domain %v: %v", d, err)
+	}
+	if p, err := SumPrefix(target); err != nil || p != "https://downloads.example.com/Tool/v1.0/" {
+		t.Errorf("sum prefix %v: %v", p, err)
+	}
+	if names, err := SumNames(target); err != nil || !reflect.DeepEqual(names, []string{target, "tool.tar.gz"}) {
+		t.Errorf("sum names %v: %v", names, err)
+	}
+	if rs := Recorders(target); !reflect.DeepEqual(rs, []string{"recorder.example.com"}) {
+		t.Errorf("recorders %v", rs)
+	}
+
+	// A site cannot describe releases of another
+	if d, err := Domain("https://downloads.example.com/other/v1.0.zip"); err == nil {
+		t.Errorf("domain %v outside of the site", d)
+	}
+
+	// Other processes use the cached document
+	offline := &Resolver{Dir: dir}
+	if doc, err := offline.Resolve(ctx, target); err != nil || doc == nil {
+		t.Errorf("cached document %v: %v", doc, err)
+	}
+	if _, err := (&Resolver{}).Resolve(ctx, target); err == nil {
+		t.Errorf("resolved without a client or cache")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Resolve(ctx, "https://other.example.com/v1.0/file"); err != ErrNoDocument {
+			t.Errorf("site without a document: %v", err)
+		}
+	}
+	if fetches["other.example.com"] != 1 {
+		t.Errorf("missing document fetched %d times", fetches["other.example.com"])
+	}
+}
+
+func TestResolverLimits(t *testing.T) {
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.Host]++
+		mu.Unlock()
+		<-release
+		w.Write([]byte(`{"version": 1, "patterns": [{"regexp": "(?P<root>` + strings.Replace(regexp.QuoteMeta(r.Host), `\`, `\\`, -1) +
+			`)/(?P<tag>[a-z0-9.]+)/(?P<file>[a-z.]+)", "domain": "{dnstag}.{root}"}]}`))
+	}))
+	defer ts.Close()
+
+	hc := testutil.RedirectClient(ts.URL)
+
+	ctx := context.Background()
+	r := &Resolver{Client: hc, MaxSites: 1}
+
+	// Concurrent lookups of a site share one fetch
+	const first = "https://first.example.com/v1.0/file.txt"
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Resolve(ctx, first); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	mu.Lock()
+	if fetches["first.example.com"] != 1 {
+		t.Errorf("document fetched %d times", fetches["first.example.com"])
+	}
+	mu.Unlock()
+	if _, err := Domain(first); err != nil {
+		t.Errorf("first site not registered: %v", err)
+	}
+
+	// Only MaxSites sites stay registered
+	const second = "https://second.example.com/v1.0/file.txt"
+	if _, err := r.Resolve(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Domain(second); err != nil {
+		t.Errorf("second site not registered: %v", err)
+	}
+	if d, err := Domain(first); err == nil {
+		t.Errorf("first site still registered with domain %v", d)
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	for ti, tt := range []struct {
+		doc     string
+		wantErr bool
+	}{
+		{testDocument, false},
+		{`{"version": 2, "patterns": [{"regexp": "a", "domain": "a"}]}`, true},
+		{`{"version": 1, "patterns": []}`, true},
+		{`{"version": 1, "patterns": [{"regexp": "(", "domain": "a"}]}`, true},
+		{`{"version": 1, "patterns": [{"regexp": "a"}]}`, true},
+		{`{"version": 1, "patterns": [{"regexp": "a", "domain": "a", "sum_prefix": "http://a/"}]}`, true},
+		{`{"version": 1, "patterns": [{"regexp": "a", "domain": "a"}], "recorders": ["https://a"]}`, true},
+		{`not json`, true},
+	} {
+		_, err := ParseDocument("downloads.example.com", []byte(tt.doc))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+		}
+	}
+}
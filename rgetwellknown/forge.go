@@ -0,0 +1,91 @@
+package rgetwellknown
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Forge is a kind of code hosting site whose release URLs are known.
+type Forge string
+
+// Supported forges. Forgejo is served by Gitea.
+const (
+	GitHub Forge = "github"
+	GitLab Forge = "gitlab"
+	Gitea  Forge = "gitea"
+)
+
+// forgePaths returns the paths of the release URLs of an instance of each
+// forge that can be self-hosted.
+var forgePaths = map[Forge]func(host string) []*vcsPath{
+	GitLab: gitlabPaths,
+	Gitea:  giteaPaths,
+}
+
+// forgeMatches returns the matches of a URL of an instance of each forge,
+// release pages included.
+var forgeMatches = map[Forge]func(target string) (map[string]string, error){
+	GitHub: GitHubMatches,
+	GitLab: GitLabMatches,
+	Gitea:  GiteaMatches,
+}
+
+// forgeHosts are the hosts of the forges known, those added with
+// AddForgeHost and the public instances.
+var forgeHosts = struct {
+	sync.RWMutex
+	paths []*vcsPath
+	hosts map[string]Forge
+}{hosts: map[string]Forge{
+	"github.com": GitHub,
+	GitLabHost:   GitLab,
+}}
+
+// AddForgeHost makes the release URLs of the self-hosted instance of forge at
+// host known, as those of the public instances are. A host can only be an
+// instance of one forge.
+func AddForgeHost(forge Forge, host string) error {
+	paths, ok := forgePaths[forge]
+	if !ok {
+		return fmt.Errorf("forge %q cannot be self-hosted", forge)
+	}
+	host = strings.ToLower(host)
+
+	forgeHosts.Lock()
+	defer forgeHosts.Unlock()
+	if f, ok := forgeHosts.hosts[host]; ok {
+		if f != forge {
+			return fmt.Errorf("%v is already a %v instance", host, f)
+		}
+		return nil
+	}
+	forgeHosts.hosts[host] = forge
+	for _, p := range paths(host) {
+		p.source = SourceBuiltin
+		forgeHosts.paths = append(forgeHosts.paths, p)
+	}
+	return nil
+}
+
+// ForgeMatches returns the forge of the known instance target is on and the
+// parsed out matches map of target, which may be a release page.
+func ForgeMatches(target string) (Forge, map[string]string, error) {
+	host, err := siteHost(target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	forgeHosts.RLock()
+	forge, ok := forgeHosts.hosts[host]
+	forgeHosts.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("%v is not a known forge", host)
+	}
+
+	m, err := forgeMatches[forge](target)
+	if err != nil {
+		return "", nil, err
+	}
+	return forge, m, nil
+}
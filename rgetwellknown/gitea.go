@@ -0,0 +1,53 @@
+package rgetwellknown
+
+import (
+	"regexp"
+)
+
+// giteaPaths returns the paths of release URLs of the Gitea or Forgejo
+// instance at host.
+func giteaPaths(host string) []*vcsPath {
+	project := `(?P<root>` + regexp.QuoteMeta(host) + `)/(?P<org>[A-Za-z0-9_.\-]+)/(?P<repo>[A-Za-z0-9_.\-]+)`
+	release := "https://{root}/{org}/{repo}/releases/download/{tag}/"
+
+	return []*vcsPath{
+		// Gitea release attachments
+		{
+			prefix: host + "/",
+			// https://gitea.com/philips/releases-test/releases/download/v2.0/SHA256SUMS
+			regexp:    regexp.MustCompile(`^` + project + `/releases/download/(?P<tag>[A-Za-z0-9_.\-\+]+)/(?P<file>[A-Za-z0-9_.\-]+)$`),
+			domain:    "{dnstag}.{repo}.{org}.{root}",
+			sumPrefix: release,
+		},
+
+		// Gitea source archives
+		{
+			prefix: host + "/",
+			// https://gitea.com/philips/releases-test/archive/v2.0.tar.gz
+			regexp:    regexp.MustCompile(`^` + project + `/archive/(?P<tag>[A-Za-z0-9_.\-\+]+)\.(?:zip|tar\.gz)$`),
+			domain:    "{dnstag}.{repo}.{org}.{root}",
+			sumPrefix: release,
+		},
+	}
+}
+
+// GiteaMatches returns a parsed out matches map for URLs of any Gitea or
+// Forgejo instance, including release pages. This can be used for taking a
+// copy/pasteable URL from a user and turning it into things for the Gitea
+// API.
+func GiteaMatches(giteaURL string) (map[string]string, error) {
+	host, err := siteHost(giteaURL)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := append(giteaPaths(host), &vcsPath{
+		prefix: host + "/",
+		// https://gitea.com/philips/releases-test/releases/tag/v2.0
+		regexp:    regexp.MustCompile(`^(?P<root>` + regexp.QuoteMeta(host) + `)/(?P<org>[A-Za-z0-9_.\-]+)/(?P<repo>[A-Za-z0-9_.\-]+)/releases/tag/(?P<tag>[A-Za-z0-9_.\-\+]+)$`),
+		domain:    "{dnstag}.{repo}.{org}.{root}",
+		sumPrefix: "https://{root}/{org}/{repo}/releases/download/{tag}/",
+	})
+
+	return matchesFromURL(giteaURL, paths)
+}
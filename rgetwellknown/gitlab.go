@@ -0,0 +1,79 @@
+package rgetwellknown
+
+import (
+	"regexp"
+)
+
+// GitLabHost is the host of the public GitLab instance, whose URLs are
+// always known. Self-hosted instances are added with AddGitLabHost.
+const GitLabHost = "gitlab.com"
+
+// gitlabNamespace matches a GitLab namespace, which may be nested in groups.
+const gitlabNamespace = `[A-Za-z0-9_.\-]+(?:/[A-Za-z0-9_.\-]+)*`
+
+// gitlabPaths returns the paths of GitLab release URLs of the instance at
+// host.
+func gitlabPaths(host string) []*vcsPath {
+	root := `(?P<root>` + regexp.QuoteMeta(host) + `)`
+	project := root + `/(?P<org>` + gitlabNamespace + `)/(?P<repo>[A-Za-z0-9_.\-]+)`
+	release := "https://{root}/{org}/{repo}/-/releases/{tag}/downloads/"
+
+	return []*vcsPath{
+		// GitLab release asset permanent links
+		{
+			prefix: host + "/",
+			// https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/SHA256SUMS
+			regexp:    regexp.MustCompile(`^` + project + `/-/releases/(?P<tag>[A-Za-z0-9_.\-\+]+)/downloads/(?P<file>[A-Za-z0-9_.\-/]+)$`),
+			domain:    "{dnstag}.{repo}.{org}.{root}",
+			sumPrefix: release,
+		},
+
+		// GitLab source archives
+		{
+			prefix: host + "/",
+			// https://gitlab.com/philips/releases-test/-/archive/v2.0/releases-test-v2.0.tar.gz
+			regexp:    regexp.MustCompile(`^` + project + `/-/archive/(?P<tag>[A-Za-z0-9_.\-\+]+)/(?P<file>[A-Za-z0-9_.\-\+]+\.(?:zip|tar\.gz|tar\.bz2|tar))$`),
+			domain:    "{dnstag}.{repo}.{org}.{root}",
+			sumPrefix: release,
+		},
+
+		// GitLab generic package registry, where each version of a
+		// package is a release
+		{
+			prefix: host + "/api/v4/projects/",
+			// https://gitlab.com/api/v4/projects/1234/packages/generic/rget/v2.0/rget-linux.tar.gz
+			regexp:    regexp.MustCompile(`^` + root + `/api/v4/projects/(?P<project>[A-Za-z0-9_.\-%]+)/packages/generic/(?P<package>[A-Za-z0-9_.\-]+)/(?P<tag>[A-Za-z0-9_.\-\+]+)/(?P<file>[A-Za-z0-9_.\-~]+)$`),
+			domain:    "{dnstag}.{package}.{project}.packages.{root}",
+			sumPrefix: "https://{root}/api/v4/projects/{project}/packages/generic/{package}/{tag}/",
+		},
+	}
+}
+
+// AddGitLabHost makes the release URLs of the self-hosted GitLab instance at
+// host known, as those of gitlab.com are.
+func AddGitLabHost(host string) error {
+	return AddForgeHost(GitLab, host)
+}
+
+// GitLabMatches returns a parsed out matches map for GitLab URLs of any
+// instance, including release pages. This can be used for taking a
+// copy/pasteable URL from a user and turning it into things for the GitLab
+// API.
+func GitLabMatches(gitlabURL string) (map[string]string, error) {
+	host, err := siteHost(gitlabURL)
+	if err != nil {
+		return nil, err
+	}
+
+	root := `(?P<root>` + regexp.QuoteMeta(host) + `)`
+	project := root + `/(?P<org>` + gitlabNamespace + `)/(?P<repo>[A-Za-z0-9_.\-]+)`
+	paths := append(gitlabPaths(host), &vcsPath{
+		prefix: host + "/",
+		// https://gitlab.com/philips/releases-test/-/releases/v2.0
+		regexp:    regexp.MustCompile(`^` + project + `/-/releases/(?P<tag>[A-Za-z0-9_.\-\+]+)$`),
+		domain:    "{dnstag}.{repo}.{org}.{root}",
+		sumPrefix: "https://{root}/{org}/{repo}/-/releases/{tag}/downloads/",
+	})
+
+	return matchesFromURL(gitlabURL, paths)
+}
@@ -0,0 +1,28 @@
+package rgetwellknown
+
+import (
+	"regexp"
+)
+
+// gomodPaths are the paths of the files of module versions on
+// proxy.golang.org, which module versions are recorded under whichever
+// proxy they are downloaded from. The "go-module" label cannot be made by
+// EncodeLabel so module domains never clash with release domains. A version
+// has no sums file to download, its sums are made from its files and named
+// relative to the sum prefix.
+var gomodPaths = []*vcsPath{
+	{
+		prefix: "proxy.golang.org/",
+		// https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v0.3.1.zip
+		regexp:    regexp.MustCompile(`^(?P<root>proxy\.golang\.org)/(?P<module>[a-z0-9.\-_~!]+(?:/[a-z0-9.\-_~!]+)*)/@v/(?P<tag>v[a-z0-9.\-_+!]+)\.(?:info|mod|zip)$`),
+		domain:    "{dnstag}.{module}.go-module.{root}",
+		sumPrefix: "https://{root}/{module}/@v/",
+	},
+}
+
+// GomodMatches returns a parsed out matches map for the URLs of the files of
+// module versions on proxy.golang.org. The module and tag are escaped as in
+// the URL.
+func GomodMatches(target string) (map[string]string, error) {
+	return matchesFromURL(target, gomodPaths)
+}
@@ -0,0 +1,88 @@
+package rgetwellknown
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OCIRegistries are the hosts of the public registries whose image URLs are
+// always known. Other registries are added with AddOCIRegistry.
+var OCIRegistries = []string{
+	"registry-1.docker.io",
+	"ghcr.io",
+	"quay.io",
+	"gcr.io",
+	"public.ecr.aws",
+	"registry.gitlab.com",
+	"mcr.microsoft.com",
+}
+
+// ociPaths returns the paths of the registry API URLs of image manifests of
+// the registry at host, which may include a port. The tags of images are
+// recorded under them. The "oci-image" label cannot be made by EncodeLabel
+// so image domains never clash with release domains. A port other than
+// 443 is added to the label, "oci-image-5000", to tell registries on the
+// same host apart. Images have no sums file to download, their digests are
+// listed by the registry.
+func ociPaths(host string) []*vcsPath {
+	host = strings.ToLower(host)
+	name, port, err := net.SplitHostPort(host)
+	if err != nil || port == "443" {
+		name, port = strings.TrimSuffix(host, ":443"), ""
+	}
+	label := "oci-image"
+	root := `(?P<root>` + regexp.QuoteMeta(name) + `)`
+	if port != "" {
+		label += "-" + port
+		root += ":" + port
+		name += ":" + port
+	}
+
+	return []*vcsPath{
+		{
+			prefix: name + "/v2/",
+			// https://ghcr.io/v2/merklecounty/rget/manifests/v0.0.6
+			regexp: regexp.MustCompile(`^` + root + `/v2/(?P<repo>[a-z0-9._\-]+(?:/[a-z0-9._\-]+)*)/manifests/(?P<tag>[A-Za-z0-9_][A-Za-z0-9_.\-]{0,127})$`),
+			domain: "{dnstag}.{repo}." + label + ".{root}",
+		},
+	}
+}
+
+// ociRegistries are the registries added with AddOCIRegistry. Their paths
+// follow those of the forges.
+var ociRegistries = struct {
+	sync.RWMutex
+	paths []*vcsPath
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+// AddOCIRegistry makes the image URLs of the registry at host, which may
+// include a port, known as those of OCIRegistries are. Only the images of
+// known registries are recorded, so a recorder never fetches from hosts it
+// was not configured for.
+func AddOCIRegistry(host string) error {
+	host = strings.ToLower(host)
+	if host == "" || strings.ContainsAny(host, "/@") {
+		return fmt.Errorf("invalid registry host %q", host)
+	}
+	for _, h := range OCIRegistries {
+		if h == host {
+			return nil
+		}
+	}
+
+	ociRegistries.Lock()
+	defer ociRegistries.Unlock()
+	if ociRegistries.hosts[host] {
+		return nil
+	}
+	ociRegistries.hosts[host] = true
+	for _, p := range ociPaths(host) {
+		p.source = SourceBuiltin
+		ociRegistries.paths = append(ociRegistries.paths, p)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package rgetwellknown
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sources of the patterns a URL is matched against, in order of precedence.
+const (
+	SourceConfig  = "config"  // patterns set with SetPatterns
+	SourceBuiltin = "builtin" // patterns built into rget
+	// Patterns of a site's Document have the host of the site as source.
+)
+
+// Pattern maps download URLs matching Regexp to a release. The domain,
+// sum prefix and aliases templates are expanded with the named groups of
+// Regexp as {name}, and {dnstag} for the tag group with "." and "+" replaced
+// by "-".
+type Pattern struct {
+	// Name identifies the pattern in messages.
+	Name string `mapstructure:"name" json:"name,omitempty"`
+
+	// Prefix is a literal prefix of the URLs Regexp matches, used to skip
+	// the pattern quickly. It is the host of the site for Documents.
+	Prefix string `mapstructure:"prefix" json:"prefix,omitempty"`
+
+	// Regexp matches the whole of a download URL without "https://".
+	Regexp string `mapstructure:"regexp" json:"regexp"`
+
+	// Domain is the labels of the release in its record domain.
+	Domain string `mapstructure:"domain" json:"domain"`
+
+	// SumPrefix is the URL the sums files are named relative to, the
+	// directory of the download if empty.
+	SumPrefix string `mapstructure:"sum-prefix" json:"sum_prefix,omitempty"`
+
+	// Aliases are URLs serving the same content as the download.
+	Aliases []string `mapstructure:"aliases" json:"aliases,omitempty"`
+}
+
+var templateVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// compilePattern checks p and returns the path matching it. Every {name} of
+// its templates must be a named group of its regexp.
+func compilePattern(p Pattern) (*vcsPath, error) {
+	re, err := regexp.Compile(`^(?:` + p.Regexp + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	if p.Domain == "" {
+		return nil, errors.New("no domain")
+	}
+	if p.SumPrefix != "" && !strings.HasPrefix(p.SumPrefix, "https://") {
+		return nil, errors.New("sum prefix is not an https URL")
+	}
+
+	groups := map[string]bool{"prefix": true}
+	for _, name := range re.SubexpNames() {
+		groups[name] = name != ""
+	}
+	groups["dnstag"] = groups["tag"]
+	for _, t := range append([]string{p.Domain, p.SumPrefix}, p.Aliases...) {
+		for _, m := range templateVar.FindAllStringSubmatch(t, -1) {
+			if !groups[m[1]] {
+				return nil, fmt.Errorf("template %q uses %s which is not a named group of the regexp", t, m[0])
+			}
+		}
+	}
+
+	return &vcsPath{
+		prefix:    p.Prefix,
+		regexp:    re,
+		domain:    p.Domain,
+		sumPrefix: p.SumPrefix,
+		aliases:   p.Aliases,
+		name:      p.Name,
+	}, nil
+}
+
+// configPaths are the paths of the patterns set with SetPatterns.
+var configPaths = struct {
+	sync.RWMutex
+	paths []*vcsPath
+}{}
+
+// localPaths returns the configured paths followed by the built in ones,
+// including those of the self-hosted forges added with AddForgeHost, the
+// registries added with AddOCIRegistry and the APT repository hosts added
+// with AddAptHost.
+func localPaths() []*vcsPath {
+	configPaths.RLock()
+	paths := append(append([]*vcsPath{}, configPaths.paths...), vcsPaths...)
+	configPaths.RUnlock()
+
+	forgeHosts.RLock()
+	paths = append(paths, forgeHosts.paths...)
+	forgeHosts.RUnlock()
+
+	ociRegistries.RLock()
+	paths = append(paths, ociRegistries.paths...)
+	ociRegistries.RUnlock()
+
+	aptHosts.RLock()
+	defer aptHosts.RUnlock()
+	return append(paths, aptHosts.paths...)
+}
+
+// SetPatterns replaces the patterns of the configuration. They take
+// precedence over the built in patterns, which take precedence over those
+// of Documents.
+func SetPatterns(patterns []Pattern) error {
+	var paths []*vcsPath
+	for i, p := range patterns {
+		path, err := compilePattern(p)
+		if err != nil {
+			if p.Name != "" {
+				return fmt.Errorf("pattern %q: %v", p.Name, err)
+			}
+			return fmt.Errorf("pattern %d: %v", i, err)
+		}
+		path.source = SourceConfig
+		paths = append(paths, path)
+	}
+
+	configPaths.Lock()
+	defer configPaths.Unlock()
+	configPaths.paths = paths
+	return nil
+}
+
+// Match describes the pattern a URL matched and what it maps to.
+type Match struct {
+	Source  string  // SourceConfig, SourceBuiltin or the host of a site
+	Pattern Pattern // the pattern that matched
+	Index   int     // position of the pattern in its source
+
+	// Groups are the named groups of the regexp.
+	Groups map[string]string
+
+	// Domains are the labels of the release in its record domain under
+	// each scheme.
+	Domains map[Scheme]string
+
+	SumPrefix string
+	Aliases   []string
+}
+
+// MatchURL returns the pattern target matches and the release it maps to.
+func MatchURL(target string) (*Match, error) {
+	path, match, err := matchPath(target, knownPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Match{
+		Source: path.source,
+		Pattern: Pattern{
+			Name:      path.name,
+			Prefix:    path.prefix,
+			Regexp:    path.regexp.String(),
+			Domain:    path.domain,
+			SumPrefix: path.sumPrefix,
+			Aliases:   path.aliases,
+		},
+		Groups: make(map[string]string),
+		Domains: map[Scheme]string{
+			Scheme0: match["domain"],
+			Scheme1: match["domain1"],
+			Scheme2: match["domain2"],
+		},
+		SumPrefix: match["sumPrefix"],
+	}
+	for _, p := range knownPaths() {
+		if p.source == path.source {
+			if p == path {
+				break
+			}
+			m.Index++
+		}
+	}
+	for _, name := range path.regexp.SubexpNames() {
+		if name != "" {
+			m.Groups[name] = match[name]
+		}
+	}
+	if match["aliases"] != "" {
+		m.Aliases = strings.Split(match["aliases"], " ")
+	}
+	return m, nil
+}
+
+// GroupNames returns the names of the groups of m in order.
+func (m *Match) GroupNames() []string {
+	var names []string
+	for name := range m.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
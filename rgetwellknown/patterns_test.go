@@ -0,0 +1,92 @@
+package rgetwellknown
+
+import (
+	"testing"
+)
+
+func TestBuiltinPatterns(t *testing.T) {
+	for ti, p := range vcsPaths {
+		_, err := compilePattern(Pattern{
+			Prefix:    p.prefix,
+			Regexp:    p.regexp.String(),
+			Domain:    p.domain,
+			SumPrefix: p.sumPrefix,
+			Aliases:   p.aliases,
+		})
+		if err != nil {
+			t.Errorf("%d: built in pattern %v: %v", ti, p.regexp, err)
+		}
+	}
+}
+
+func TestSetPatterns(t *testing.T) {
+	defer SetPatterns(nil)
+
+	for ti, tt := range []struct {
+		pattern Pattern
+		wantErr bool
+	}{
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<tag>[a-z0-9.]+)/(?P<file>[a-z.]+)`, Domain: "{dnstag}.{root}"}, false},
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<file>[a-z.]+)`, Domain: "{dnstag}.{root}"}, true},
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<file>[a-z.]+)`, Domain: "{release}.{root}"}, true},
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<file>[a-z.]+)`, Domain: "{root}", SumPrefix: "https://{host}/"}, true},
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<file>[a-z.]+)`, Domain: "{root}", Aliases: []string{"https://{root}/{name}"}}, true},
+		{Pattern{Regexp: `(?P<root>example\.com)/(?P<file>[a-z.]+)`, Domain: "{root}", SumPrefix: "http://{root}/"}, true},
+		{Pattern{Regexp: `(?P<root>example\.com`, Domain: "{root}"}, true},
+		{Pattern{Regexp: `(?P<root>example\.com)`}, true},
+	} {
+		err := SetPatterns([]Pattern{tt.pattern})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: want error %v got %v", ti, tt.wantErr, err)
+		}
+	}
+
+	err := SetPatterns([]Pattern{
+		{
+			Name:      "example",
+			Prefix:    "example.com/",
+			Regexp:    `(?P<root>example\.com)/(?P<project>[a-z]+)/(?P<tag>[A-Za-z0-9.]+)/(?P<file>[a-z.]+)`,
+			Domain:    "{dnstag}.{project}.{root}",
+			SumPrefix: "https://example.com/{project}/{tag}/",
+		},
+		// Configured patterns take precedence over built in ones
+		{
+			Name:      "github-raw",
+			Prefix:    "github.com/",
+			Regexp:    `(?P<root>github\.com)/(?P<org>[a-z]+)/(?P<repo>[a-z]+)/releases/download/(?P<tag>[a-z0-9.]+)/(?P<file>[a-z.]+)`,
+			Domain:    "{dnstag}.{repo}.{org}.{root}",
+			SumPrefix: "https://github.com/{org}/{repo}/releases/download/{tag}/",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ti, tt := range []struct {
+		target  string
+		source  string
+		index   int
+		domain1 string
+		prefix  string
+	}{
+		{"https://example.com/tool/V1.0/tool.tar", SourceConfig, 0, "e--561-2e0.tool.example.com.1", "https://example.com/tool/V1.0/"},
+		{"https://github.com/org/repo/releases/download/v1.0/file.txt", SourceConfig, 1, "e-v1-2e0.repo.org.github.com.1", "https://github.com/org/repo/releases/download/v1.0/"},
+		{"https://github.com/org/repo/archive/v1.0.zip", SourceBuiltin, 2, "e-v1-2e0.repo.org.github.com.1", "https://github.com/org/repo/releases/download/v1.0/"},
+	} {
+		m, err := MatchURL(tt.target)
+		if err != nil {
+			t.Errorf("%d: %v", ti, err)
+			continue
+		}
+		if m.Source != tt.source || m.Index != tt.index {
+			t.Errorf("%d: matched %v pattern %d want %v pattern %d", ti, m.Source, m.Index, tt.source, tt.index)
+		}
+		if m.Domains[Scheme1] != tt.domain1 || m.SumPrefix != tt.prefix {
+			t.Errorf("%d: domain %v sum prefix %v", ti, m.Domains[Scheme1], m.SumPrefix)
+		}
+	}
+
+	if _, err := MatchURL("https://example.org/file"); err == nil {
+		t.Errorf("unknown site matched")
+	}
+}
@@ -0,0 +1,78 @@
+package rgetwellknown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Registry is a package registry whose package files are known. Packages
+// have no sums file to download, their sums are made from the metadata of
+// the registry, see rgetregistry.
+type Registry string
+
+// Supported registries.
+const (
+	PyPI Registry = "pypi"
+	NPM  Registry = "npm"
+)
+
+// pypiPaths are the paths of the files of PyPI packages. Their directories
+// are named after the digest of the file so every version of a package is
+// recorded under the name and version in the file name, the name normalized
+// as PyPI does since wheels and source archives spell it differently. The
+// "pypi-package" label cannot be made by EncodeLabel so package domains never
+// clash with release domains.
+var pypiPaths = []*vcsPath{
+	{
+		prefix: "files.pythonhosted.org/packages/",
+		// https://files.pythonhosted.org/packages/36/7a/87837f39d0296e723bb9b62bbb257d0355c7f6128853c78955f57342a56d/python_dateutil-2.8.2-py2.py3-none-any.whl
+		regexp:    regexp.MustCompile(`^(?P<root>files\.pythonhosted\.org)/packages/[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{60}/(?P<file>(?P<package>[A-Za-z0-9][A-Za-z0-9_.\-]*?)-(?P<tag>[0-9][A-Za-z0-9_.!+]*?)(?:-[A-Za-z0-9_.]+)*\.(?:whl|tar\.gz|tar\.bz2|zip|egg))$`),
+		domain:    "{dnstag}.{package}.pypi-package.{root}",
+		normalize: normalizePyPI,
+	},
+}
+
+// npmPaths are the paths of the tarballs of npm packages, one for each
+// version of a package. The "npm-package" label cannot be made by EncodeLabel
+// so package domains never clash with release domains.
+var npmPaths = []*vcsPath{
+	{
+		prefix: "registry.npmjs.org/",
+		// https://registry.npmjs.org/@types/node/-/node-12.7.2.tgz
+		regexp:    regexp.MustCompile(`^(?P<root>registry\.npmjs\.org)/(?P<package>(?:@[A-Za-z0-9\-~][A-Za-z0-9\-._~]*/)?[A-Za-z0-9\-~][A-Za-z0-9\-._~]*)/-/(?P<file>[A-Za-z0-9\-._~]+-(?P<tag>[0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.\-]+)?(?:\+[0-9A-Za-z.\-]+)?)\.tgz)$`),
+		domain:    "{dnstag}.{package}.npm-package.{root}",
+		sumPrefix: "https://{root}/{package}/-/",
+	},
+}
+
+var registryPaths = map[Registry][]*vcsPath{
+	PyPI: pypiPaths,
+	NPM:  npmPaths,
+}
+
+// pypiSeparators are the runs of characters PyPI treats as one "-" in
+// package names.
+var pypiSeparators = regexp.MustCompile(`[\-_.]+`)
+
+// NormalizePyPI returns the name of a PyPI package as PyPI compares them,
+// lower case with runs of "-", "_" and "." replaced by "-".
+func NormalizePyPI(name string) string {
+	return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+func normalizePyPI(match map[string]string) {
+	match["package"] = NormalizePyPI(match["package"])
+}
+
+// RegistryMatches returns the registry of the package file target and the
+// parsed out matches map of target, whose package and tag are the name and
+// version of the package.
+func RegistryMatches(target string) (Registry, map[string]string, error) {
+	for _, r := range []Registry{PyPI, NPM} {
+		if m, err := matchesFromURL(target, registryPaths[r]); err == nil {
+			return r, m, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%v is not a known package registry file", target)
+}
@@ -0,0 +1,156 @@
+package rgetwellknown
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Scheme is the version of the rules that turn a release into the labels
+// of its record domain.
+type Scheme string
+
+const (
+	// Scheme0 is the original scheme. Its labels are the tag, with "."
+	// and "+" replaced by "-", the repo, the org and the host, so
+	// different tags may share a domain. It has no scheme label.
+	Scheme0 Scheme = "0"
+
+	// Scheme1 encodes each label with EncodeLabel, after lowercasing
+	// the case insensitive org and repo, and ends with a "1" label.
+	Scheme1 Scheme = "1"
+
+	// Scheme2 has the labels of Scheme1 but ends with a "2" label. The
+	// leaves of its Merkle tree are the name of each entry followed by
+	// its digest, rather than the digest alone, so an inclusion proof
+	// covers the name of its entry.
+	Scheme2 Scheme = "2"
+)
+
+// CurrentScheme is the scheme new records are made with.
+const CurrentScheme = Scheme2
+
+// Schemes are the schemes records are looked up with, newest first.
+var Schemes = []Scheme{Scheme2, Scheme1, Scheme0}
+
+// BindsNames reports whether the Merkle tree leaves of scheme include the
+// names of the entries.
+func (s Scheme) BindsNames() bool {
+	return s != Scheme0 && s != Scheme1
+}
+
+// DomainScheme returns the scheme of a record domain, less the service
+// host, from its last label.
+func DomainScheme(domain string) Scheme {
+	switch {
+	case strings.HasSuffix(domain, "."+string(Scheme2)):
+		return Scheme2
+	case strings.HasSuffix(domain, "."+string(Scheme1)):
+		return Scheme1
+	}
+	return Scheme0
+}
+
+// maxLabel is the longest DNS label.
+const maxLabel = 63
+
+// maxDomain is the longest DNS name, without the trailing dot.
+const maxDomain = 253
+
+// CheckDomain returns an error if domain is too long to be a DNS name, as
+// record domains of releases with long labels can be.
+func CheckDomain(domain string) error {
+	if len(domain) > maxDomain {
+		return fmt.Errorf("record domain of %d bytes exceeds the %d byte limit of DNS: %v", len(domain), maxDomain, domain)
+	}
+	return nil
+}
+
+var rawLabel = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// EncodeLabel turns s into a DNS label that no other string maps to.
+// Strings of lowercase letters and digits are used as they are. Others are
+// prefixed with "e-" and every byte other than a lowercase letter or digit
+// is written as "-" and two lowercase hex digits. If that exceeds the 63
+// byte limit of a label "h-" and the first 32 hex digits of the SHA-256 of
+// s are used instead.
+func EncodeLabel(s string) string {
+	if rawLabel.MatchString(s) && len(s) <= maxLabel {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteString("e-")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "-%02x", c)
+		}
+	}
+	if b.Len() <= maxLabel {
+		return b.String()
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	return "h-" + hex.EncodeToString(sum[:16])
+}
+
+// DecodeLabel reverses EncodeLabel. Hashed labels cannot be decoded.
+func DecodeLabel(label string) (string, error) {
+	switch {
+	case rawLabel.MatchString(label):
+		return label, nil
+	case strings.HasPrefix(label, "h-"):
+		return "", fmt.Errorf("label %q is hashed", label)
+	case !strings.HasPrefix(label, "e-"):
+		return "", fmt.Errorf("label %q is not encoded", label)
+	}
+
+	var b strings.Builder
+	enc := label[2:]
+	for i := 0; i < len(enc); i++ {
+		if enc[i] != '-' {
+			b.WriteByte(enc[i])
+			continue
+		}
+		if i+2 >= len(enc) {
+			return "", errors.New("truncated escape in label")
+		}
+		c, err := hex.DecodeString(enc[i+1 : i+3])
+		if err != nil || strings.ToLower(enc[i+1:i+3]) != enc[i+1:i+3] {
+			return "", fmt.Errorf("invalid escape %q in label", enc[i:i+3])
+		}
+		b.WriteByte(c[0])
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// scheme1Labels returns match with the named groups of re, other than
+// root, and the dnstag encoded for Scheme1. The org and repo of built in
+// patterns are lowercased first, and so is root, as the sites they describe
+// treat them case insensitively. The case of the groups of other patterns
+// may matter so it is kept.
+func scheme1Labels(match map[string]string, re *regexp.Regexp, builtin bool) map[string]string {
+	m := make(map[string]string, len(match))
+	for k, v := range match {
+		m[k] = v
+	}
+	for _, name := range re.SubexpNames() {
+		if name != "" && name != "root" {
+			m[name] = EncodeLabel(match[name])
+		}
+	}
+	m["dnstag"] = EncodeLabel(match["tag"])
+	if builtin {
+		m["repo"] = EncodeLabel(strings.ToLower(match["repo"]))
+		m["org"] = EncodeLabel(strings.ToLower(match["org"]))
+		m["root"] = strings.ToLower(match["root"])
+	}
+	return m
+}
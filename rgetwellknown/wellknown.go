@@ -2,14 +2,17 @@ package rgetwellknown
 
 import (
 	"errors"
+	"fmt"
 	"path"
 	"regexp"
 	"strings"
 )
 
 // PublicServiceHost is the hostname of the public service that is used by
-// default. In the future this will be the fallback host if a well-known
-// isn't provided on the root of a domain.
+// default. Other recorders, for example a staging one, run under their own
+// host and record domains end in that host instead. In the future this will
+// be the fallback host if a well-known isn't provided on the root of a
+// domain.
 const PublicServiceHost = "recorder.merklecounty.com"
 
 // A vcsPath describes how to convert an import path into a
@@ -19,6 +22,14 @@ type vcsPath struct {
 	regexp    *regexp.Regexp // compiled pattern for import path
 	domain    string         // domain that will be used for the URL for the CT Log
 	sumPrefix string         // URL prefix for a SUMS file
+	aliases   []string       // URLs serving the same content as the import path
+	site      string         // host of the Document the path is from, if any
+	source    string         // where the path is from, see MatchURL
+	name      string         // name of the path in messages
+
+	// normalize rewrites the matches of built in paths whose URLs spell
+	// the same release in several ways.
+	normalize func(match map[string]string)
 }
 
 // vcsPaths defines the meaning of import paths referring to
@@ -49,14 +60,42 @@ var githubPaths = []*vcsPath{
 	{
 		prefix: "github.com/",
 		// https://github.com/philips/releases-test/archive/v2.0.zip
-		regexp:    regexp.MustCompile(`^(?P<root>github\.com)/(?P<org>[A-Za-z0-9_.\-]+)/(?P<repo>[A-Za-z0-9_.\-]+)/archive/(?P<tag>[A-Za-z0-9_.\-\+]+)\.(zip|tar\.gz)$`),
+		regexp:    regexp.MustCompile(`^(?P<root>github\.com)/(?P<org>[A-Za-z0-9_.\-]+)/(?P<repo>[A-Za-z0-9_.\-]+)/archive/(?P<tag>[A-Za-z0-9_.\-\+]+)\.(?P<ext>zip|tar\.gz)$`),
 		domain:    "{dnstag}.{repo}.{org}.{root}",
 		sumPrefix: "https://github.com/{org}/{repo}/releases/download/{tag}/",
+		aliases:   githubArchiveAliases,
 	},
+
+	// Github automatic archives by full tag ref
+	{
+		prefix: "github.com/",
+		// https://github.com/philips/releases-test/archive/refs/tags/v2.0.zip
+		regexp:    regexp.MustCompile(`^(?P<root>github\.com)/(?P<org>[A-Za-z0-9_.\-]+)/(?P<repo>[A-Za-z0-9_.\-]+)/archive/refs/tags/(?P<tag>[A-Za-z0-9_.\-\+]+)\.(?P<ext>zip|tar\.gz)$`),
+		domain:    "{dnstag}.{repo}.{org}.{root}",
+		sumPrefix: "https://github.com/{org}/{repo}/releases/download/{tag}/",
+		aliases:   githubArchiveAliases,
+	},
+}
+
+// githubArchiveAliases are the equivalent URLs GitHub serves a tag's
+// automatic source archive from.
+var githubArchiveAliases = []string{
+	"https://github.com/{org}/{repo}/archive/{tag}.{ext}",
+	"https://github.com/{org}/{repo}/archive/refs/tags/{tag}.{ext}",
 }
 
 func init() {
 	vcsPaths = append(vcsPaths, githubPaths...)
+	vcsPaths = append(vcsPaths, gitlabPaths(GitLabHost)...)
+	for _, host := range OCIRegistries {
+		vcsPaths = append(vcsPaths, ociPaths(host)...)
+	}
+	vcsPaths = append(vcsPaths, gomodPaths...)
+	vcsPaths = append(vcsPaths, pypiPaths...)
+	vcsPaths = append(vcsPaths, npmPaths...)
+	for _, p := range vcsPaths {
+		p.source = SourceBuiltin
+	}
 }
 
 // GitHubMatches returns a parsed out matches map for GitHub URLs. This can be
@@ -78,44 +117,95 @@ func GitHubMatches(githubURL string) (map[string]string, error) {
 }
 
 // Domain takes a target URL and returns the domain postfix to be appended to a
-// URLSumList.Domain()
-// TODO(philips): define a well-known URL format to do this
+// URLSumList.Domain() under Scheme0, see SchemeDomain. URLs of sites other
+// than GitHub are known once their Document is registered, see Resolver.
 // TODO(philips): handle docker URLs
 func Domain(target string) (string, error) {
-	match, err := matchesFromURL(target, vcsPaths)
+	match, err := matchesFromURL(target, knownPaths())
 	if err != nil {
 		return "", err
 	}
 	return match["domain"], nil
 }
 
+// SchemeDomain takes a target URL and returns the labels of its release in
+// a record domain made with scheme.
+func SchemeDomain(target string, scheme Scheme) (string, error) {
+	match, err := matchesFromURL(target, knownPaths())
+	if err != nil {
+		return "", err
+	}
+
+	switch scheme {
+	case Scheme0:
+		return match["domain"], nil
+	case Scheme1:
+		return match["domain1"], nil
+	case Scheme2:
+		return match["domain2"], nil
+	}
+	return "", fmt.Errorf("unknown record domain scheme %q", scheme)
+}
+
 // SumPrefix takes a target URL and returns the URL prefix for
 // the SHA256SUMS file for the target object.
 func SumPrefix(target string) (string, error) {
-	match, err := matchesFromURL(target, vcsPaths)
+	match, err := matchesFromURL(target, knownPaths())
 	if err != nil {
 		return "", err
 	}
 	return match["sumPrefix"], nil
 }
 
-// TrimDigest removes the two 16 digit hex subdomains and the record.merklecounty.com
-// parts to make a domain slug that can be used for project tracking
-func TrimDigestDomain(domain string) (string, error) {
-	if !strings.HasSuffix(domain, "."+PublicServiceHost) {
+// SumNames takes a target URL and returns the names the target may be listed
+// under in its SHA256SUMS file: the URL itself, its aliases and, for files
+// that live next to the SHA256SUMS file, the bare file name.
+func SumNames(target string) ([]string, error) {
+	match, err := matchesFromURL(target, knownPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	canonical := "https://" + strings.TrimPrefix(target, "https://")
+	names := []string{canonical}
+	for _, a := range strings.Split(match["aliases"], " ") {
+		if a != "" && a != canonical {
+			names = append(names, a)
+		}
+	}
+	if rel := strings.TrimPrefix(canonical, match["sumPrefix"]); rel != canonical && rel != "" {
+		names = append(names, rel)
+	}
+
+	return names, nil
+}
+
+// TrimDigest removes the two 16 digit hex subdomains and the recorder host,
+// such as recorder.merklecounty.com, to make a domain slug that can be used
+// for project tracking. The digest algorithm and scheme labels of Scheme1
+// and Scheme2 domains are removed too.
+func TrimDigestDomain(domain, host string) (string, error) {
+	if !strings.HasSuffix(domain, "."+host) {
 		return "", errors.New("incorrect domain suffix")
 	}
-	domain = strings.TrimSuffix(domain, "."+PublicServiceHost)
+	domain = strings.TrimSuffix(domain, "."+host)
 
 	parts := strings.Split(domain, ".")
 	if len(parts) < 3 {
 		return "", errors.New("domain too short")
 	}
 
-	if len(parts[0]) != 32 && len(parts[1]) != 32 {
+	if len(parts[0]) != 32 || len(parts[1]) != 32 {
 		return "", errors.New("digest part too short")
 	}
 
+	if DomainScheme(domain) != Scheme0 {
+		if len(parts) < 5 {
+			return "", errors.New("domain too short")
+		}
+		return strings.Join(parts[3:len(parts)-1], "."), nil
+	}
+
 	return strings.Join(parts[2:], "."), nil
 }
 
@@ -136,6 +226,13 @@ func expand(match map[string]string, s string) string {
 // domainFromURL takes a target download URL and builds a domain scheme that can be
 // prepended with a merkle root to resolve to a certificate
 func matchesFromURL(downloadURL string, vcsPaths []*vcsPath) (map[string]string, error) {
+	_, match, err := matchPath(downloadURL, vcsPaths)
+	return match, err
+}
+
+// matchPath returns the first of vcsPaths downloadURL matches and its
+// matches.
+func matchPath(downloadURL string, vcsPaths []*vcsPath) (*vcsPath, map[string]string, error) {
 	downloadPath := strings.TrimPrefix(downloadURL, "https://")
 
 	for _, srv := range vcsPaths {
@@ -156,6 +253,9 @@ func matchesFromURL(downloadURL string, vcsPaths []*vcsPath) (map[string]string,
 				match[name] = m[i]
 			}
 		}
+		if srv.normalize != nil {
+			srv.normalize(match)
+		}
 
 		// https://community.letsencrypt.org/t/dns-name-has-too-many-labels-error/21577
 		match["dnstag"] = strings.ReplaceAll(match["tag"], ".", "-")
@@ -163,6 +263,14 @@ func matchesFromURL(downloadURL string, vcsPaths []*vcsPath) (map[string]string,
 
 		if srv.domain != "" {
 			match["domain"] = expand(match, srv.domain)
+			builtin := srv.site == "" && srv.source != SourceConfig
+			labels := expand(scheme1Labels(match, srv.regexp, builtin), srv.domain)
+			match["domain1"] = labels + "." + string(Scheme1)
+			match["domain2"] = labels + "." + string(Scheme2)
+		}
+		// A site may only describe releases under its own host
+		if srv.site != "" && !strings.HasSuffix(match["domain1"], "."+srv.site+"."+string(Scheme1)) {
+			return nil, nil, fmt.Errorf("domain %v of %v is not under %v", match["domain"], downloadURL, srv.site)
 		}
 		if srv.sumPrefix != "" {
 			match["sumPrefix"] = expand(match, srv.sumPrefix)
@@ -170,7 +278,12 @@ func matchesFromURL(downloadURL string, vcsPaths []*vcsPath) (map[string]string,
 			// default to the directory of the file
 			match["sumPrefix"] = path.Dir(downloadPath)
 		}
-		return match, nil
+		var aliases []string
+		for _, a := range srv.aliases {
+			aliases = append(aliases, expand(match, a))
+		}
+		match["aliases"] = strings.Join(aliases, " ")
+		return srv, match, nil
 	}
-	return nil, errUnknownSite
+	return nil, nil, errUnknownSite
 }
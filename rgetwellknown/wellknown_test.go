@@ -1,6 +1,8 @@
 package rgetwellknown
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -14,6 +16,7 @@ func TestDomain(t *testing.T) {
 		{"https://github.com/philips/releases-test/archive/v2.0.zip", "v2-0.releases-test.philips.github.com", false},
 		{"https://github.com/philips/releases-test/archive/v2.0+nosums.zip", "v2-0-nosums.releases-test.philips.github.com", false},
 		{"https://github.com/philips/releases-test/archive/v2.0.tar.gz", "v2-0.releases-test.philips.github.com", false},
+		{"https://github.com/philips/releases-test/archive/refs/tags/v2.0.tar.gz", "v2-0.releases-test.philips.github.com", false},
 		{"https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS", "v2-0.releases-test.philips.github.com", false},
 	}
 
@@ -52,23 +55,75 @@ func TestSumPrefix(t *testing.T) {
 	}
 }
 
+func TestSumNames(t *testing.T) {
+	testCases := []struct {
+		downloadURL string
+		want        []string
+	}{
+		{
+			"https://github.com/philips/releases-test/releases/download/v2.0/rget-linux.tar.gz",
+			[]string{
+				"https://github.com/philips/releases-test/releases/download/v2.0/rget-linux.tar.gz",
+				"rget-linux.tar.gz",
+			},
+		},
+		{
+			"https://github.com/philips/releases-test/archive/v2.0.zip",
+			[]string{
+				"https://github.com/philips/releases-test/archive/v2.0.zip",
+				"https://github.com/philips/releases-test/archive/refs/tags/v2.0.zip",
+			},
+		},
+		{
+			"https://github.com/philips/releases-test/archive/refs/tags/v2.0.tar.gz",
+			[]string{
+				"https://github.com/philips/releases-test/archive/refs/tags/v2.0.tar.gz",
+				"https://github.com/philips/releases-test/archive/v2.0.tar.gz",
+			},
+		},
+		{
+			"https://api.github.com/repos/philips/releases-test/zipball/v2.0",
+			[]string{
+				"https://api.github.com/repos/philips/releases-test/zipball/v2.0",
+			},
+		},
+	}
+
+	for ti, tt := range testCases {
+		names, err := SumNames(tt.downloadURL)
+		if err != nil {
+			t.Errorf("%d: error from downloadURL %v: %v", ti, tt.downloadURL, err)
+		}
+
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%d: names %v != %v", ti, names, tt.want)
+		}
+	}
+}
+
 func TestTrimDigestDomain(t *testing.T) {
 	testCases := []struct {
 		domain  string
+		host    string
 		want    string
 		wantErr bool
 	}{
-		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.v0-0-4.rget.merklecounty.github.com.recorder.merklecounty.com", "v0-0-4.rget.merklecounty.github.com", false},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.v0-0-4.rget.merklecounty.github.com.recorder.merklecounty.com", PublicServiceHost, "v0-0-4.rget.merklecounty.github.com", false},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.sha256.e-v0-2e0-2e4.rget.merklecounty.github.com.1.recorder.merklecounty.com", PublicServiceHost, "e-v0-2e0-2e4.rget.merklecounty.github.com", false},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.sha256.e-v0-2e0-2e4.rget.merklecounty.github.com.1.staging.example.com", "staging.example.com", "e-v0-2e0-2e4.rget.merklecounty.github.com", false},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.sha256.e-v0-2e0-2e4.rget.merklecounty.github.com.2.recorder.merklecounty.com", PublicServiceHost, "e-v0-2e0-2e4.rget.merklecounty.github.com", false},
 		// digest too short
-		{"1.2.v0-0-4.rget.merklecounty.github.com.recorder.merklecounty.com", "", true},
+		{"1.2.v0-0-4.rget.merklecounty.github.com.recorder.merklecounty.com", PublicServiceHost, "", true},
 		// domain too short
-		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.recorder.merklecounty.com", "", true},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.recorder.merklecounty.com", PublicServiceHost, "", true},
 		// wrong domain
-		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.example.com", "", true},
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.example.com", PublicServiceHost, "", true},
+		// another recorder
+		{"2fcd82bbae7bcf7c0b0c5a2f91d3dd93.1e7c7be8587808ee85b347412ffa7514.v0-0-4.rget.merklecounty.github.com.recorder.merklecounty.com", "staging.example.com", "", true},
 	}
 
 	for ti, tt := range testCases {
-		dd, err := TrimDigestDomain(tt.domain)
+		dd, err := TrimDigestDomain(tt.domain, tt.host)
 		if !tt.wantErr && err != nil {
 			t.Errorf("%d: error from TrimDigestDomain %v: %v", ti, tt.domain, err)
 		}
@@ -86,3 +141,360 @@ func TestTrimDigestDomain(t *testing.T) {
 	}
 
 }
+
+func TestSchemeDomain(t *testing.T) {
+	testCases := []struct {
+		downloadURL string
+		scheme      Scheme
+		wantDomain  string
+	}{
+		{"https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS", Scheme0, "v2-0.releases-test.philips.github.com"},
+		{"https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS", Scheme1, "e-v2-2e0.e-releases-2dtest.philips.github.com.1"},
+		{"https://github.com/philips/releases-test/releases/download/v2-0/SHA256SUMS", Scheme1, "e-v2-2d0.e-releases-2dtest.philips.github.com.1"},
+		{"https://github.com/philips/releases-test/archive/v2.0+nosums.zip", Scheme1, "e-v2-2e0-2bnosums.e-releases-2dtest.philips.github.com.1"},
+		{"https://github.com/Philips/Release_Test/releases/download/v2/SHA256SUMS", Scheme1, "v2.e-release-5ftest.philips.github.com.1"},
+		{"https://github.com/philips/releases-test/releases/download/V2/SHA256SUMS", Scheme1, "e--562.e-releases-2dtest.philips.github.com.1"},
+		{"https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS", Scheme2, "e-v2-2e0.e-releases-2dtest.philips.github.com.2"},
+	}
+
+	for ti, tt := range testCases {
+		dd, err := SchemeDomain(tt.downloadURL, tt.scheme)
+		if err != nil {
+			t.Errorf("%d: error from downloadURL %v: %v", ti, tt.downloadURL, err)
+		}
+
+		if dd != tt.wantDomain {
+			t.Errorf("%d: domain %v != %v", ti, dd, tt.wantDomain)
+		}
+	}
+}
+
+func TestEncodeLabel(t *testing.T) {
+	testCases := []struct {
+		s      string
+		label  string
+		hashed bool
+	}{
+		{"v2", "v2", false},
+		{"v2.0", "e-v2-2e0", false},
+		{"v2-0", "e-v2-2d0", false},
+		{"v2+0", "e-v2-2b0", false},
+		{"V2.0", "e--562-2e0", false},
+		{"e-v2", "e-e-2dv2", false},
+		{strings.Repeat("a", 63), strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 64), "", true},
+		{strings.Repeat("a.", 30), "", true},
+	}
+
+	seen := make(map[string]string)
+	for ti, tt := range testCases {
+		label := EncodeLabel(tt.s)
+		if len(label) > 63 || strings.HasSuffix(label, "-") {
+			t.Errorf("%d: invalid label %q", ti, label)
+		}
+		if other, ok := seen[label]; ok {
+			t.Errorf("%d: %q and %q both encode to %q", ti, tt.s, other, label)
+		}
+		seen[label] = tt.s
+
+		if tt.hashed {
+			if !strings.HasPrefix(label, "h-") {
+				t.Errorf("%d: want hashed label got %q", ti, label)
+			}
+			continue
+		}
+		if label != tt.label {
+			t.Errorf("%d: label %q != %q", ti, label, tt.label)
+		}
+		if s, err := DecodeLabel(label); err != nil || s != tt.s {
+			t.Errorf("%d: decoded %q to %q: %v", ti, label, s, err)
+		}
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	testCases := []struct {
+		downloadURL string
+		domain1     string
+		sumPrefix   string
+	}{
+		{
+			"https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/rget-linux.tar.gz",
+			"e-v2-2e0.e-releases-2dtest.philips.gitlab.com.1",
+			"https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/",
+		},
+		{
+			"https://gitlab.com/philips/releases-test/-/archive/v2.0/releases-test-v2.0.tar.gz",
+			"e-v2-2e0.e-releases-2dtest.philips.gitlab.com.1",
+			"https://gitlab.com/philips/releases-test/-/releases/v2.0/downloads/",
+		},
+		// Projects in subgroups
+		{
+			"https://gitlab.com/Merkle/County/releases-test/-/archive/v2.0/releases-test-v2.0.zip",
+			"e-v2-2e0.e-releases-2dtest.e-merkle-2fcounty.gitlab.com.1",
+			"https://gitlab.com/Merkle/County/releases-test/-/releases/v2.0/downloads/",
+		},
+		{
+			"https://gitlab.com/api/v4/projects/1234/packages/generic/rget/v2.0/rget-linux.tar.gz",
+			"e-v2-2e0.rget.1234.packages.gitlab.com.1",
+			"https://gitlab.com/api/v4/projects/1234/packages/generic/rget/v2.0/",
+		},
+	}
+
+	for ti, tt := range testCases {
+		d, err := SchemeDomain(tt.downloadURL, Scheme1)
+		if err != nil || d != tt.domain1 {
+			t.Errorf("%d: domain %v want %v: %v", ti, d, tt.domain1, err)
+		}
+		p, err := SumPrefix(tt.downloadURL)
+		if err != nil || p != tt.sumPrefix {
+			t.Errorf("%d: sum prefix %v want %v: %v", ti, p, tt.sumPrefix, err)
+		}
+	}
+
+	// Self-hosted instances are only known once added
+	const selfHosted = "https://git.example.com/ops/tool/-/archive/v1.0/tool-v1.0.tar.gz"
+	if _, err := SumPrefix(selfHosted); err == nil {
+		t.Errorf("unknown GitLab instance matched")
+	}
+	AddGitLabHost("git.example.com")
+	if d, err := SchemeDomain(selfHosted, Scheme1); err != nil || d != "e-v1-2e0.tool.ops.git.example.com.1" {
+		t.Errorf("self-hosted domain %v: %v", d, err)
+	}
+
+	m, err := GitLabMatches("https://git.example.com/ops/sub/tool/-/releases/v1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["org"] != "ops/sub" || m["repo"] != "tool" || m["tag"] != "v1.0" || m["root"] != "git.example.com" {
+		t.Errorf("release page matches %v", m)
+	}
+}
+
+func TestForges(t *testing.T) {
+	const attachment = "https://code.example.com/Ops/Tool/releases/download/v1.0/tool.tar.gz"
+	if _, err := SumPrefix(attachment); err == nil {
+		t.Errorf("unknown Gitea instance matched")
+	}
+	if err := AddForgeHost(Gitea, "code.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for ti, tt := range []string{
+		attachment,
+		"https://code.example.com/Ops/Tool/archive/v1.0.tar.gz",
+		"https://code.example.com/Ops/Tool/archive/v1.0.zip",
+	} {
+		d, err := SchemeDomain(tt, Scheme1)
+		if err != nil || d != "e-v1-2e0.tool.ops.code.example.com.1" {
+			t.Errorf("%d: domain %v: %v", ti, d, err)
+		}
+		p, err := SumPrefix(tt)
+		if err != nil || p != "https://code.example.com/Ops/Tool/releases/download/v1.0/" {
+			t.Errorf("%d: sum prefix %v: %v", ti, p, err)
+		}
+	}
+
+	for ti, tt := range []struct {
+		url   string
+		forge Forge
+		org   string
+	}{
+		{"https://code.example.com/Ops/Tool/releases/tag/v1.0", Gitea, "Ops"},
+		{"https://gitlab.com/ops/sub/tool/-/releases/v1.0", GitLab, "ops/sub"},
+		{"https://github.com/ops/tool/releases/tag/v1.0", GitHub, "ops"},
+	} {
+		f, m, err := ForgeMatches(tt.url)
+		if err != nil || f != tt.forge || m["org"] != tt.org || m["tag"] != "v1.0" {
+			t.Errorf("%d: forge %v matches %v: %v", ti, f, m, err)
+		}
+	}
+	if _, _, err := ForgeMatches("https://other.example.com/ops/tool/releases/tag/v1.0"); err == nil {
+		t.Errorf("unknown forge matched")
+	}
+
+	// A host is an instance of one forge only
+	if err := AddForgeHost(GitLab, "code.example.com"); err == nil {
+		t.Errorf("Gitea instance added as GitLab")
+	}
+	if err := AddForgeHost(GitHub, "github.example.com"); err == nil {
+		t.Errorf("self-hosted GitHub added")
+	}
+}
+
+func TestImages(t *testing.T) {
+	for _, host := range []string{"localhost:5000", "LOCALHOST:5001", "images.example.com:443"} {
+		if err := AddOCIRegistry(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddOCIRegistry("https://images.example.com/"); err == nil {
+		t.Errorf("URL added as a registry")
+	}
+
+	for ti, tt := range []struct {
+		url     string
+		domain1 string
+	}{
+		{"https://ghcr.io/v2/merklecounty/rget/manifests/v0.0.6", "e-v0-2e0-2e6.e-merklecounty-2frget.oci-image.ghcr.io.1"},
+		{"https://registry-1.docker.io/v2/library/nginx/manifests/latest", "latest.e-library-2fnginx.oci-image.registry-1.docker.io.1"},
+		// Only known registries
+		{"https://registry.example.com/v2/tool/manifests/v1", ""},
+		{"https://10.0.0.1/v2/tool/manifests/v1", ""},
+		{"https://localhost:5000/v2/tool/manifests/v1", "v1.tool.oci-image-5000.localhost.1"},
+		{"https://localhost:5001/v2/tool/manifests/v1", "v1.tool.oci-image-5001.localhost.1"},
+		{"https://localhost/v2/tool/manifests/v1", ""},
+		{"https://images.example.com/v2/tool/manifests/v1", "v1.tool.oci-image.images.example.com.1"},
+	} {
+		d, err := SchemeDomain(tt.url, Scheme1)
+		if tt.domain1 == "" {
+			if err == nil {
+				t.Errorf("%d: unknown registry has domain %v", ti, d)
+			}
+			continue
+		}
+		if err != nil || d != tt.domain1 {
+			t.Errorf("%d: domain %v want %v: %v", ti, d, tt.domain1, err)
+		}
+	}
+}
+
+func TestGoModules(t *testing.T) {
+	for ti, tt := range []struct {
+		url     string
+		domain1 string
+		names   []string
+	}{
+		{
+			"https://proxy.golang.org/golang.org/x/text/@v/v0.3.2.zip",
+			"e-v0-2e3-2e2.e-golang-2eorg-2fx-2ftext.go-module.proxy.golang.org.1",
+			[]string{"https://proxy.golang.org/golang.org/x/text/@v/v0.3.2.zip", "v0.3.2.zip"},
+		},
+		{
+			"https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v0.3.1.mod",
+			"e-v0-2e3-2e1.e-github-2ecom-2f-21burnt-21sushi-2ftoml.go-module.proxy.golang.org.1",
+			[]string{"https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v0.3.1.mod", "v0.3.1.mod"},
+		},
+	} {
+		d, err := SchemeDomain(tt.url, Scheme1)
+		if err != nil || d != tt.domain1 {
+			t.Errorf("%d: domain %v want %v: %v", ti, d, tt.domain1, err)
+		}
+		names, err := SumNames(tt.url)
+		if err != nil || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%d: sum names %v: %v", ti, names, err)
+		}
+	}
+}
+
+func TestRegistries(t *testing.T) {
+	for ti, tt := range []struct {
+		url      string
+		registry Registry
+		pkg      string
+		version  string
+		domain1  string
+	}{
+		{
+			"https://files.pythonhosted.org/packages/36/7a/87837f39d0296e723bb9b62bbb257d0355c7f6128853c78955f57342a56d/python_dateutil-2.8.2-py2.py3-none-any.whl",
+			PyPI, "python-dateutil", "2.8.2",
+			"e-2-2e8-2e2.e-python-2ddateutil.pypi-package.files.pythonhosted.org.1",
+		},
+		{
+			"https://files.pythonhosted.org/packages/4c/c4/13b4776ea2d76c115c1d1b84579f3764ee6d57204f6be27119f13a61d0a9/python-dateutil-2.8.2.tar.gz",
+			PyPI, "python-dateutil", "2.8.2",
+			"e-2-2e8-2e2.e-python-2ddateutil.pypi-package.files.pythonhosted.org.1",
+		},
+		{
+			"https://files.pythonhosted.org/packages/d9/5a/e7c31adbe875f2abbb91bd84cf2dc52d792b5a01506781dbcf25c91daf11/Django-4.2.7-py3-none-any.whl",
+			PyPI, "django", "4.2.7",
+			"e-4-2e2-2e7.django.pypi-package.files.pythonhosted.org.1",
+		},
+		{
+			"https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+			NPM, "left-pad", "1.3.0",
+			"e-1-2e3-2e0.e-left-2dpad.npm-package.registry.npmjs.org.1",
+		},
+		{
+			"https://registry.npmjs.org/@types/node/-/node-12.7.2.tgz",
+			NPM, "@types/node", "12.7.2",
+			"e-12-2e7-2e2.e--40types-2fnode.npm-package.registry.npmjs.org.1",
+		},
+	} {
+		r, m, err := RegistryMatches(tt.url)
+		if err != nil {
+			t.Errorf("%d: %v", ti, err)
+			continue
+		}
+		if r != tt.registry || m["package"] != tt.pkg || m["tag"] != tt.version {
+			t.Errorf("%d: got %v %v %v", ti, r, m["package"], m["tag"])
+		}
+		d, err := SchemeDomain(tt.url, Scheme1)
+		if err != nil || d != tt.domain1 {
+			t.Errorf("%d: domain %v want %v: %v", ti, d, tt.domain1, err)
+		}
+		names, err := SumNames(tt.url)
+		if err != nil || names[0] != tt.url {
+			t.Errorf("%d: sum names %v: %v", ti, names, err)
+		}
+	}
+
+	if _, _, err := RegistryMatches("https://github.com/philips/releases-test/releases/download/v2.0/SHA256SUMS"); err == nil {
+		t.Errorf("release matched a registry")
+	}
+}
+
+func TestAptRepositories(t *testing.T) {
+	for _, host := range []string{"deb.debian.org", "APT.example.com"} {
+		if err := AddAptHost(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAptHost("apt.example.com:8443"); err == nil {
+		t.Errorf("host with a port added")
+	}
+
+	for ti, tt := range []struct {
+		url     string
+		domain1 string
+		names   []string
+	}{
+		{
+			"https://deb.debian.org/debian/dists/bookworm/main/binary-amd64/Packages.xz",
+			"bookworm.debian.apt-repo.deb.debian.org.1",
+			[]string{"https://deb.debian.org/debian/dists/bookworm/main/binary-amd64/Packages.xz", "main/binary-amd64/Packages.xz"},
+		},
+		{
+			"https://deb.debian.org/debian/dists/bookworm/InRelease",
+			"bookworm.debian.apt-repo.deb.debian.org.1",
+			[]string{"https://deb.debian.org/debian/dists/bookworm/InRelease", "InRelease"},
+		},
+		{
+			"https://apt.example.com/dists/stable/main/binary-arm64/Packages.gz",
+			"stable.apt-repo.apt.example.com.1",
+			[]string{"https://apt.example.com/dists/stable/main/binary-arm64/Packages.gz", "main/binary-arm64/Packages.gz"},
+		},
+	} {
+		if _, err := AptMatches(tt.url); err != nil {
+			t.Errorf("%d: %v", ti, err)
+		}
+		d, err := SchemeDomain(tt.url, Scheme1)
+		if err != nil || d != tt.domain1 {
+			t.Errorf("%d: domain %v want %v: %v", ti, d, tt.domain1, err)
+		}
+		names, err := SumNames(tt.url)
+		if err != nil || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%d: sum names %v: %v", ti, names, err)
+		}
+	}
+
+	// Only added hosts
+	if _, err := AptMatches("https://deb.example.org/debian/dists/bookworm/InRelease"); err == nil {
+		t.Errorf("suite of a host not added matched")
+	}
+
+	// Built in sites take precedence
+	if d, err := SchemeDomain("https://github.com/org/dists/releases/download/v1.0/file.txt", Scheme1); err != nil || d != "e-v1-2e0.dists.org.github.com.1" {
+		t.Errorf("release domain %v: %v", d, err)
+	}
+}